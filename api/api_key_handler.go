@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"workout-tracker/middleware"
+	"workout-tracker/response"
+	"workout-tracker/store"
+	"workout-tracker/tokens"
+)
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyHandler struct {
+	apiKeyStore store.APIKeyStore
+	logger      *slog.Logger
+}
+
+func NewAPIKeyHandler(apiKeyStore store.APIKeyStore, logger *slog.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyStore: apiKeyStore,
+		logger:      logger,
+	}
+}
+
+func (kh *APIKeyHandler) validateAPIKeyRequest(req *createAPIKeyRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("Name is required")
+	}
+	if len(req.Scopes) == 0 {
+		return fmt.Errorf("At least one scope is required, choose from %s", strings.Join(tokens.DelegatedScopes, ", "))
+	}
+	for _, scope := range req.Scopes {
+		if !tokens.ValidDelegatedScope(scope) {
+			return fmt.Errorf("Unknown scope %q", scope)
+		}
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return errors.New("Expiry must be in the future")
+	}
+	return nil
+}
+
+func (kh *APIKeyHandler) HandleGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	keys, err := kh.apiKeyStore.GetAPIKeysByUser(r.Context(), currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get API keys", err)
+		return
+	}
+
+	response.Success(w, "API keys retrieved successfully", keys)
+}
+
+// HandleCreateAPIKey returns the new key in plaintext. It cannot be
+// retrieved again.
+func (kh *APIKeyHandler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var keyReq createAPIKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&keyReq)
+	if err != nil {
+		response.BadRequest(w, "Failed to decode API key data", err)
+		return
+	}
+
+	err = kh.validateAPIKeyRequest(&keyReq)
+	if err != nil {
+		response.BadRequest(w, "Invalid API key data", err)
+		return
+	}
+
+	generated, err := tokens.GenerateAPIKey()
+	if err != nil {
+		response.InternalServerError(w, "Failed to generate API key", err)
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	key := &store.APIKey{
+		UserId:    currentUser.Id,
+		Name:      keyReq.Name,
+		Prefix:    generated.Prefix,
+		Scopes:    keyReq.Scopes,
+		ExpiresAt: keyReq.ExpiresAt,
+	}
+	err = kh.apiKeyStore.CreateAPIKey(r.Context(), key, generated.Hash)
+	if err != nil {
+		response.InternalServerError(w, "Failed to create API key", err)
+		return
+	}
+
+	response.Created(w, "API key created, store it now as it will not be shown again", map[string]interface{}{
+		"api_key": key,
+		"key":     generated.PlainText,
+	})
+}
+
+func (kh *APIKeyHandler) HandleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyId, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		response.NotFound(w, "Invalid API key ID format")
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	deleted, err := kh.apiKeyStore.DeleteAPIKey(r.Context(), keyId, currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to revoke API key with ID %d", keyId), err)
+		return
+	}
+	if !deleted {
+		response.NotFound(w, fmt.Sprintf("API key with ID %d not found", keyId))
+		return
+	}
+
+	response.Success(w, "API key revoked", map[string]int64{"api_key_id": keyId})
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"workout-tracker/ical"
+	"workout-tracker/middleware"
+	"workout-tracker/reminders"
+	"workout-tracker/response"
+	"workout-tracker/store"
+	"workout-tracker/tokens"
+)
+
+// calendarFeedPrefix marks the secret in a calendar feed URL.
+const calendarFeedPrefix = "cal_"
+
+// The feed holds a year of workouts and four weeks of scheduled sessions.
+const (
+	feedHistory       = 365 * 24 * time.Hour
+	feedUpcoming      = 28 * 24 * time.Hour
+	maxFeedWorkouts   = 1000
+	feedRefresh       = time.Hour
+	feedSessionLength = time.Hour
+)
+
+// uidDomain ends every event UID. It is fixed rather than taken from the
+// public URL so UIDs survive the server moving.
+const uidDomain = "@workout-tracker"
+
+type CalendarFeedHandler struct {
+	feedStore     store.CalendarFeedStore
+	workoutStore  store.WorkoutStore
+	reminderStore store.ReminderStore
+	publicURL     string
+	logger        *slog.Logger
+}
+
+func NewCalendarFeedHandler(feedStore store.CalendarFeedStore, workoutStore store.WorkoutStore, reminderStore store.ReminderStore, publicURL string, logger *slog.Logger) *CalendarFeedHandler {
+	return &CalendarFeedHandler{
+		feedStore:     feedStore,
+		workoutStore:  workoutStore,
+		reminderStore: reminderStore,
+		publicURL:     strings.TrimSuffix(publicURL, "/"),
+		logger:        logger,
+	}
+}
+
+// HandleCreateFeed returns the secret URL of the user's calendar feed.
+// Only a hash of the secret is kept, so calling it again replaces the URL,
+// which is also how a leaked URL is retired.
+func (cfh *CalendarFeedHandler) HandleCreateFeed(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	secret, err := tokens.GenerateSecret(calendarFeedPrefix)
+	if err != nil {
+		response.InternalServerError(w, "Failed to generate calendar feed secret", err)
+		return
+	}
+	err = cfh.feedStore.SetFeedSecret(r.Context(), currentUser.Id, tokens.HashSecret(secret))
+	if err != nil {
+		response.InternalServerError(w, "Failed to create calendar feed", err)
+		return
+	}
+
+	response.Created(w, "Calendar feed created, store the URL now as it will not be shown again", map[string]string{
+		"url": cfh.publicURL + "/calendar/feed.ics?token=" + secret,
+	})
+}
+
+func (cfh *CalendarFeedHandler) HandleDeleteFeed(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	deleted, err := cfh.feedStore.DeleteFeed(r.Context(), currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to delete calendar feed", err)
+		return
+	}
+	if !deleted {
+		response.NotFound(w, "Calendar feed not found")
+		return
+	}
+
+	response.Success(w, "Calendar feed deleted", nil)
+}
+
+// HandleGetFeed serves the feed named by the secret in ?token=. Calendar
+// apps cannot send credentials, so the secret is the only authentication.
+// It is kept out of the path, which is logged.
+func (cfh *CalendarFeedHandler) HandleGetFeed(w http.ResponseWriter, r *http.Request) {
+	secret := r.URL.Query().Get("token")
+	if !strings.HasPrefix(secret, calendarFeedPrefix) {
+		response.NotFound(w, "Calendar feed not found")
+		return
+	}
+	user, err := cfh.feedStore.GetUserByFeedSecret(r.Context(), secret)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get calendar feed", err)
+		return
+	}
+	if user == nil {
+		response.NotFound(w, "Calendar feed not found")
+		return
+	}
+
+	now := time.Now()
+	workouts, err := cfh.workoutStore.GetWorkoutsSince(r.Context(), user.Id, now.Add(-feedHistory), maxFeedWorkouts)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get workouts", err)
+		return
+	}
+	userReminders, err := cfh.reminderStore.GetRemindersByUser(r.Context(), user.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get reminders", err)
+		return
+	}
+
+	calendar := &ical.Calendar{
+		ProdId:          "-//workout-tracker//calendar feed//EN",
+		Name:            user.UserName + "'s workouts",
+		RefreshInterval: feedRefresh,
+	}
+	for _, workout := range workouts {
+		calendar.Events = append(calendar.Events, workoutEvent(&workout))
+	}
+	for _, reminder := range userReminders {
+		calendar.Events = append(calendar.Events, sessionEvents(&reminder, now, now.Add(feedUpcoming))...)
+	}
+
+	var body bytes.Buffer
+	err = calendar.Encode(&body)
+	if err != nil {
+		response.InternalServerError(w, "Failed to encode calendar feed", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="workouts.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write(body.Bytes())
+}
+
+// workoutEvent places a workout so that it ends when it was logged.
+func workoutEvent(workout *store.Workout) ical.Event {
+	duration := max(time.Duration(workout.DurationMinutes)*time.Minute, time.Minute)
+	modified := workout.UpdatedAt
+	if modified.IsZero() {
+		modified = workout.CreatedAt
+	}
+
+	var lines []string
+	if workout.Description != "" {
+		lines = append(lines, workout.Description, "")
+	}
+	for _, entry := range workout.Entries {
+		lines = append(lines, describeEntry(&entry))
+	}
+	if workout.CaloriesBurned > 0 {
+		lines = append(lines, "", fmt.Sprintf("%d minutes, %d kcal", workout.DurationMinutes, workout.CaloriesBurned))
+	}
+
+	return ical.Event{
+		Uid:          "workout-" + strconv.Itoa(workout.Id) + uidDomain,
+		Stamp:        modified,
+		LastModified: modified,
+		Start:        workout.CreatedAt.Add(-duration),
+		End:          workout.CreatedAt,
+		Summary:      workout.Title,
+		Description:  strings.Join(lines, "\n"),
+	}
+}
+
+// describeEntry summarizes an entry, e.g. "Squat: 3 x 5 @ 100". Weights
+// are shown as logged, since workouts do not record their unit.
+func describeEntry(entry *store.WorkoutEntry) string {
+	summary := fmt.Sprintf("%s: %d", entry.ExerciseName, entry.Sets)
+	if entry.Reps != nil {
+		summary += fmt.Sprintf(" x %d", *entry.Reps)
+	} else if entry.DurationSeconds != nil {
+		summary += fmt.Sprintf(" x %ds", *entry.DurationSeconds)
+	}
+	if entry.Weight != nil {
+		summary += " @ " + strconv.FormatFloat(*entry.Weight, 'f', -1, 64)
+	}
+	return summary
+}
+
+// sessionEvents lists the sessions an active schedule reminder plans
+// between from and until. A session's UID names its reminder and day.
+func sessionEvents(reminder *store.Reminder, from, until time.Time) []ical.Event {
+	if reminder.Kind != store.ReminderSchedule || !reminder.Active {
+		return nil
+	}
+	loc, err := time.LoadLocation(reminder.Timezone)
+	if err != nil {
+		return nil
+	}
+
+	var events []ical.Event
+	for run, err := reminders.NextRun(reminder, from); err == nil && run.Before(until); run, err = reminders.NextRun(reminder, run) {
+		events = append(events, ical.Event{
+			Uid:         fmt.Sprintf("session-%d-%s%s", reminder.Id, run.In(loc).Format("20060102"), uidDomain),
+			Stamp:       reminder.CreatedAt,
+			Start:       run,
+			End:         run.Add(feedSessionLength),
+			Summary:     reminder.Name,
+			Description: "Scheduled session",
+		})
+	}
+	return events
+}
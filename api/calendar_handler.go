@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	"workout-tracker/middleware"
+	"workout-tracker/response"
+	"workout-tracker/store"
+)
+
+const (
+	defaultRestDays = 1
+	maxRestDays     = 6
+)
+
+type calendarDay struct {
+	Date            string `json:"date"`
+	Workouts        int    `json:"workouts"`
+	DurationMinutes int    `json:"duration"`
+	CaloriesBurned  int    `json:"calories_burned"`
+}
+
+type calendarResponse struct {
+	Year          int                 `json:"year"`
+	Timezone      string              `json:"timezone"`
+	Days          []calendarDay       `json:"days"`
+	CurrentStreak int                 `json:"current_streak"`
+	LongestStreak int                 `json:"longest_streak"`
+	RestDays      int                 `json:"rest_days"`
+	WeeklySummary store.WeeklySummary `json:"weekly_summary"`
+}
+
+type CalendarHandler struct {
+	workoutStore store.WorkoutStore
+	logger       *slog.Logger
+}
+
+func NewCalendarHandler(workoutStore store.WorkoutStore, logger *slog.Logger) *CalendarHandler {
+	return &CalendarHandler{
+		workoutStore: workoutStore,
+		logger:       logger,
+	}
+}
+
+func (ch *CalendarHandler) HandleGetCalendar(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	loc := currentUser.Location()
+	today := store.CalendarDate(time.Now().In(loc))
+
+	year := today.Year()
+	if param := r.URL.Query().Get("year"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 1970 || parsed > 9999 {
+			response.BadRequest(w, "Invalid year", errors.New("year must be a four digit number"))
+			return
+		}
+		year = parsed
+	}
+
+	restDays := defaultRestDays
+	if param := r.URL.Query().Get("rest_days"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 0 || parsed > maxRestDays {
+			response.BadRequest(w, "Invalid rest day tolerance", errors.New("rest_days must be between 0 and 6"))
+			return
+		}
+		restDays = parsed
+	}
+
+	activity, err := ch.workoutStore.GetDailyActivity(r.Context(), currentUser.Id, loc.String())
+	if err != nil {
+		response.InternalServerError(w, "Failed to get workout activity", err)
+		return
+	}
+
+	calendar := calendarResponse{
+		Year:          year,
+		Timezone:      loc.String(),
+		Days:          []calendarDay{},
+		RestDays:      restDays,
+		WeeklySummary: store.SummarizeWeek(activity, today),
+	}
+	calendar.CurrentStreak, calendar.LongestStreak = store.CalculateStreaks(activity, today, restDays)
+
+	for _, day := range activity {
+		if day.Date.Year() != year {
+			continue
+		}
+		calendar.Days = append(calendar.Days, calendarDay{
+			Date:            day.Date.Format(time.DateOnly),
+			Workouts:        day.Workouts,
+			DurationMinutes: day.DurationMinutes,
+			CaloriesBurned:  day.CaloriesBurned,
+		})
+	}
+
+	response.Success(w, "Calendar retrieved successfully", calendar)
+}
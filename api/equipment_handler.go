@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"workout-tracker/middleware"
+	"workout-tracker/plates"
+	"workout-tracker/response"
+	"workout-tracker/store"
+)
+
+type EquipmentHandler struct {
+	equipmentStore store.EquipmentStore
+	logger         *slog.Logger
+}
+
+func NewEquipmentHandler(equipmentStore store.EquipmentStore, logger *slog.Logger) *EquipmentHandler {
+	return &EquipmentHandler{
+		equipmentStore: equipmentStore,
+		logger:         logger,
+	}
+}
+
+func (eh *EquipmentHandler) HandleGetEquipment(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	equipment, err := eh.equipmentStore.GetEquipment(r.Context(), currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get equipment", err)
+		return
+	}
+	response.Success(w, "Equipment retrieved successfully", equipment)
+}
+
+func (eh *EquipmentHandler) HandleUpdateEquipment(w http.ResponseWriter, r *http.Request) {
+	var equipment plates.Equipment
+	err := json.NewDecoder(r.Body).Decode(&equipment)
+	if err != nil {
+		response.BadRequest(w, "Failed to decode equipment data", err)
+		return
+	}
+
+	err = equipment.Validate()
+	if err != nil {
+		response.BadRequest(w, "Invalid equipment data", err)
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = eh.equipmentStore.UpdateEquipment(r.Context(), currentUser.Id, &equipment)
+	if err != nil {
+		response.InternalServerError(w, "Failed to update equipment", err)
+		return
+	}
+	response.Success(w, "Equipment successfully updated", equipment)
+}
+
+// HandleGetPlateLoading returns how to load a barbell for ?weight=, the
+// closest weight the user can actually load and a warm-up ladder to it.
+// ?bar= picks one of the user's barbells and defaults to the first.
+func (eh *EquipmentHandler) HandleGetPlateLoading(w http.ResponseWriter, r *http.Request) {
+	target, err := strconv.ParseFloat(r.URL.Query().Get("weight"), 64)
+	if err != nil || target <= 0 {
+		response.BadRequest(w, "Invalid target weight", errors.New("weight must be a positive number"))
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	equipment, err := eh.equipmentStore.GetEquipment(r.Context(), currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get equipment", err)
+		return
+	}
+	if len(equipment.Barbells) == 0 {
+		response.BadRequest(w, "No barbell available", errors.New("add a barbell to your equipment profile"))
+		return
+	}
+
+	bar := equipment.Barbells[0]
+	if param := r.URL.Query().Get("bar"); param != "" {
+		bar, err = strconv.ParseFloat(param, 64)
+		if err != nil || !hasBarbell(equipment, bar) {
+			response.BadRequest(w, "Invalid barbell", errors.New("bar must match one of your barbells"))
+			return
+		}
+	}
+
+	loading := equipment.LoadBarbell(bar, target, plates.Nearest)
+	response.Success(w, "Plate loading calculated successfully", map[string]interface{}{
+		"loading": loading,
+		"warmup":  equipment.WarmupLadder(bar, loading.Weight),
+	})
+}
+
+func hasBarbell(equipment *plates.Equipment, bar float64) bool {
+	for _, barbell := range equipment.Barbells {
+		if barbell == bar {
+			return true
+		}
+	}
+	return false
+}
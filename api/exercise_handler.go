@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"workout-tracker/middleware"
+	"workout-tracker/overload"
+	"workout-tracker/plates"
+	"workout-tracker/response"
+	"workout-tracker/store"
+)
+
+type ExerciseHandler struct {
+	exerciseStore  store.ExerciseStore
+	equipmentStore store.EquipmentStore
+	logger         *slog.Logger
+}
+
+func NewExerciseHandler(exerciseStore store.ExerciseStore, equipmentStore store.EquipmentStore, logger *slog.Logger) *ExerciseHandler {
+	return &ExerciseHandler{
+		exerciseStore:  exerciseStore,
+		equipmentStore: equipmentStore,
+		logger:         logger,
+	}
+}
+
+func (eh *ExerciseHandler) getExercise(w http.ResponseWriter, r *http.Request) *store.Exercise {
+	exerciseId, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		response.NotFound(w, "Invalid exercise ID format")
+		return nil
+	}
+
+	exercise, err := eh.exerciseStore.GetExerciseById(r.Context(), exerciseId)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to get exercise with ID %d", exerciseId), err)
+		return nil
+	}
+	if exercise == nil {
+		response.NotFound(w, fmt.Sprintf("Exercise with ID %d not found", exerciseId))
+		return nil
+	}
+	return exercise
+}
+
+func (eh *ExerciseHandler) HandleGetExercises(w http.ResponseWriter, r *http.Request) {
+	exercises, err := eh.exerciseStore.GetExercises(r.Context())
+	if err != nil {
+		response.InternalServerError(w, "Failed to get exercises", err)
+		return
+	}
+	response.Success(w, "Exercises retrieved successfully", exercises)
+}
+
+func (eh *ExerciseHandler) HandleGetSuggestion(w http.ResponseWriter, r *http.Request) {
+	exercise := eh.getExercise(w, r)
+	if exercise == nil {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	settings, err := eh.exerciseStore.GetProgressionSettings(r.Context(), currentUser.Id, exercise)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get progression settings", err)
+		return
+	}
+
+	sessions, err := eh.exerciseStore.GetRecentSessions(r.Context(), currentUser.Id, exercise.Name, overload.HistorySessions)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to get history for %s", exercise.Name), err)
+		return
+	}
+
+	equipment, err := eh.equipmentStore.GetEquipment(r.Context(), currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get equipment", err)
+		return
+	}
+
+	// Round to what the user can load, falling back to the configured step
+	// when their equipment does not cover this exercise.
+	stepRounder := overload.StepRounder(settings.Rounding)
+	round := func(weight float64, up bool) float64 {
+		direction := plates.Down
+		if up {
+			direction = plates.Up
+		}
+		if rounded, ok := equipment.Round(exercise.Equipment, exercise.Name, weight, direction); ok {
+			return rounded
+		}
+		return stepRounder(weight, up)
+	}
+
+	suggestion := overload.Suggest(sessions, *settings, round)
+	if suggestion == nil {
+		response.NotFound(w, fmt.Sprintf("No logged sessions of %s to base a suggestion on", exercise.Name))
+		return
+	}
+
+	response.Success(w, "Suggestion retrieved successfully", map[string]interface{}{
+		"exercise":   exercise,
+		"settings":   settings,
+		"suggestion": suggestion,
+	})
+}
+
+func (eh *ExerciseHandler) HandleUpdateProgressionSettings(w http.ResponseWriter, r *http.Request) {
+	exercise := eh.getExercise(w, r)
+	if exercise == nil {
+		return
+	}
+
+	var settings overload.Settings
+	err := json.NewDecoder(r.Body).Decode(&settings)
+	if err != nil {
+		response.BadRequest(w, "Failed to decode progression settings", err)
+		return
+	}
+
+	if settings.WeightIncrement <= 0 || settings.Rounding < 0 || settings.TargetReps <= 0 {
+		response.BadRequest(w, "Invalid progression settings", errors.New("Weight increment and target reps must be positive and rounding must not be negative"))
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = eh.exerciseStore.UpsertProgressionSettings(r.Context(), currentUser.Id, exercise.Id, &settings)
+	if err != nil {
+		response.InternalServerError(w, "Failed to update progression settings", err)
+		return
+	}
+
+	response.Success(w, "Progression settings successfully updated", settings)
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"workout-tracker/middleware"
+	"workout-tracker/response"
+	"workout-tracker/store"
+)
+
+type createGoalRequest struct {
+	GoalType     string     `json:"goal_type"`
+	ExerciseName *string    `json:"exercise_name"`
+	TargetValue  float64    `json:"target_value"`
+	Deadline     *time.Time `json:"deadline"`
+}
+
+type GoalHandler struct {
+	goalStore store.GoalStore
+	logger    *slog.Logger
+}
+
+func NewGoalHandler(goalStore store.GoalStore, logger *slog.Logger) *GoalHandler {
+	return &GoalHandler{
+		goalStore: goalStore,
+		logger:    logger,
+	}
+}
+
+func (gh *GoalHandler) validateGoalRequest(req *createGoalRequest) error {
+	switch req.GoalType {
+	case store.GoalTypeOneRepMax:
+		if req.ExerciseName == nil || strings.TrimSpace(*req.ExerciseName) == "" {
+			return errors.New("Exercise name is required for a one rep max goal")
+		}
+	case store.GoalTypeWeeklyWorkouts, store.GoalTypeMonthlyVolume, store.GoalTypeBodyweight:
+		req.ExerciseName = nil
+	case "":
+		return errors.New("Goal type is required")
+	default:
+		return fmt.Errorf("Unknown goal type %q", req.GoalType)
+	}
+
+	if req.TargetValue <= 0 {
+		return errors.New("Target value must be greater than zero")
+	}
+
+	if req.Deadline != nil && req.Deadline.Before(time.Now()) {
+		return errors.New("Deadline must be in the future")
+	}
+	return nil
+}
+
+func (gh *GoalHandler) HandleGetGoals(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	goals, err := gh.goalStore.GetGoalsByUser(r.Context(), currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get goals", err)
+		return
+	}
+
+	now := time.Now().In(currentUser.Location())
+	progress := make([]*store.GoalProgress, 0, len(goals))
+	for i := range goals {
+		goalProgress, err := gh.goalStore.GetGoalProgress(r.Context(), &goals[i], now)
+		if err != nil {
+			response.InternalServerError(w, fmt.Sprintf("Failed to compute progress for goal %d", goals[i].Id), err)
+			return
+		}
+		progress = append(progress, goalProgress)
+	}
+
+	response.Success(w, "Goals retrieved successfully", progress)
+}
+
+func (gh *GoalHandler) HandleCreateGoal(w http.ResponseWriter, r *http.Request) {
+	var goalReq createGoalRequest
+	err := json.NewDecoder(r.Body).Decode(&goalReq)
+	if err != nil {
+		response.BadRequest(w, "Failed to decode goal data", err)
+		return
+	}
+
+	err = gh.validateGoalRequest(&goalReq)
+	if err != nil {
+		response.BadRequest(w, "Invalid goal data", err)
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	goal := &store.Goal{
+		UserId:       currentUser.Id,
+		GoalType:     goalReq.GoalType,
+		ExerciseName: goalReq.ExerciseName,
+		TargetValue:  goalReq.TargetValue,
+		Deadline:     goalReq.Deadline,
+	}
+
+	createdGoal, err := gh.goalStore.CreateGoal(r.Context(), goal)
+	if err != nil {
+		response.InternalServerError(w, "Failed to create goal", err)
+		return
+	}
+
+	response.Created(w, "Goal successfully created", createdGoal)
+}
+
+func (gh *GoalHandler) HandleDeleteGoal(w http.ResponseWriter, r *http.Request) {
+	goalId, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		response.NotFound(w, "Invalid goal ID format")
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	goalOwner, err := gh.goalStore.GetGoalOwner(r.Context(), goalId)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to get goal owner for ID %d", goalId), err)
+		return
+	}
+	if goalOwner == 0 {
+		response.NotFound(w, fmt.Sprintf("Goal with ID %d not found", goalId))
+		return
+	}
+	if goalOwner != currentUser.Id {
+		response.Forbidden(w, fmt.Sprintf("User %d is not authorized to delete goal %d", currentUser.Id, goalId))
+		return
+	}
+
+	err = gh.goalStore.DeleteGoal(r.Context(), goalId)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to delete goal with ID %d", goalId), err)
+		return
+	}
+
+	response.Success(w, "Goal successfully deleted", map[string]int64{"goal_id": goalId})
+}
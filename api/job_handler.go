@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"workout-tracker/response"
+	"workout-tracker/store"
+)
+
+// Jobs are listed in pages of at most maxJobLimit.
+const (
+	defaultJobLimit = 50
+	maxJobLimit     = 500
+)
+
+type JobHandler struct {
+	jobStore store.JobStore
+	logger   *slog.Logger
+}
+
+func NewJobHandler(jobStore store.JobStore, logger *slog.Logger) *JobHandler {
+	return &JobHandler{
+		jobStore: jobStore,
+		logger:   logger,
+	}
+}
+
+// HandleGetJobs shows the queue: job counts by kind and status, or with
+// ?status= the latest jobs in that status, e.g. the dead letters.
+func (jh *JobHandler) HandleGetJobs(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		stats, err := jh.jobStore.GetJobStats(r.Context())
+		if err != nil {
+			response.InternalServerError(w, "Failed to get job statistics", err)
+			return
+		}
+		response.Success(w, "Job statistics retrieved successfully", stats)
+		return
+	}
+
+	switch status {
+	case store.JobPending, store.JobRunning, store.JobSucceeded, store.JobDead:
+	default:
+		response.BadRequest(w, "Invalid status", errors.New("status must be pending, running, succeeded or dead"))
+		return
+	}
+	limit := defaultJobLimit
+	if param := r.URL.Query().Get("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 1 {
+			response.BadRequest(w, "Invalid limit", errors.New("limit must be a positive number"))
+			return
+		}
+		limit = min(parsed, maxJobLimit)
+	}
+
+	jobs, err := jh.jobStore.GetJobs(r.Context(), status, limit)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get jobs", err)
+		return
+	}
+	response.Success(w, "Jobs retrieved successfully", jobs)
+}
+
+// HandleRetryJob requeues a dead job with a fresh set of attempts.
+func (jh *JobHandler) HandleRetryJob(w http.ResponseWriter, r *http.Request) {
+	jobId, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		response.NotFound(w, "Invalid job ID format")
+		return
+	}
+
+	requeued, err := jh.jobStore.RequeueJob(r.Context(), jobId)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to requeue job with ID %d", jobId), err)
+		return
+	}
+	if !requeued {
+		response.NotFound(w, fmt.Sprintf("Dead job with ID %d not found", jobId))
+		return
+	}
+
+	jh.logger.InfoContext(r.Context(), "requeued dead job", "job_id", jobId)
+	response.Success(w, "Job requeued", map[string]int64{"job_id": jobId})
+}
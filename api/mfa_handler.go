@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+	"workout-tracker/lockout"
+	"workout-tracker/metrics"
+	"workout-tracker/middleware"
+	"workout-tracker/response"
+	"workout-tracker/store"
+	"workout-tracker/totp"
+)
+
+// mfaIssuer names the account in authenticator apps.
+const mfaIssuer = "Workout Tracker"
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type MFAHandler struct {
+	loginGuard
+	mfaStore store.MFAStore
+	logger   *slog.Logger
+}
+
+func NewMFAHandler(mfaStore store.MFAStore, loginStore store.LoginStore, lockoutPolicy lockout.Policy, clientIP func(*http.Request) string, logger *slog.Logger) *MFAHandler {
+	return &MFAHandler{
+		loginGuard: loginGuard{loginStore: loginStore, lockout: lockoutPolicy, clientIP: clientIP, logger: logger},
+		mfaStore:   mfaStore,
+		logger:     logger,
+	}
+}
+
+// verifyMFACode accepts a current TOTP code, each at most once, or an
+// unused recovery code.
+func verifyMFACode(ctx context.Context, mfaStore store.MFAStore, mfa *store.MFA, code string) (bool, error) {
+	if step, ok := totp.Validate(mfa.Secret, code, time.Now()); ok {
+		return mfaStore.UseTOTPStep(ctx, mfa.UserId, step)
+	}
+	return mfaStore.UseRecoveryCode(ctx, mfa.UserId, totp.HashRecoveryCode(code))
+}
+
+// HandleEnrollTOTP starts enrollment with a new secret. Two-factor
+// authentication stays off until a code from it is verified.
+func (mh *MFAHandler) HandleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		response.InternalServerError(w, "Failed to generate secret", err)
+		return
+	}
+
+	err = mh.mfaStore.SavePendingMFA(r.Context(), currentUser.Id, secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		response.Error(w, http.StatusConflict, "Two-factor authentication is already enabled", err)
+		return
+	}
+	if err != nil {
+		response.InternalServerError(w, "Failed to start two-factor enrollment", err)
+		return
+	}
+
+	response.Created(w, "Scan the URI with an authenticator app and verify a code to finish", map[string]string{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(mfaIssuer, currentUser.UserName, secret),
+	})
+}
+
+// HandleVerifyTOTP activates a pending enrollment and returns the recovery
+// codes. They are only ever shown here.
+func (mh *MFAHandler) HandleVerifyTOTP(w http.ResponseWriter, r *http.Request) {
+	var codeReq mfaCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&codeReq)
+	if err != nil {
+		response.BadRequest(w, "Failed to decode code", err)
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	mfa, err := mh.mfaStore.GetMFA(r.Context(), currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get two-factor enrollment", err)
+		return
+	}
+	if mfa == nil {
+		response.NotFound(w, "No two-factor enrollment to verify")
+		return
+	}
+	if mfa.Enabled {
+		response.Error(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	step, ok := totp.Validate(mfa.Secret, codeReq.Code, time.Now())
+	if !ok {
+		response.BadRequest(w, "Invalid code", errors.New("The code does not match the enrolled secret"))
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		response.InternalServerError(w, "Failed to generate recovery codes", err)
+		return
+	}
+	hashes := make([][]byte, len(codes))
+	for i, code := range codes {
+		hashes[i] = totp.HashRecoveryCode(code)
+	}
+	err = mh.mfaStore.EnableMFA(r.Context(), currentUser.Id, step, hashes)
+	if err != nil {
+		response.InternalServerError(w, "Failed to enable two-factor authentication", err)
+		return
+	}
+
+	response.Success(w, "Two-factor authentication enabled, store the recovery codes somewhere safe", map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// HandleDisableTOTP turns two-factor authentication off, which requires a
+// current code or a recovery code. Wrong codes count toward the same
+// lockout as logins, so a stolen token cannot be used to guess them.
+func (mh *MFAHandler) HandleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var codeReq mfaCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&codeReq)
+	if err != nil {
+		response.BadRequest(w, "Failed to decode code", err)
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	mfa, err := mh.mfaStore.GetMFA(r.Context(), currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get two-factor enrollment", err)
+		return
+	}
+	if mfa == nil || !mfa.Enabled {
+		response.NotFound(w, "Two-factor authentication is not enabled")
+		return
+	}
+
+	attempt, failures, ok := mh.startAttempt(w, r, currentUser.UserName)
+	if !ok {
+		return
+	}
+
+	valid, err := verifyMFACode(r.Context(), mh.mfaStore, mfa, codeReq.Code)
+	if err != nil {
+		response.InternalServerError(w, "Failed to verify code", err)
+		return
+	}
+	if !valid {
+		mh.finishAttempt(r, attempt, currentUser, store.LoginWrongMFACode)
+		metrics.FailedLogins.WithLabelValues(store.LoginWrongMFACode).Inc()
+		mh.delay(r, failures.Count+1)
+		response.BadRequest(w, "Invalid code", errors.New("The code is wrong or was already used"))
+		return
+	}
+
+	err = mh.mfaStore.DisableMFA(r.Context(), currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to disable two-factor authentication", err)
+		return
+	}
+	mh.finishAttempt(r, attempt, currentUser, store.LoginMFAVerified)
+	response.Success(w, "Two-factor authentication disabled", nil)
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"workout-tracker/middleware"
+	"workout-tracker/response"
+	"workout-tracker/store"
+)
+
+// Notifications are listed in pages of at most maxNotificationLimit.
+const (
+	defaultNotificationLimit = 20
+	maxNotificationLimit     = 100
+)
+
+type NotificationHandler struct {
+	notificationStore store.NotificationStore
+	logger            *slog.Logger
+}
+
+func NewNotificationHandler(notificationStore store.NotificationStore, logger *slog.Logger) *NotificationHandler {
+	return &NotificationHandler{
+		notificationStore: notificationStore,
+		logger:            logger,
+	}
+}
+
+// HandleGetNotifications lists the user's in-app notifications, newest
+// first, with the number still unread. ?unread=true leaves out those
+// already read.
+func (nh *NotificationHandler) HandleGetNotifications(w http.ResponseWriter, r *http.Request) {
+	unreadOnly := false
+	if param := r.URL.Query().Get("unread"); param != "" {
+		parsed, err := strconv.ParseBool(param)
+		if err != nil {
+			response.BadRequest(w, "Invalid unread", errors.New("unread must be true or false"))
+			return
+		}
+		unreadOnly = parsed
+	}
+	limit := defaultNotificationLimit
+	if param := r.URL.Query().Get("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 1 {
+			response.BadRequest(w, "Invalid limit", errors.New("limit must be a positive number"))
+			return
+		}
+		limit = min(parsed, maxNotificationLimit)
+	}
+
+	currentUser := middleware.GetUser(r)
+	notifications, err := nh.notificationStore.GetNotifications(r.Context(), currentUser.Id, unreadOnly, limit)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get notifications", err)
+		return
+	}
+	unread, err := nh.notificationStore.CountUnread(r.Context(), currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to count unread notifications", err)
+		return
+	}
+
+	response.Success(w, "Notifications retrieved successfully", map[string]interface{}{
+		"unread":        unread,
+		"notifications": notifications,
+	})
+}
+
+func (nh *NotificationHandler) HandleMarkRead(w http.ResponseWriter, r *http.Request) {
+	notificationId, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		response.NotFound(w, "Invalid notification ID format")
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	found, err := nh.notificationStore.MarkRead(r.Context(), notificationId, currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to mark notification with ID %d read", notificationId), err)
+		return
+	}
+	if !found {
+		response.NotFound(w, fmt.Sprintf("Notification with ID %d not found", notificationId))
+		return
+	}
+
+	response.Success(w, "Notification marked read", map[string]int64{"notification_id": notificationId})
+}
+
+func (nh *NotificationHandler) HandleMarkAllRead(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	marked, err := nh.notificationStore.MarkAllRead(r.Context(), currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to mark notifications read", err)
+		return
+	}
+
+	response.Success(w, "Notifications marked read", map[string]int64{"marked": marked})
+}
@@ -0,0 +1,524 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"workout-tracker/metrics"
+	"workout-tracker/middleware"
+	"workout-tracker/response"
+	"workout-tracker/store"
+	"workout-tracker/tokens"
+)
+
+// scopeDescriptions are shown to users on the consent screen.
+var scopeDescriptions = map[string]string{
+	tokens.ScopeWorkoutsRead:  "Read your workouts",
+	tokens.ScopeWorkoutsWrite: "Create, change and delete your workouts",
+	tokens.ScopeAnalyticsRead: "Read your goals, calendar and progression suggestions",
+}
+
+type registerClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Confidential bool     `json:"confidential"`
+}
+
+// authorizationRequest carries the parameters of an authorization request,
+// read from the query string for the consent screen and from the body when
+// the user answers it.
+type authorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientId            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+// oauthError is an error response from RFC 6749, section 5.2.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+type OAuthHandler struct {
+	oauthStore      store.OAuthStore
+	codeTTL         time.Duration
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	logger          *slog.Logger
+}
+
+func NewOAuthHandler(oauthStore store.OAuthStore, codeTTL, accessTokenTTL, refreshTokenTTL time.Duration, logger *slog.Logger) *OAuthHandler {
+	return &OAuthHandler{
+		oauthStore:      oauthStore,
+		codeTTL:         codeTTL,
+		accessTokenTTL:  accessTokenTTL,
+		refreshTokenTTL: refreshTokenTTL,
+		logger:          logger,
+	}
+}
+
+// validRedirectURI requires absolute URIs without fragments, over HTTPS
+// unless they point at the loopback interface for local clients.
+func validRedirectURI(raw string) bool {
+	uri, err := url.Parse(raw)
+	if err != nil || uri.Host == "" || uri.Fragment != "" {
+		return false
+	}
+	switch uri.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := uri.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return false
+}
+
+// parseScopes splits a space separated scope parameter, rejecting unknown
+// and empty scopes.
+func parseScopes(scope string) ([]string, error) {
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, s := range strings.Fields(scope) {
+		if !tokens.ValidDelegatedScope(s) {
+			return nil, fmt.Errorf("Unknown scope %q", s)
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("At least one scope is required, choose from %s", strings.Join(tokens.DelegatedScopes, " "))
+	}
+	return scopes, nil
+}
+
+// redirectWith appends params to a registered redirect URI.
+func redirectWith(redirectURI string, params url.Values) string {
+	uri, _ := url.Parse(redirectURI)
+	query := uri.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	uri.RawQuery = query.Encode()
+	return uri.String()
+}
+
+func (oh *OAuthHandler) HandleRegisterClient(w http.ResponseWriter, r *http.Request) {
+	var clientReq registerClientRequest
+	err := json.NewDecoder(r.Body).Decode(&clientReq)
+	if err != nil {
+		response.BadRequest(w, "Failed to decode client data", err)
+		return
+	}
+
+	clientReq.Name = strings.TrimSpace(clientReq.Name)
+	if clientReq.Name == "" {
+		response.BadRequest(w, "Invalid client data", errors.New("Name is required"))
+		return
+	}
+	if len(clientReq.RedirectURIs) == 0 {
+		response.BadRequest(w, "Invalid client data", errors.New("At least one redirect URI is required"))
+		return
+	}
+	for _, uri := range clientReq.RedirectURIs {
+		if !validRedirectURI(uri) {
+			response.BadRequest(w, "Invalid client data", fmt.Errorf("Redirect URI %q must be an absolute HTTPS or loopback URI without a fragment", uri))
+			return
+		}
+	}
+
+	clientId, err := tokens.GenerateClientID()
+	if err != nil {
+		response.InternalServerError(w, "Failed to generate client ID", err)
+		return
+	}
+	currentUser := middleware.GetUser(r)
+	client := &store.OAuthClient{
+		Id:           clientId,
+		UserId:       currentUser.Id,
+		Name:         clientReq.Name,
+		RedirectURIs: clientReq.RedirectURIs,
+	}
+	var secret string
+	if clientReq.Confidential {
+		secret, err = tokens.GenerateSecret(tokens.ClientSecretPrefix)
+		if err != nil {
+			response.InternalServerError(w, "Failed to generate client secret", err)
+			return
+		}
+		client.SecretHash = tokens.HashSecret(secret)
+	}
+
+	err = oh.oauthStore.CreateClient(r.Context(), client)
+	if err != nil {
+		response.InternalServerError(w, "Failed to register client", err)
+		return
+	}
+
+	data := map[string]interface{}{"client": client}
+	if secret != "" {
+		data["client_secret"] = secret
+	}
+	response.Created(w, "Client registered, store the secret now as it will not be shown again", data)
+}
+
+// getAuthorizationClient looks up the client of an authorization request.
+// Problems with the client or redirect URI are returned as an *oauthError
+// and must not be redirected, unlike those found by parseAuthorization.
+func (oh *OAuthHandler) getAuthorizationClient(ctx context.Context, req *authorizationRequest) (*store.OAuthClient, error) {
+	client, err := oh.oauthStore.GetClient(ctx, req.ClientId)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, &oauthError{"invalid_client", "Unknown client"}
+	}
+	if !client.HasRedirectURI(req.RedirectURI) {
+		return nil, &oauthError{"invalid_request", "The redirect URI is not registered for this client"}
+	}
+	return client, nil
+}
+
+func parseAuthorization(req *authorizationRequest) ([]string, *oauthError) {
+	if req.ResponseType != "code" {
+		return nil, &oauthError{"unsupported_response_type", "Only the code response type is supported"}
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != tokens.PKCEMethodS256 {
+		return nil, &oauthError{"invalid_request", "A PKCE code challenge using S256 is required"}
+	}
+	scopes, err := parseScopes(req.Scope)
+	if err != nil {
+		return nil, &oauthError{"invalid_scope", err.Error()}
+	}
+	return scopes, nil
+}
+
+// HandleGetAuthorization returns what the consent screen shows: the client
+// asking for access and the scopes it wants.
+func (oh *OAuthHandler) HandleGetAuthorization(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := &authorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientId:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+
+	client, err := oh.getAuthorizationClient(r.Context(), req)
+	var clientErr *oauthError
+	if errors.As(err, &clientErr) {
+		response.BadRequest(w, "Invalid authorization request", clientErr)
+		return
+	}
+	if err != nil {
+		response.InternalServerError(w, "Failed to get client", err)
+		return
+	}
+	scopes, requestErr := parseAuthorization(req)
+	if requestErr != nil {
+		response.BadRequest(w, "Invalid authorization request", requestErr)
+		return
+	}
+
+	requested := make([]map[string]string, len(scopes))
+	for i, scope := range scopes {
+		requested[i] = map[string]string{"scope": scope, "description": scopeDescriptions[scope]}
+	}
+	response.Success(w, "Authorization requested", map[string]interface{}{
+		"client":       map[string]string{"client_id": client.Id, "name": client.Name},
+		"scopes":       requested,
+		"redirect_uri": req.RedirectURI,
+		"state":        req.State,
+	})
+}
+
+// HandleAuthorize records the user's answer on the consent screen. It
+// returns the URI to send the user back to the client with, carrying either
+// an authorization code or an error.
+func (oh *OAuthHandler) HandleAuthorize(w http.ResponseWriter, r *http.Request) {
+	var req authorizationRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		response.BadRequest(w, "Failed to decode authorization data", err)
+		return
+	}
+
+	_, err = oh.getAuthorizationClient(r.Context(), &req)
+	var clientErr *oauthError
+	if errors.As(err, &clientErr) {
+		response.BadRequest(w, "Invalid authorization request", clientErr)
+		return
+	}
+	if err != nil {
+		response.InternalServerError(w, "Failed to get client", err)
+		return
+	}
+
+	params := url.Values{}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	scopes, requestErr := parseAuthorization(&req)
+	if requestErr == nil && !req.Approve {
+		requestErr = &oauthError{"access_denied", "The user denied access"}
+	}
+	if requestErr != nil {
+		params.Set("error", requestErr.Code)
+		params.Set("error_description", requestErr.Description)
+		response.Success(w, "Authorization refused", map[string]string{"redirect_uri": redirectWith(req.RedirectURI, params)})
+		return
+	}
+
+	code, err := tokens.GenerateSecret(tokens.AuthorizationCodePrefix)
+	if err != nil {
+		response.InternalServerError(w, "Failed to generate authorization code", err)
+		return
+	}
+	currentUser := middleware.GetUser(r)
+	err = oh.oauthStore.CreateAuthorizationCode(r.Context(), &store.AuthorizationCode{
+		ClientId:      req.ClientId,
+		UserId:        currentUser.Id,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(oh.codeTTL),
+	}, tokens.HashSecret(code))
+	if err != nil {
+		response.InternalServerError(w, "Failed to create authorization code", err)
+		return
+	}
+
+	params.Set("code", code)
+	response.Success(w, "Authorization granted", map[string]string{"redirect_uri": redirectWith(req.RedirectURI, params)})
+}
+
+// tokenError answers the token, revocation and introspection endpoints in
+// the format of RFC 6749 rather than the API's usual envelope.
+func tokenError(w http.ResponseWriter, err *oauthError) {
+	status := http.StatusBadRequest
+	if err.Code == "invalid_client" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		status = http.StatusUnauthorized
+	}
+	response.JSON(w, status, err)
+}
+
+// authenticateClient parses the form and identifies the client from HTTP
+// Basic credentials or the client_id and client_secret fields.
+// Confidential clients must present their secret. When it returns false,
+// the error has been sent.
+func (oh *OAuthHandler) authenticateClient(w http.ResponseWriter, r *http.Request) (*store.OAuthClient, bool) {
+	err := r.ParseForm()
+	if err != nil {
+		tokenError(w, &oauthError{"invalid_request", "The request body must be form encoded"})
+		return nil, false
+	}
+	clientId, secret, ok := r.BasicAuth()
+	if !ok {
+		clientId = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	if clientId == "" {
+		tokenError(w, &oauthError{"invalid_client", "Client authentication is required"})
+		return nil, false
+	}
+	client, err := oh.oauthStore.GetClient(r.Context(), clientId)
+	if err != nil {
+		response.InternalServerError(w, "Failed to authenticate client", err)
+		return nil, false
+	}
+	if client == nil {
+		tokenError(w, &oauthError{"invalid_client", "Unknown client"})
+		return nil, false
+	}
+	if client.Confidential() && subtle.ConstantTimeCompare(client.SecretHash, tokens.HashSecret(secret)) != 1 {
+		tokenError(w, &oauthError{"invalid_client", "Invalid client secret"})
+		return nil, false
+	}
+	return client, true
+}
+
+// issueTokens creates an access and refresh token pair within a grant.
+func (oh *OAuthHandler) issueTokens(ctx context.Context, grantId, clientId string, userId int, scopes []string) (map[string]interface{}, error) {
+	accessToken, err := tokens.GenerateSecret(tokens.AccessTokenPrefix)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := tokens.GenerateSecret(tokens.RefreshTokenPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	token := func(kind string, ttl time.Duration) *store.OAuthToken {
+		return &store.OAuthToken{
+			GrantId:   grantId,
+			Kind:      kind,
+			ClientId:  clientId,
+			UserId:    userId,
+			Scopes:    scopes,
+			ExpiresAt: now.Add(ttl),
+		}
+	}
+	err = oh.oauthStore.CreateOAuthTokens(ctx,
+		[]*store.OAuthToken{token(store.OAuthAccessToken, oh.accessTokenTTL), token(store.OAuthRefreshToken, oh.refreshTokenTTL)},
+		[][]byte{tokens.HashSecret(accessToken), tokens.HashSecret(refreshToken)})
+	if err != nil {
+		return nil, err
+	}
+	metrics.TokensIssued.WithLabelValues("oauth").Inc()
+
+	return map[string]interface{}{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(oh.accessTokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+		"scope":         strings.Join(scopes, " "),
+	}, nil
+}
+
+// HandleToken is the token endpoint. It exchanges authorization codes and
+// refresh tokens for new tokens.
+func (oh *OAuthHandler) HandleToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	client, ok := oh.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	var grantId string
+	var userId int
+	var scopes []string
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, err := oh.oauthStore.ConsumeAuthorizationCode(r.Context(), tokens.HashSecret(r.PostForm.Get("code")), client.Id)
+		if err != nil {
+			response.InternalServerError(w, "Failed to check authorization code", err)
+			return
+		}
+		if code == nil || code.RedirectURI != r.PostForm.Get("redirect_uri") {
+			tokenError(w, &oauthError{"invalid_grant", "The authorization code is invalid, expired or was issued to another client"})
+			return
+		}
+		if !tokens.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+			tokenError(w, &oauthError{"invalid_grant", "The code verifier does not match the code challenge"})
+			return
+		}
+		grantId, err = tokens.GenerateGrantID()
+		if err != nil {
+			response.InternalServerError(w, "Failed to generate grant ID", err)
+			return
+		}
+		userId, scopes = code.UserId, code.Scopes
+
+	case "refresh_token":
+		refreshed, err := oh.oauthStore.ConsumeRefreshToken(r.Context(), tokens.HashSecret(r.PostForm.Get("refresh_token")), client.Id)
+		if err != nil {
+			response.InternalServerError(w, "Failed to check refresh token", err)
+			return
+		}
+		if refreshed == nil {
+			tokenError(w, &oauthError{"invalid_grant", "The refresh token is invalid, expired or was issued to another client"})
+			return
+		}
+		grantId, userId, scopes = refreshed.GrantId, refreshed.UserId, refreshed.Scopes
+		// A refresh may narrow the scopes, but never widen them
+		if requested := r.PostForm.Get("scope"); requested != "" {
+			narrowed, err := parseScopes(requested)
+			if err != nil {
+				tokenError(w, &oauthError{"invalid_scope", err.Error()})
+				return
+			}
+			for _, scope := range narrowed {
+				if !refreshed.HasScope(scope) {
+					tokenError(w, &oauthError{"invalid_scope", fmt.Sprintf("Scope %q was not granted", scope)})
+					return
+				}
+			}
+			scopes = narrowed
+		}
+
+	default:
+		tokenError(w, &oauthError{"unsupported_grant_type", "Only authorization_code and refresh_token grants are supported"})
+		return
+	}
+
+	issued, err := oh.issueTokens(r.Context(), grantId, client.Id, userId, scopes)
+	if err != nil {
+		response.InternalServerError(w, "Failed to issue tokens", err)
+		return
+	}
+	response.JSON(w, http.StatusOK, issued)
+}
+
+// HandleRevoke revokes a token and every token of the same grant, following
+// RFC 7009. Unknown tokens are not an error.
+func (oh *OAuthHandler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	client, ok := oh.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	err := oh.oauthStore.RevokeGrant(r.Context(), tokens.HashSecret(r.PostForm.Get("token")), client.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to revoke token", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleIntrospect describes a token to the client it was issued to,
+// following RFC 7662. Tokens of other clients are reported as inactive.
+// token_type is the standard Bearer; token_kind says whether it is an
+// access or a refresh token.
+func (oh *OAuthHandler) HandleIntrospect(w http.ResponseWriter, r *http.Request) {
+	client, ok := oh.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := oh.oauthStore.GetOAuthToken(r.Context(), tokens.HashSecret(r.PostForm.Get("token")))
+	if err != nil {
+		response.InternalServerError(w, "Failed to get token", err)
+		return
+	}
+	if token == nil || token.ClientId != client.Id {
+		response.JSON(w, http.StatusOK, map[string]bool{"active": false})
+		return
+	}
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"active":     true,
+		"scope":      strings.Join(token.Scopes, " "),
+		"client_id":  token.ClientId,
+		"sub":        strconv.Itoa(token.UserId),
+		"exp":        token.ExpiresAt.Unix(),
+		"token_type": "Bearer",
+		"token_kind": token.Kind,
+	})
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+	"workout-tracker/middleware"
+	"workout-tracker/oidc"
+	"workout-tracker/response"
+	"workout-tracker/store"
+	"workout-tracker/tokens"
+)
+
+// oidcStateCookie binds a login to the browser that started it, so a
+// callback cannot be replayed in another browser to log it in.
+const oidcStateCookie = "oidc_state"
+
+// oidcLoginTTL is how long the user has to log in with the provider.
+const oidcLoginTTL = 10 * time.Minute
+
+type OIDCHandler struct {
+	providers     map[string]*oidc.Provider
+	identityStore store.IdentityStore
+	completeLogin func(http.ResponseWriter, *http.Request, *store.User)
+	logger        *slog.Logger
+}
+
+func NewOIDCHandler(providers []*oidc.Provider, identityStore store.IdentityStore, completeLogin func(http.ResponseWriter, *http.Request, *store.User), logger *slog.Logger) *OIDCHandler {
+	byName := make(map[string]*oidc.Provider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+	return &OIDCHandler{
+		providers:     byName,
+		identityStore: identityStore,
+		completeLogin: completeLogin,
+		logger:        logger,
+	}
+}
+
+func (oh *OIDCHandler) HandleGetProviders(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(oh.providers))
+	for name := range oh.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	response.Success(w, "Identity providers retrieved successfully", names)
+}
+
+// HandleStartLogin redirects the user to the provider to log in.
+func (oh *OIDCHandler) HandleStartLogin(w http.ResponseWriter, r *http.Request) {
+	authURL, ok := oh.start(w, r, nil)
+	if !ok {
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleStartLink starts linking an identity at the provider to the
+// current user's account, after which the user can log in with it. The
+// browser continues at the returned authorization URL.
+func (oh *OIDCHandler) HandleStartLink(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	authURL, ok := oh.start(w, r, &currentUser.Id)
+	if !ok {
+		return
+	}
+	response.Success(w, "Continue at the identity provider to link the identity", map[string]string{"authorization_url": authURL})
+}
+
+// start saves a login with the provider named in the URL and binds it to
+// the browser with the state cookie. It returns the provider URL to send
+// the user to, or answers the request itself and returns false.
+func (oh *OIDCHandler) start(w http.ResponseWriter, r *http.Request, userId *int) (string, bool) {
+	provider, ok := oh.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		response.NotFound(w, "Unknown identity provider")
+		return "", false
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		secret, err := tokens.GenerateSecret("")
+		if err != nil {
+			response.InternalServerError(w, "Failed to start login", err)
+			return "", false
+		}
+		secrets[i] = secret
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, tokens.CodeChallenge(verifier))
+	if err != nil {
+		response.Error(w, http.StatusBadGateway, "The identity provider is unavailable", err)
+		return "", false
+	}
+	err = oh.identityStore.SaveOIDCLogin(r.Context(), &store.OIDCLogin{
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserId:       userId,
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+	}, tokens.HashSecret(state))
+	if err != nil {
+		response.InternalServerError(w, "Failed to start login", err)
+		return "", false
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return authURL, true
+}
+
+// HandleCallback finishes a login or link when the provider redirects
+// back. A login needs an identity the user linked before; accounts are
+// never matched by email, since local emails are not verified and anyone
+// could register with someone else's.
+func (oh *OIDCHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oh.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		response.NotFound(w, "Unknown identity provider")
+		return
+	}
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		response.Unauthorized(w, "The identity provider refused the login: "+providerErr)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		response.BadRequest(w, "Invalid login state", errors.New("The login was not started in this browser"))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", MaxAge: -1})
+
+	login, err := oh.identityStore.ConsumeOIDCLogin(r.Context(), tokens.HashSecret(state))
+	if err != nil {
+		response.InternalServerError(w, "Failed to look up login", err)
+		return
+	}
+	if login == nil || login.Provider != provider.Name() {
+		response.BadRequest(w, "Invalid login state", errors.New("The login expired or was already used, please start again"))
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(r.Context(), query.Get("code"), login.CodeVerifier)
+	if err != nil {
+		response.Error(w, http.StatusBadGateway, "Failed to complete the login with the identity provider", err)
+		return
+	}
+	claims, err := provider.VerifyIDToken(r.Context(), rawIDToken, login.Nonce)
+	if err != nil {
+		oh.logger.WarnContext(r.Context(), "rejected ID token", "provider", provider.Name(), "error", err)
+		response.Unauthorized(w, "The identity provider's response could not be verified")
+		return
+	}
+
+	user, err := oh.identityStore.GetUserByIdentity(r.Context(), provider.Name(), claims.Subject)
+	if err != nil {
+		response.InternalServerError(w, "Failed to look up identity", err)
+		return
+	}
+	if login.UserId != nil {
+		oh.link(w, r, provider.Name(), claims.Subject, claims.Email, *login.UserId, user)
+		return
+	}
+	if user == nil {
+		response.Forbidden(w, "No account is linked to this identity, log in and link it first")
+		return
+	}
+
+	oh.completeLogin(w, r, user)
+}
+
+// link links the identity to the account that asked for it, unless it is
+// linked to another account already.
+func (oh *OIDCHandler) link(w http.ResponseWriter, r *http.Request, provider, subject, email string, userId int, linked *store.User) {
+	if linked != nil && linked.Id != userId {
+		response.Error(w, http.StatusConflict, "This identity is linked to another account", nil)
+		return
+	}
+	if linked == nil {
+		err := oh.identityStore.LinkIdentity(r.Context(), userId, provider, subject, email)
+		if err != nil {
+			response.InternalServerError(w, "Failed to link identity", err)
+			return
+		}
+		oh.logger.InfoContext(r.Context(), "linked identity", "provider", provider, "user_id", userId)
+	}
+	response.Success(w, "Identity linked successfully", map[string]string{"provider": provider})
+}
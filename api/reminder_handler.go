@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"workout-tracker/middleware"
+	"workout-tracker/notify"
+	"workout-tracker/reminders"
+	"workout-tracker/response"
+	"workout-tracker/store"
+)
+
+// maxReminderName keeps reminder names short enough for an email subject.
+const maxReminderName = 100
+
+type reminderRequest struct {
+	Name         string   `json:"name"`
+	Kind         string   `json:"kind"`
+	Days         []string `json:"days"`
+	TimeOfDay    string   `json:"time_of_day"`
+	Timezone     string   `json:"timezone"`
+	InactiveDays int      `json:"inactive_days"`
+	Channels     []string `json:"channels"`
+}
+
+type ReminderHandler struct {
+	reminderStore store.ReminderStore
+	channels      []string
+	logger        *slog.Logger
+}
+
+// NewReminderHandler takes the notification channels reminders may use,
+// those the server has notifiers for.
+func NewReminderHandler(reminderStore store.ReminderStore, channels []string, logger *slog.Logger) *ReminderHandler {
+	return &ReminderHandler{
+		reminderStore: reminderStore,
+		channels:      channels,
+		logger:        logger,
+	}
+}
+
+func (rh *ReminderHandler) validChannel(channel string) bool {
+	for _, known := range rh.channels {
+		if known == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// newReminder validates the request into a reminder of the user.
+func (rh *ReminderHandler) newReminder(req *reminderRequest, user *store.User) (*store.Reminder, error) {
+	if strings.TrimSpace(req.Name) == "" || len(req.Name) > maxReminderName {
+		return nil, fmt.Errorf("Name is required and may be at most %d characters", maxReminderName)
+	}
+	if strings.IndexFunc(req.Name, unicode.IsControl) >= 0 {
+		return nil, errors.New("Name must not contain control characters")
+	}
+
+	reminder := &store.Reminder{
+		UserId:    user.Id,
+		Name:      req.Name,
+		Kind:      req.Kind,
+		TimeOfDay: req.TimeOfDay,
+		Timezone:  req.Timezone,
+		Channels:  req.Channels,
+		Active:    true,
+	}
+	switch req.Kind {
+	case store.ReminderSchedule:
+		if len(req.Days) == 0 {
+			return nil, errors.New("Schedule reminders need days, e.g. [\"mon\", \"wed\", \"fri\"]")
+		}
+		for _, day := range req.Days {
+			if _, ok := reminders.Weekdays[day]; !ok {
+				return nil, fmt.Errorf("Unknown day %q, use sun, mon, tue, wed, thu, fri or sat", day)
+			}
+		}
+		reminder.Days = req.Days
+	case store.ReminderInactivity:
+		if req.InactiveDays < 1 {
+			return nil, errors.New("Inactivity reminders need inactive_days of at least 1")
+		}
+		reminder.InactiveDays = req.InactiveDays
+	default:
+		return nil, errors.New("Kind must be schedule or inactivity")
+	}
+
+	_, _, err := reminders.ParseTimeOfDay(req.TimeOfDay)
+	if err != nil {
+		return nil, err
+	}
+	// Reminders keep the timezone they were made in, so that moving the
+	// profile to another timezone does not move existing reminders
+	if reminder.Timezone == "" {
+		reminder.Timezone = user.Location().String()
+	}
+	_, err = time.LoadLocation(reminder.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown timezone %q", reminder.Timezone)
+	}
+
+	if len(reminder.Channels) == 0 {
+		reminder.Channels = []string{notify.ChannelInApp}
+	}
+	for _, channel := range reminder.Channels {
+		if !rh.validChannel(channel) {
+			return nil, fmt.Errorf("Unknown channel %q, choose from %s", channel, strings.Join(rh.channels, ", "))
+		}
+	}
+	return reminder, nil
+}
+
+func (rh *ReminderHandler) HandleGetReminders(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	userReminders, err := rh.reminderStore.GetRemindersByUser(r.Context(), currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get reminders", err)
+		return
+	}
+
+	response.Success(w, "Reminders retrieved successfully", userReminders)
+}
+
+func (rh *ReminderHandler) HandleCreateReminder(w http.ResponseWriter, r *http.Request) {
+	var reminderReq reminderRequest
+	err := json.NewDecoder(r.Body).Decode(&reminderReq)
+	if err != nil {
+		response.BadRequest(w, "Failed to decode reminder data", err)
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	reminder, err := rh.newReminder(&reminderReq, currentUser)
+	if err != nil {
+		response.BadRequest(w, "Invalid reminder data", err)
+		return
+	}
+	reminder.NextRunAt, err = reminders.NextRun(reminder, time.Now())
+	if err != nil {
+		response.BadRequest(w, "Invalid reminder data", err)
+		return
+	}
+
+	err = rh.reminderStore.CreateReminder(r.Context(), reminder)
+	if err != nil {
+		response.InternalServerError(w, "Failed to create reminder", err)
+		return
+	}
+
+	response.Created(w, "Reminder created successfully", reminder)
+}
+
+func (rh *ReminderHandler) HandleDeleteReminder(w http.ResponseWriter, r *http.Request) {
+	reminderId, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		response.NotFound(w, "Invalid reminder ID format")
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	deleted, err := rh.reminderStore.DeleteReminder(r.Context(), reminderId, currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to delete reminder with ID %d", reminderId), err)
+		return
+	}
+	if !deleted {
+		response.NotFound(w, fmt.Sprintf("Reminder with ID %d not found", reminderId))
+		return
+	}
+
+	response.Success(w, "Reminder deleted", map[string]int64{"reminder_id": reminderId})
+}
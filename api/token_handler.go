@@ -2,19 +2,39 @@ package api
 
 import (
 	"encoding/json"
-	"errors"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
+	"workout-tracker/lockout"
+	"workout-tracker/metrics"
 	"workout-tracker/response"
 	"workout-tracker/store"
 	"workout-tracker/tokens"
 )
 
+// invalidCredentials is the answer to every failed login, so responses do
+// not reveal whether a username exists.
+const invalidCredentials = "Invalid username or password"
+
+// loginGuard checks logins and other second-factor checks against the
+// lockout, and records their attempts.
+type loginGuard struct {
+	loginStore store.LoginStore
+	lockout    lockout.Policy
+	clientIP   func(*http.Request) string
+	logger     *slog.Logger
+}
+
 type TokenHandler struct {
-	tokenStore store.TokenStore
-	userStore  store.UserStore
-	logger     *log.Logger
+	loginGuard
+	tokenStore  store.TokenStore
+	userStore   store.UserStore
+	mfaStore    store.MFAStore
+	tokenTTL    time.Duration
+	mfaTokenTTL time.Duration
+	logger      *slog.Logger
 }
 
 type createTokenRequest struct {
@@ -22,43 +42,227 @@ type createTokenRequest struct {
 	Password string `json:"password"`
 }
 
-func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, logger *log.Logger) *TokenHandler {
+type exchangeMFATokenRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, loginStore store.LoginStore, mfaStore store.MFAStore, lockoutPolicy lockout.Policy, clientIP func(*http.Request) string, tokenTTL, mfaTokenTTL time.Duration, logger *slog.Logger) *TokenHandler {
 	return &TokenHandler{
-		tokenStore: tokenStore,
-		userStore:  userStore,
-		logger:     logger,
+		loginGuard:  loginGuard{loginStore: loginStore, lockout: lockoutPolicy, clientIP: clientIP, logger: logger},
+		tokenStore:  tokenStore,
+		userStore:   userStore,
+		mfaStore:    mfaStore,
+		tokenTTL:    tokenTTL,
+		mfaTokenTTL: mfaTokenTTL,
+		logger:      logger,
 	}
 }
 
+func (lg *loginGuard) newAttempt(r *http.Request, username string, user *store.User, outcome string) *store.LoginAttempt {
+	attempt := &store.LoginAttempt{
+		Username:  username,
+		Outcome:   outcome,
+		IPAddress: lg.clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	if user != nil {
+		attempt.UserId = &user.Id
+	}
+	return attempt
+}
+
+// recordAttempt writes a login that was not checked against the lockout to
+// the audit log. A failure to do so is logged but does not fail the login.
+func (lg *loginGuard) recordAttempt(r *http.Request, username string, user *store.User, outcome string) {
+	err := lg.loginStore.RecordLoginAttempt(r.Context(), lg.newAttempt(r, username, user, outcome))
+	if err != nil {
+		lg.logger.ErrorContext(r.Context(), "failed to record login attempt", "outcome", outcome, "error", err)
+	}
+}
+
+// finishAttempt records the outcome of an attempt startAttempt started. A
+// failure to do so is logged, and leaves the attempt counted as a failure.
+func (lg *loginGuard) finishAttempt(r *http.Request, attempt *store.LoginAttempt, user *store.User, outcome string) {
+	attempt.Outcome = outcome
+	if user != nil {
+		attempt.UserId = &user.Id
+	}
+	err := lg.loginStore.FinishLoginAttempt(r.Context(), attempt)
+	if err != nil {
+		lg.logger.ErrorContext(r.Context(), "failed to record login attempt", "outcome", outcome, "error", err)
+	}
+}
+
+// delay slows down a failed login, giving up early if the client leaves.
+func (lg *loginGuard) delay(r *http.Request, failures int) {
+	select {
+	case <-time.After(lg.lockout.Delay(failures)):
+	case <-r.Context().Done():
+	}
+}
+
+// startAttempt starts a login attempt for username, which counts as a
+// failure until it is finished, so that concurrent logins cannot all get
+// past the lockout. While the username is locked out it answers with 429
+// Too Many Requests and returns false. Otherwise it returns the attempt
+// and the failures before it, which set the delay if it fails too.
+func (lg *loginGuard) startAttempt(w http.ResponseWriter, r *http.Request, username string) (*store.LoginAttempt, *store.LoginFailures, bool) {
+	now := time.Now()
+	attempt := lg.newAttempt(r, username, nil, store.LoginPending)
+	failures, err := lg.loginStore.StartLoginAttempt(r.Context(), attempt, now.Add(-lg.lockout.Window), lg.lockout.MaxFailures)
+	if err != nil {
+		response.InternalServerError(w, "Failed to check login attempts", err)
+		return nil, nil, false
+	}
+	if attempt.Outcome == store.LoginLocked {
+		metrics.FailedLogins.WithLabelValues(store.LoginLocked).Inc()
+		retryAfter := lg.lockout.LockedUntil(failures.Times).Sub(now)
+		w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(retryAfter.Seconds())), 1)))
+		response.TooManyRequests(w, "Too many failed login attempts, please try again later")
+		return nil, nil, false
+	}
+	return attempt, failures, true
+}
+
+func (th *TokenHandler) issueToken(w http.ResponseWriter, r *http.Request, user *store.User) {
+	token, err := th.tokenStore.CreateNewToken(r.Context(), user.Id, th.tokenTTL, tokens.ScopeAuth)
+	if err != nil {
+		response.InternalServerError(w, "Failed to create token", err)
+		return
+	}
+	metrics.TokensIssued.WithLabelValues(tokens.ScopeAuth).Inc()
+	response.Success(w, "Token created successfully", map[string]string{"token": token.PlainText})
+}
+
 func (th *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request) {
 	var tokenReq createTokenRequest
 	err := json.NewDecoder(r.Body).Decode(&tokenReq)
 	if err != nil {
 		response.BadRequest(w, "Failed to decode token data", err)
+		return
+	}
+
+	attempt, failures, ok := th.startAttempt(w, r, tokenReq.Username)
+	if !ok {
+		return
 	}
 
-	user, err := th.userStore.GetUserByName(tokenReq.Username)
-	if err != nil || user == nil {
-		if err == nil {
-			err = errors.New("user not found")
+	user, err := th.userStore.GetUserByName(r.Context(), tokenReq.Username)
+	if err != nil {
+		response.InternalServerError(w, "Failed to look up user", err)
+		return
+	}
+
+	// Check a password even for unknown users so both failures take as long
+	passwordMatch := false
+	outcome := store.LoginUnknownUser
+	if user == nil {
+		store.CheckDummyPassword(tokenReq.Password)
+	} else {
+		outcome = store.LoginWrongPassword
+		passwordMatch, err = user.PasswordHash.Check(tokenReq.Password)
+		if err != nil {
+			response.InternalServerError(w, "Failed to check password", err)
+			return
 		}
-		response.InternalServerError(w, "Invalid username", err)
+	}
+	if !passwordMatch {
+		th.finishAttempt(r, attempt, user, outcome)
+		metrics.FailedLogins.WithLabelValues(outcome).Inc()
+		th.delay(r, failures.Count+1)
+		response.Unauthorized(w, invalidCredentials)
 		return
 	}
+	th.completeLogin(w, r, user, func(outcome string) { th.finishAttempt(r, attempt, user, outcome) })
+}
+
+// CompleteLogin answers a login whose first factor was verified, by
+// password or an external identity provider. Users with two-factor
+// authentication get an mfa-pending token, everyone else a token.
+func (th *TokenHandler) CompleteLogin(w http.ResponseWriter, r *http.Request, user *store.User) {
+	th.completeLogin(w, r, user, func(outcome string) { th.recordAttempt(r, user.UserName, user, outcome) })
+}
 
-	passwordMatch, err := user.PasswordHash.Check(tokenReq.Password)
-	if err != nil || !passwordMatch {
-		if err == nil {
-			err = errors.New("password does not match")
+// completeLogin answers the login and hands its outcome to record.
+func (th *TokenHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *store.User, record func(outcome string)) {
+	mfa, err := th.mfaStore.GetMFA(r.Context(), user.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to check two-factor authentication", err)
+		return
+	}
+	if mfa != nil && mfa.Enabled {
+		// The login only succeeds once the second factor is verified, so
+		// failed codes keep counting towards the lockout.
+		record(store.LoginMFARequired)
+		token, err := th.tokenStore.CreateNewToken(r.Context(), user.Id, th.mfaTokenTTL, tokens.ScopeMFAPending)
+		if err != nil {
+			response.InternalServerError(w, "Failed to create token", err)
+			return
 		}
-		response.InternalServerError(w, "Invalid password", err)
+		metrics.TokensIssued.WithLabelValues(tokens.ScopeMFAPending).Inc()
+		response.Success(w, "Two-factor authentication code required", map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    token.PlainText,
+		})
 		return
 	}
 
-	token, err := th.tokenStore.CreateNewToken(user.Id, 24*time.Hour, tokens.ScopeAuth)
+	record(store.LoginSucceeded)
+	th.issueToken(w, r, user)
+}
+
+// HandleExchangeMFAToken completes a two-step login, trading the
+// mfa-pending token and a TOTP or recovery code for an authentication token.
+func (th *TokenHandler) HandleExchangeMFAToken(w http.ResponseWriter, r *http.Request) {
+	var exchangeReq exchangeMFATokenRequest
+	err := json.NewDecoder(r.Body).Decode(&exchangeReq)
 	if err != nil {
-		response.InternalServerError(w, "Failed to create token", err)
+		response.BadRequest(w, "Failed to decode two-factor data", err)
 		return
 	}
-	response.Success(w, "Token created successfully", map[string]string{"token": token.PlainText})
+
+	user, err := th.userStore.GetUserToken(r.Context(), tokens.ScopeMFAPending, exchangeReq.MFAToken)
+	if err != nil {
+		response.InternalServerError(w, "Failed to check token", err)
+		return
+	}
+	if user == nil {
+		response.Unauthorized(w, "Invalid or expired two-factor token")
+		return
+	}
+
+	attempt, failures, ok := th.startAttempt(w, r, user.UserName)
+	if !ok {
+		return
+	}
+
+	mfa, err := th.mfaStore.GetMFA(r.Context(), user.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to check two-factor authentication", err)
+		return
+	}
+	valid := false
+	if mfa != nil && mfa.Enabled {
+		valid, err = verifyMFACode(r.Context(), th.mfaStore, mfa, exchangeReq.Code)
+		if err != nil {
+			response.InternalServerError(w, "Failed to verify code", err)
+			return
+		}
+	}
+	if !valid {
+		th.finishAttempt(r, attempt, user, store.LoginWrongMFACode)
+		metrics.FailedLogins.WithLabelValues(store.LoginWrongMFACode).Inc()
+		th.delay(r, failures.Count+1)
+		response.Unauthorized(w, "Invalid two-factor code")
+		return
+	}
+
+	err = th.tokenStore.DeleteAllTokens(r.Context(), user.Id, tokens.ScopeMFAPending)
+	if err != nil {
+		response.InternalServerError(w, "Failed to revoke two-factor token", err)
+		return
+	}
+	th.finishAttempt(r, attempt, user, store.LoginSucceeded)
+	th.issueToken(w, r, user)
 }
@@ -3,9 +3,11 @@ package api
 import (
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
+	"time"
+	"workout-tracker/middleware"
 	"workout-tracker/response"
 	"workout-tracker/store"
 )
@@ -15,14 +17,25 @@ type registerUserRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	Bio      string `json:"bio"`
+	Timezone string `json:"timezone"`
+}
+
+// updateUserRequest changes only the fields it carries.
+type updateUserRequest struct {
+	Bio      *string `json:"bio"`
+	Timezone *string `json:"timezone"`
+}
+
+type logBodyweightRequest struct {
+	Weight float64 `json:"weight"`
 }
 
 type UserHandler struct {
 	userStore store.UserStore
-	logger    *log.Logger
+	logger    *slog.Logger
 }
 
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore, logger *slog.Logger) *UserHandler {
 	return &UserHandler{
 		userStore: userStore,
 		logger:    logger,
@@ -50,6 +63,18 @@ func (uh *UserHandler) validateUserRequest(req *registerUserRequest) error {
 	if !emailRegex.MatchString(req.Email) {
 		return errors.New("Invalid email format")
 	}
+
+	if req.Timezone != "" {
+		return validateTimezone(req.Timezone)
+	}
+	return nil
+}
+
+// validateTimezone accepts IANA time zone names such as "Europe/Berlin".
+func validateTimezone(timezone string) error {
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return errors.New("Invalid timezone")
+	}
 	return nil
 }
 
@@ -58,16 +83,19 @@ func (uh *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request
 	err := json.NewDecoder(r.Body).Decode(&userReq)
 	if err != nil {
 		response.BadRequest(w, "Failed to decode user data", err)
+		return
 	}
 
 	err = uh.validateUserRequest(&userReq)
 	if err != nil {
 		response.BadRequest(w, "Invalid user data", err)
+		return
 	}
 	user := &store.User{
 		UserName: userReq.UserName,
 		Email:    userReq.Email,
 		Bio:      userReq.Bio,
+		Timezone: userReq.Timezone,
 	}
 
 	if userReq.Bio == "" {
@@ -79,10 +107,69 @@ func (uh *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request
 		response.InternalServerError(w, "Failed hashing password", err)
 		return
 	}
-	err = uh.userStore.CreateUser(user)
+	err = uh.userStore.CreateUser(r.Context(), user)
 	if err != nil {
 		response.InternalServerError(w, "Failed to create user", err)
 		return
 	}
 	response.UserCreated(w, user)
 }
+
+func (uh *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	var userReq updateUserRequest
+	err := json.NewDecoder(r.Body).Decode(&userReq)
+	if err != nil {
+		response.BadRequest(w, "Failed to decode user data", err)
+		return
+	}
+
+	user := *middleware.GetUser(r)
+	if userReq.Bio != nil {
+		user.Bio = *userReq.Bio
+	}
+	if userReq.Timezone != nil {
+		if *userReq.Timezone == "" {
+			response.BadRequest(w, "Invalid user data", errors.New("Timezone must not be empty"))
+			return
+		}
+		err = validateTimezone(*userReq.Timezone)
+		if err != nil {
+			response.BadRequest(w, "Invalid user data", err)
+			return
+		}
+		user.Timezone = *userReq.Timezone
+	}
+
+	err = uh.userStore.UpdateUser(r.Context(), &user)
+	if err != nil {
+		response.InternalServerError(w, "Failed to update user", err)
+		return
+	}
+	response.UserUpdated(w, &user)
+}
+
+func (uh *UserHandler) HandleLogBodyweight(w http.ResponseWriter, r *http.Request) {
+	var bodyweightReq logBodyweightRequest
+	err := json.NewDecoder(r.Body).Decode(&bodyweightReq)
+	if err != nil {
+		response.BadRequest(w, "Failed to decode bodyweight data", err)
+		return
+	}
+
+	if bodyweightReq.Weight <= 0 || bodyweightReq.Weight >= 1000 {
+		response.BadRequest(w, "Invalid bodyweight data", errors.New("Weight must be between 0 and 1000"))
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	entry := &store.BodyweightEntry{
+		UserId: currentUser.Id,
+		Weight: bodyweightReq.Weight,
+	}
+	err = uh.userStore.CreateBodyweightEntry(r.Context(), entry)
+	if err != nil {
+		response.InternalServerError(w, "Failed to log bodyweight", err)
+		return
+	}
+	response.Created(w, "Bodyweight successfully logged", entry)
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"workout-tracker/middleware"
+	"workout-tracker/response"
+	"workout-tracker/store"
+	"workout-tracker/tokens"
+	"workout-tracker/webhooks"
+)
+
+// Delivery logs are listed in pages of at most maxDeliveryLimit.
+const (
+	defaultDeliveryLimit = 20
+	maxDeliveryLimit     = 100
+)
+
+type webhookRequest struct {
+	URL    *string  `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+type WebhookHandler struct {
+	webhookStore store.WebhookStore
+	worker       *webhooks.Worker
+	logger       *slog.Logger
+}
+
+func NewWebhookHandler(webhookStore store.WebhookStore, worker *webhooks.Worker, logger *slog.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		webhookStore: webhookStore,
+		worker:       worker,
+		logger:       logger,
+	}
+}
+
+// applyWebhookRequest validates the request and copies the fields it sets
+// onto the subscription.
+func (whh *WebhookHandler) applyWebhookRequest(req *webhookRequest, subscription *store.WebhookSubscription) error {
+	if req.URL != nil {
+		err := whh.worker.CheckURL(*req.URL)
+		if err != nil {
+			return err
+		}
+		subscription.URL = *req.URL
+	}
+	if req.Events != nil {
+		if len(req.Events) == 0 {
+			return fmt.Errorf("At least one event is required, choose from %s", strings.Join(webhooks.Events, ", "))
+		}
+		for _, event := range req.Events {
+			if !webhooks.ValidEvent(event) {
+				return fmt.Errorf("Unknown event %q", event)
+			}
+		}
+		subscription.Events = req.Events
+	}
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+	return nil
+}
+
+// getSubscription loads the current user's subscription named in the URL,
+// answering the request itself when there is none.
+func (whh *WebhookHandler) getSubscription(w http.ResponseWriter, r *http.Request) (*store.WebhookSubscription, bool) {
+	subscriptionId, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		response.NotFound(w, "Invalid webhook ID format")
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	subscription, err := whh.webhookStore.GetSubscription(r.Context(), subscriptionId, currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to get webhook with ID %d", subscriptionId), err)
+		return nil, false
+	}
+	if subscription == nil {
+		response.NotFound(w, fmt.Sprintf("Webhook with ID %d not found", subscriptionId))
+		return nil, false
+	}
+	return subscription, true
+}
+
+func (whh *WebhookHandler) HandleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	subscriptions, err := whh.webhookStore.GetSubscriptionsByUser(r.Context(), currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get webhooks", err)
+		return
+	}
+
+	response.Success(w, "Webhooks retrieved successfully", subscriptions)
+}
+
+// HandleCreateWebhook returns the signing secret. It cannot be retrieved
+// again.
+func (whh *WebhookHandler) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhookReq webhookRequest
+	err := json.NewDecoder(r.Body).Decode(&webhookReq)
+	if err != nil {
+		response.BadRequest(w, "Failed to decode webhook data", err)
+		return
+	}
+	if webhookReq.URL == nil || webhookReq.Events == nil {
+		response.BadRequest(w, "Invalid webhook data", errors.New("URL and events are required"))
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	subscription := &store.WebhookSubscription{UserId: currentUser.Id, Active: true}
+	err = whh.applyWebhookRequest(&webhookReq, subscription)
+	if err != nil {
+		response.BadRequest(w, "Invalid webhook data", err)
+		return
+	}
+
+	subscription.Secret, err = tokens.GenerateSecret(webhooks.SecretPrefix)
+	if err != nil {
+		response.InternalServerError(w, "Failed to generate webhook secret", err)
+		return
+	}
+	err = whh.webhookStore.CreateSubscription(r.Context(), subscription)
+	if err != nil {
+		response.InternalServerError(w, "Failed to create webhook", err)
+		return
+	}
+
+	response.Created(w, "Webhook created, store the secret now as it will not be shown again", map[string]interface{}{
+		"webhook": subscription,
+		"secret":  subscription.Secret,
+	})
+}
+
+func (whh *WebhookHandler) HandleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := whh.getSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	var webhookReq webhookRequest
+	err := json.NewDecoder(r.Body).Decode(&webhookReq)
+	if err != nil {
+		response.BadRequest(w, "Failed to decode webhook data", err)
+		return
+	}
+	err = whh.applyWebhookRequest(&webhookReq, subscription)
+	if err != nil {
+		response.BadRequest(w, "Invalid webhook data", err)
+		return
+	}
+
+	err = whh.webhookStore.UpdateSubscription(r.Context(), subscription)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to update webhook with ID %d", subscription.Id), err)
+		return
+	}
+
+	response.Success(w, "Webhook updated successfully", subscription)
+}
+
+func (whh *WebhookHandler) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	subscriptionId, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		response.NotFound(w, "Invalid webhook ID format")
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	deleted, err := whh.webhookStore.DeleteSubscription(r.Context(), subscriptionId, currentUser.Id)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to delete webhook with ID %d", subscriptionId), err)
+		return
+	}
+	if !deleted {
+		response.NotFound(w, fmt.Sprintf("Webhook with ID %d not found", subscriptionId))
+		return
+	}
+
+	response.Success(w, "Webhook deleted", map[string]int64{"webhook_id": subscriptionId})
+}
+
+// HandlePingWebhook sends a ping event right away, whether or not the
+// subscription is active, and returns the logged delivery whatever the
+// endpoint answered. Pings are not retried.
+func (whh *WebhookHandler) HandlePingWebhook(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := whh.getSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	event, err := webhooks.NewEvent(webhooks.EventPing, map[string]interface{}{"webhook_id": subscription.Id})
+	if err != nil {
+		response.InternalServerError(w, "Failed to create ping", err)
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		response.InternalServerError(w, "Failed to create ping", err)
+		return
+	}
+	delivery := &store.WebhookDelivery{
+		SubscriptionId: subscription.Id,
+		EventId:        event.Id,
+		EventType:      event.Type,
+		Payload:        payload,
+		// Keeps the worker from claiming the ping while it is sent here
+		NextAttemptAt: time.Now().Add(time.Minute),
+		URL:           subscription.URL,
+		Secret:        subscription.Secret,
+	}
+	err = whh.webhookStore.CreateDelivery(r.Context(), delivery)
+	if err != nil {
+		response.InternalServerError(w, "Failed to create ping", err)
+		return
+	}
+
+	whh.worker.Deliver(r.Context(), delivery)
+	if delivery.Status != store.DeliverySucceeded {
+		response.Success(w, "The webhook endpoint did not accept the ping, see last_error", delivery)
+		return
+	}
+	response.Success(w, "Ping delivered", delivery)
+}
+
+// HandleGetDeliveries lists the latest deliveries to a subscription, newest
+// first. limit defaults to 20 and is capped at 100.
+func (whh *WebhookHandler) HandleGetDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDeliveryLimit
+	if param := r.URL.Query().Get("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 1 {
+			response.BadRequest(w, "Invalid limit", errors.New("limit must be a positive number"))
+			return
+		}
+		limit = min(parsed, maxDeliveryLimit)
+	}
+
+	subscription, ok := whh.getSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := whh.webhookStore.GetDeliveries(r.Context(), subscription.Id, limit)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to get deliveries of webhook with ID %d", subscription.Id), err)
+		return
+	}
+
+	response.Success(w, "Webhook deliveries retrieved successfully", deliveries)
+}
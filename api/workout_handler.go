@@ -1,43 +1,190 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"workout-tracker/calories"
+	"workout-tracker/metrics"
 	"workout-tracker/middleware"
 	"workout-tracker/response"
 	"workout-tracker/store"
 )
 
+// The trash is listed in pages of at most maxTrashLimit.
+const (
+	defaultTrashLimit = 50
+	maxTrashLimit     = 200
+)
+
+// trashedWorkout is a workout in the trash and when it will be purged.
+type trashedWorkout struct {
+	store.Workout
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// Revisions are listed in pages of at most maxRevisionLimit.
+const (
+	defaultRevisionLimit = 50
+	maxRevisionLimit     = 200
+)
+
 type WorkoutHandler struct {
-	workoutStore store.WorkoutStore
-	logger       *log.Logger
+	workoutStore   store.WorkoutStore
+	exerciseStore  store.ExerciseStore
+	userStore      store.UserStore
+	trashRetention time.Duration
+	requireIfMatch bool
+	logger         *slog.Logger
 }
 
-func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *WorkoutHandler {
+func NewWorkoutHandler(workoutStore store.WorkoutStore, exerciseStore store.ExerciseStore, userStore store.UserStore, trashRetention time.Duration, requireIfMatch bool, logger *slog.Logger) *WorkoutHandler {
 	return &WorkoutHandler{
-		workoutStore: workoutStore,
-		logger:       logger,
+		workoutStore:   workoutStore,
+		exerciseStore:  exerciseStore,
+		userStore:      userStore,
+		trashRetention: trashRetention,
+		requireIfMatch: requireIfMatch,
+		logger:         logger,
 	}
 }
 
-func (wh *WorkoutHandler) HandleGetWorkoutById(w http.ResponseWriter, r *http.Request) {
-	params := chi.URLParam(r, "id")
-	if params == "" {
-		response.NotFound(w, "Workout ID is required")
+// workoutETag is the entity tag of a workout's current version.
+func workoutETag(workout *store.Workout) string {
+	return `"` + strconv.Itoa(workout.Version) + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists
+// etag. If-Match compares strongly, so weak tags only match when weak is
+// set, as for If-None-Match.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch evaluates the If-Match header of a write against the
+// workout's current version, writing the error response when it fails.
+// Without the header the write goes ahead unless requireIfMatch is set.
+func (wh *WorkoutHandler) checkIfMatch(w http.ResponseWriter, r *http.Request, workout *store.Workout) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		if wh.requireIfMatch {
+			response.PreconditionRequired(w, "If-Match header with the workout's ETag is required")
+			return false
+		}
+		return true
+	}
+	if !etagMatches(ifMatch, workoutETag(workout), false) {
+		response.PreconditionFailed(w, fmt.Sprintf("Workout with ID %d has changed", workout.Id))
+		return false
+	}
+	return true
+}
+
+// writeConflict answers a write that lost a race with another one: 412 if
+// the client made it conditional, 409 otherwise.
+func writeConflict(w http.ResponseWriter, r *http.Request, workoutId int64) {
+	if r.Header.Get("If-Match") != "" {
+		response.PreconditionFailed(w, fmt.Sprintf("Workout with ID %d has changed", workoutId))
 		return
 	}
+	response.Error(w, http.StatusConflict, fmt.Sprintf("Workout with ID %d was changed by another request, try again", workoutId), store.ErrWorkoutChanged)
+}
 
-	workoutId, err := strconv.ParseInt(params, 10, 64)
+// estimateCalories fills in CaloriesBurned from the catalog's MET values and
+// the user's latest bodyweight.
+func (wh *WorkoutHandler) estimateCalories(ctx context.Context, workout *store.Workout) error {
+	bodyweight := calories.DefaultBodyweightKg
+	latest, err := wh.userStore.GetLatestBodyweight(ctx, workout.UserId)
 	if err != nil {
-		response.NotFound(w, "Invalid workout ID format")
+		return err
+	}
+	if latest != nil {
+		bodyweight = latest.Weight
+	}
+
+	activities := make([]calories.Activity, 0, len(workout.Entries))
+	for _, entry := range workout.Entries {
+		met := calories.DefaultMET
+		exercise, err := wh.exerciseStore.GetExerciseByName(ctx, entry.ExerciseName)
+		if err != nil {
+			return err
+		}
+		if exercise != nil {
+			met = exercise.METValue
+		}
+		activities = append(activities, calories.Activity{
+			MET:             met,
+			Sets:            entry.Sets,
+			Reps:            entry.Reps,
+			DurationSeconds: entry.DurationSeconds,
+		})
+	}
+
+	workout.CaloriesBurned = calories.Estimate(activities, bodyweight, workout.DurationMinutes)
+	workout.CaloriesEstimated = true
+	return nil
+}
+
+// workoutField returns the value of the field updatedFields names.
+func workoutField(workout *store.Workout, name string) interface{} {
+	switch name {
+	case "title":
+		return workout.Title
+	case "description":
+		return workout.Description
+	case "duration":
+		return workout.DurationMinutes
+	case "calories_burned":
+		return workout.CaloriesBurned
+	}
+	return nil
+}
+
+// fieldChanges lists the fields in updatedFields whose value differs from
+// the original workout's. Entries are compared by the store, which knows
+// their ids.
+func fieldChanges(original *store.Workout, updatedFields map[string]interface{}) map[string]store.FieldChange {
+	changes := map[string]store.FieldChange{}
+	for name, value := range updatedFields {
+		if name == "entries" {
+			continue
+		}
+		from := workoutField(original, name)
+		if from != value {
+			changes[name] = store.FieldChange{From: from, To: value}
+		}
+	}
+	return changes
+}
+
+// HandleGetWorkoutById returns a workout of the user. Credentials reach
+// only their own user's workouts, whatever their scopes.
+func (wh *WorkoutHandler) HandleGetWorkoutById(w http.ResponseWriter, r *http.Request) {
+	workoutId, _, ok := wh.ownedWorkoutId(w, r)
+	if !ok {
 		return
 	}
 
-	workout, err := wh.workoutStore.GetWorkoutById(workoutId)
+	workout, err := wh.workoutStore.GetWorkoutById(r.Context(), workoutId)
 	if err != nil {
 		response.InternalServerError(w, fmt.Sprintf("Failed to get workout with ID %d", workoutId), err)
 		return
@@ -48,17 +195,28 @@ func (wh *WorkoutHandler) HandleGetWorkoutById(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	etag := workoutETag(workout)
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	response.Success(w, "Workout retrieved successfully", workout)
 
 }
 
 func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Request) {
-	var workout store.Workout
-	err := json.NewDecoder(r.Body).Decode(&workout)
+	var workoutReq struct {
+		store.Workout
+		CaloriesBurned *int `json:"calories_burned"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&workoutReq)
 	if err != nil {
 		response.BadRequest(w, "Failed to decode workout data", err)
 		return
 	}
+	workout := workoutReq.Workout
 
 	currenUser := middleware.GetUser(r)
 	if currenUser == nil || currenUser == store.AnonymousUser {
@@ -67,11 +225,23 @@ func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Req
 	}
 	workout.UserId = currenUser.Id
 
-	createdWorkout, err := wh.workoutStore.CreateWorkout(&workout)
+	if workoutReq.CaloriesBurned != nil {
+		workout.CaloriesBurned = *workoutReq.CaloriesBurned
+		workout.CaloriesEstimated = false
+	} else {
+		err = wh.estimateCalories(r.Context(), &workout)
+		if err != nil {
+			response.InternalServerError(w, "Failed to estimate calories burned", err)
+			return
+		}
+	}
+
+	createdWorkout, err := wh.workoutStore.CreateWorkout(r.Context(), &workout)
 	if err != nil {
 		response.InternalServerError(w, "Failed to create workout", err)
 		return
 	}
+	metrics.WorkoutsCreated.Inc()
 
 	response.WorkoutCreated(w, createdWorkout)
 }
@@ -89,7 +259,7 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	existingWorkout, err := wh.workoutStore.GetWorkoutById(workoutId)
+	existingWorkout, err := wh.workoutStore.GetWorkoutById(r.Context(), workoutId)
 	if err != nil {
 		response.InternalServerError(w, fmt.Sprintf("Failed to get workout with ID %d", workoutId), err)
 		return
@@ -101,7 +271,7 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 	}
 
 	// Store original values for comparison
-	//originalWorkout := *existingWorkout
+	originalWorkout := *existingWorkout
 
 	var updatedWorkout struct {
 		Title           *string              `json:"title"`
@@ -137,6 +307,7 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 
 	if updatedWorkout.CaloriesBurned != nil {
 		existingWorkout.CaloriesBurned = *updatedWorkout.CaloriesBurned
+		existingWorkout.CaloriesEstimated = false
 		updatedFields["calories_burned"] = *updatedWorkout.CaloriesBurned
 	}
 
@@ -151,7 +322,7 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutId)
+	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(r.Context(), workoutId)
 	if err != nil {
 		response.InternalServerError(w, fmt.Sprintf("Failed to get workout owner for ID %d", workoutId), err)
 		return
@@ -162,12 +333,35 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = wh.workoutStore.UpdateWorkout(existingWorkout)
+	if !wh.checkIfMatch(w, r, existingWorkout) {
+		return
+	}
+
+	if existingWorkout.CaloriesEstimated {
+		err = wh.estimateCalories(r.Context(), existingWorkout)
+		if err != nil {
+			response.InternalServerError(w, "Failed to estimate calories burned", err)
+			return
+		}
+		updatedFields["calories_burned"] = existingWorkout.CaloriesBurned
+	}
+
+	revision := &store.WorkoutRevision{
+		UserId:  currenUser.Id,
+		Action:  store.RevisionUpdated,
+		Changes: fieldChanges(&originalWorkout, updatedFields),
+	}
+	err = wh.workoutStore.UpdateWorkout(r.Context(), existingWorkout, revision)
+	if errors.Is(err, store.ErrWorkoutChanged) {
+		writeConflict(w, r, workoutId)
+		return
+	}
 	if err != nil {
 		response.InternalServerError(w, fmt.Sprintf("Failed to update workout with ID %d", workoutId), err)
 		return
 	}
 
+	w.Header().Set("ETag", workoutETag(existingWorkout))
 	response.WorkoutUpdated(w, existingWorkout.Id, existingWorkout, updatedFields)
 }
 
@@ -190,7 +384,7 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 		response.BadRequest(w, "User must be login to delete a workout", nil)
 		return
 	}
-	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutId)
+	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(r.Context(), workoutId)
 	if err != nil {
 		response.InternalServerError(w, fmt.Sprintf("Failed to get workout owner for ID %d", workoutId), err)
 		return
@@ -201,7 +395,7 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 	}
 
 	// Get workout details before deletion for the response
-	workout, err := wh.workoutStore.GetWorkoutById(workoutId)
+	workout, err := wh.workoutStore.GetWorkoutById(r.Context(), workoutId)
 	if err != nil {
 		response.InternalServerError(w, fmt.Sprintf("Failed to get workout with ID %d", workoutId), err)
 		return
@@ -212,6 +406,15 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if !wh.checkIfMatch(w, r, workout) {
+		return
+	}
+	// A conditional delete only goes ahead at the version checked
+	version := 0
+	if r.Header.Get("If-Match") != "" {
+		version = workout.Version
+	}
+
 	// Store basic info for response
 	workoutInfo := struct {
 		ID    int    `json:"id"`
@@ -222,7 +425,11 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 	}
 
 	// Delete the workout
-	err = wh.workoutStore.DeleteWorkout(workoutId)
+	err = wh.workoutStore.DeleteWorkout(r.Context(), workoutId, version)
+	if errors.Is(err, store.ErrWorkoutChanged) {
+		writeConflict(w, r, workoutId)
+		return
+	}
 	if err != nil {
 		response.InternalServerError(w, fmt.Sprintf("Failed to delete workout with ID %d", workoutId), err)
 		return
@@ -230,3 +437,200 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 
 	response.WorkoutDeleted(w, workout.Id, workoutInfo)
 }
+
+// HandleGetTrash lists the user's deleted workouts, most recently deleted
+// first, with when each will be purged.
+func (wh *WorkoutHandler) HandleGetTrash(w http.ResponseWriter, r *http.Request) {
+	currenUser := middleware.GetUser(r)
+	if currenUser == nil || currenUser == store.AnonymousUser {
+		response.BadRequest(w, "User must be login to view the trash", nil)
+		return
+	}
+
+	limit := defaultTrashLimit
+	if param := r.URL.Query().Get("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 1 {
+			response.BadRequest(w, "Invalid limit", errors.New("limit must be a positive number"))
+			return
+		}
+		limit = min(parsed, maxTrashLimit)
+	}
+
+	workouts, err := wh.workoutStore.GetDeletedWorkouts(r.Context(), currenUser.Id, limit)
+	if err != nil {
+		response.InternalServerError(w, "Failed to get deleted workouts", err)
+		return
+	}
+
+	trash := make([]trashedWorkout, len(workouts))
+	for i, workout := range workouts {
+		trash[i] = trashedWorkout{Workout: workout, PurgeAt: workout.DeletedAt.Add(wh.trashRetention)}
+	}
+	response.Success(w, "Deleted workouts retrieved successfully", trash)
+}
+
+// HandleRestoreWorkout takes a workout of the user out of the trash.
+func (wh *WorkoutHandler) HandleRestoreWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutId, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		response.NotFound(w, "Invalid workout ID format")
+		return
+	}
+
+	currenUser := middleware.GetUser(r)
+	if currenUser == nil || currenUser == store.AnonymousUser {
+		response.BadRequest(w, "User must be login to restore a workout", nil)
+		return
+	}
+
+	restored, err := wh.workoutStore.RestoreWorkout(r.Context(), workoutId, currenUser.Id)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to restore workout with ID %d", workoutId), err)
+		return
+	}
+	if !restored {
+		response.NotFound(w, fmt.Sprintf("Deleted workout with ID %d not found", workoutId))
+		return
+	}
+
+	workout, err := wh.workoutStore.GetWorkoutById(r.Context(), workoutId)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to get workout with ID %d", workoutId), err)
+		return
+	}
+	response.Success(w, "Workout restored", workout)
+}
+
+// ownedWorkoutId parses the workout id in the URL and checks the workout
+// belongs to the current user, writing the error response when it does not.
+func (wh *WorkoutHandler) ownedWorkoutId(w http.ResponseWriter, r *http.Request) (int64, *store.User, bool) {
+	workoutId, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		response.NotFound(w, "Invalid workout ID format")
+		return 0, nil, false
+	}
+
+	currenUser := middleware.GetUser(r)
+	if currenUser == nil || currenUser == store.AnonymousUser {
+		response.BadRequest(w, "User must be login to access workouts", nil)
+		return 0, nil, false
+	}
+
+	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(r.Context(), workoutId)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to get workout owner for ID %d", workoutId), err)
+		return 0, nil, false
+	}
+	if workoutOwner == 0 {
+		response.NotFound(w, fmt.Sprintf("Workout with ID %d not found", workoutId))
+		return 0, nil, false
+	}
+	if workoutOwner != currenUser.Id {
+		response.Forbidden(w, fmt.Sprintf("User %d is not authorized to access workout %d", currenUser.Id, workoutId))
+		return 0, nil, false
+	}
+	return workoutId, currenUser, true
+}
+
+// HandleGetWorkoutRevisions lists the revisions of a workout of the user,
+// newest first: who made each change, when, and what it changed.
+func (wh *WorkoutHandler) HandleGetWorkoutRevisions(w http.ResponseWriter, r *http.Request) {
+	workoutId, _, ok := wh.ownedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultRevisionLimit
+	if param := r.URL.Query().Get("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 1 {
+			response.BadRequest(w, "Invalid limit", errors.New("limit must be a positive number"))
+			return
+		}
+		limit = min(parsed, maxRevisionLimit)
+	}
+
+	revisions, err := wh.workoutStore.GetWorkoutRevisions(r.Context(), workoutId, limit)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to get revisions of workout with ID %d", workoutId), err)
+		return
+	}
+	response.Success(w, "Workout revisions retrieved successfully", revisions)
+}
+
+// HandleRevertWorkout brings a workout of the user back to how it was
+// after one of its revisions. The revert is itself a new revision, so it
+// can be reverted in turn.
+func (wh *WorkoutHandler) HandleRevertWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutId, currenUser, ok := wh.ownedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	number, err := strconv.Atoi(chi.URLParam(r, "revision"))
+	if err != nil {
+		response.NotFound(w, "Invalid revision format")
+		return
+	}
+	target, err := wh.workoutStore.GetWorkoutRevision(r.Context(), workoutId, number)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to get revision %d of workout with ID %d", number, workoutId), err)
+		return
+	}
+	if target == nil {
+		response.NotFound(w, fmt.Sprintf("Revision %d of workout with ID %d not found", number, workoutId))
+		return
+	}
+
+	workout, err := wh.workoutStore.GetWorkoutById(r.Context(), workoutId)
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to get workout with ID %d", workoutId), err)
+		return
+	}
+	if workout == nil {
+		response.NotFound(w, fmt.Sprintf("Workout with ID %d not found", workoutId))
+		return
+	}
+	if !wh.checkIfMatch(w, r, workout) {
+		return
+	}
+	originalWorkout := *workout
+
+	snapshot := target.Snapshot
+	workout.Title = snapshot.Title
+	workout.Description = snapshot.Description
+	workout.DurationMinutes = snapshot.DurationMinutes
+	workout.CaloriesBurned = snapshot.CaloriesBurned
+	workout.CaloriesEstimated = snapshot.CaloriesEstimated
+	workout.Entries = snapshot.Entries
+	updatedFields := map[string]interface{}{
+		"title":           snapshot.Title,
+		"description":     snapshot.Description,
+		"duration":        snapshot.DurationMinutes,
+		"calories_burned": snapshot.CaloriesBurned,
+	}
+
+	revision := &store.WorkoutRevision{
+		UserId:       currenUser.Id,
+		Action:       store.RevisionReverted,
+		RevertedFrom: &number,
+		Changes:      fieldChanges(&originalWorkout, updatedFields),
+	}
+	err = wh.workoutStore.UpdateWorkout(r.Context(), workout, revision)
+	if errors.Is(err, store.ErrWorkoutChanged) {
+		writeConflict(w, r, workoutId)
+		return
+	}
+	if err != nil {
+		response.InternalServerError(w, fmt.Sprintf("Failed to revert workout with ID %d", workoutId), err)
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(workout))
+
+	response.Success(w, fmt.Sprintf("Workout reverted to revision %d", number), map[string]interface{}{
+		"workout":  workout,
+		"revision": revision,
+	})
+}
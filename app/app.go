@@ -3,64 +3,242 @@ package app
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"sync/atomic"
+	"time"
 	"workout-tracker/api"
+	"workout-tracker/config"
+	"workout-tracker/jobs"
+	"workout-tracker/lockout"
+	"workout-tracker/logging"
+	"workout-tracker/metrics"
+	"workout-tracker/middleware"
 	"workout-tracker/migrations"
-	"workout-tracker/response"
+	"workout-tracker/notify"
+	"workout-tracker/oidc"
+	"workout-tracker/ratelimit"
+	"workout-tracker/reminders"
 	"workout-tracker/store"
+	"workout-tracker/webhooks"
 )
 
 type Application struct {
-	Logger         *log.Logger
-	WorkoutHandler *api.WorkoutHandler
-	UserHandler    *api.UserHandler
-	TokenHandler   *api.TokenHandler
-	Db             *sql.DB
+	Logger              *slog.Logger
+	WorkoutHandler      *api.WorkoutHandler
+	UserHandler         *api.UserHandler
+	TokenHandler        *api.TokenHandler
+	MFAHandler          *api.MFAHandler
+	APIKeyHandler       *api.APIKeyHandler
+	OAuthHandler        *api.OAuthHandler
+	OIDCHandler         *api.OIDCHandler
+	WebhookHandler      *api.WebhookHandler
+	JobHandler          *api.JobHandler
+	ReminderHandler     *api.ReminderHandler
+	NotificationHandler *api.NotificationHandler
+	GoalHandler         *api.GoalHandler
+	CalendarHandler     *api.CalendarHandler
+	CalendarFeedHandler *api.CalendarFeedHandler
+	ExerciseHandler     *api.ExerciseHandler
+	EquipmentHandler    *api.EquipmentHandler
+	Middleware          *middleware.UserMiddleware
+	WebhookWorker       *webhooks.Worker
+	JobRunner           *jobs.Runner
+	RateLimiter         *middleware.RateLimiter
+	RateLimits          RateLimitPolicies
+	Idempotency         *middleware.Idempotency
+	Db                  *sql.DB
+
+	shuttingDown atomic.Bool
 }
 
-func NewLog() (*Application, error) {
+// RateLimitPolicies are the limits the routes apply.
+type RateLimitPolicies struct {
+	Default  ratelimit.Policy
+	Login    ratelimit.Policy
+	Register ratelimit.Policy
+}
 
-	pgDb, err := store.Connect()
+func NewLog(cfg *config.Config) (*Application, error) {
+	// Create logger
+	logger, err := logging.New(os.Stdout, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	pgDb, err := store.Connect(cfg.Database)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to the database: %w", err)
 	}
+	logger.Info("connected to the database", "max_open_conns", cfg.Database.MaxOpenConns)
 	err = store.MigrateFs(pgDb, migrations.FS, ".")
 	if err != nil {
 		panic(err)
 	}
 
-	// Create logger
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	// Apply the configured password hashing cost
+	store.SetBcryptCost(cfg.Auth.BcryptCost)
+	// Apply the configured query timeouts
+	store.SetQueryTimeouts(cfg.Database.QueryTimeout, cfg.Database.QueryTimeouts)
 
-	// Initialize response package logger
-	response.InitLogger(logger)
+	// Export connection pool statistics
+	metrics.RegisterDB(pgDb, "postgres")
 
 	// Create the workout store
-	workoutStore := store.NewWorkoutStore(pgDb)
+	workoutStore := metrics.InstrumentWorkoutStore(store.NewWorkoutStore(pgDb))
 	// Create the user store
-	userStore := store.NewPostgresUserStore(pgDb)
+	userStore := metrics.InstrumentUserStore(store.NewPostgresUserStore(pgDb))
 	// Create the token store
 	tokenStore := store.NewPostgresTokenStore(pgDb)
+	// Create the goal store
+	goalStore := store.NewPostgresGoalStore(pgDb)
+	// Create the exercise store
+	exerciseStore := store.NewPostgresExerciseStore(pgDb)
+	// Create the equipment store
+	equipmentStore := store.NewPostgresEquipmentStore(pgDb)
+	// Create the login audit store
+	loginStore := store.NewPostgresLoginStore(pgDb)
+	// Create the two-factor authentication store
+	mfaStore := store.NewPostgresMFAStore(pgDb)
+	// Create the API key store
+	apiKeyStore := store.NewPostgresAPIKeyStore(pgDb)
+	// Create the OAuth store
+	oauthStore := store.NewPostgresOAuthStore(pgDb)
+	// Create the external identity store
+	identityStore := store.NewPostgresIdentityStore(pgDb)
+	// Create the webhook store
+	webhookStore := store.NewPostgresWebhookStore(pgDb)
+
+	// Create the job store
+	jobStore := store.NewPostgresJobStore(pgDb)
+	// Create the reminder store
+	reminderStore := store.NewPostgresReminderStore(pgDb)
+	// Create the notification store
+	notificationStore := store.NewPostgresNotificationStore(pgDb)
+	// Create the calendar feed store
+	calendarFeedStore := store.NewPostgresCalendarFeedStore(pgDb)
+	// Create the idempotency key store
+	idempotencyStore := store.NewPostgresIdempotencyStore(pgDb)
+
+	// Initialize the webhook delivery worker
+	webhookWorker := webhooks.NewWorker(webhookStore, cfg.Webhooks, logger)
+
+	// Initialize the notifiers, email only with a mail server configured
+	webhookPublisher := webhooks.NewPublisher(webhookStore)
+	notifier := notify.NewDispatcher()
+	notifier.Register(notify.ChannelInApp, notify.NewInApp(notificationStore))
+	notifier.Register(notify.ChannelWebhook, notify.NewWebhook(webhookPublisher))
+	if cfg.SMTP.Addr != "" {
+		notifier.Register(notify.ChannelEmail, notify.NewEmail(cfg.SMTP, nil))
+	}
+
+	// Initialize the job runner and register the job handlers
+	jobRunner := jobs.NewRunner(jobStore, cfg.Jobs, logger)
+	jobRunner.Register(store.JobWorkoutEvent, webhookPublisher.HandleWorkoutEvent(workoutStore))
+	jobRunner.Register(store.JobSendNotification, notifier.HandleSendNotification())
+	jobRunner.Register(reminders.KindEvaluateReminders, reminders.HandleEvaluate(reminderStore, logger))
+	jobRunner.Every(reminders.KindEvaluateReminders, time.Minute)
+	jobRunner.Register(jobs.KindPurgeHistory, jobs.PurgeHistory(jobStore, webhookStore, cfg.Jobs.Retention))
+	jobRunner.Every(jobs.KindPurgeHistory, time.Hour)
+	jobRunner.Register(jobs.KindPurgeTrash, jobs.PurgeTrash(workoutStore, cfg.Workouts.TrashRetention))
+	jobRunner.Every(jobs.KindPurgeTrash, time.Hour)
+	jobRunner.Register(jobs.KindPurgeIdempotencyKeys, jobs.PurgeIdempotencyKeys(idempotencyStore, cfg.Workouts.IdempotencyWindow))
+	jobRunner.Every(jobs.KindPurgeIdempotencyKeys, time.Hour)
+	jobRunner.Register(jobs.KindPurgeOIDCLogins, jobs.PurgeOIDCLogins(identityStore))
+	jobRunner.Every(jobs.KindPurgeOIDCLogins, time.Hour)
+
+	// Initialize the rate limiter
+	var rateLimitStore ratelimit.Store
+	switch cfg.RateLimit.Store {
+	case "memory":
+		rateLimitStore = ratelimit.NewMemoryStore()
+	case "postgres":
+		rateLimitStore = store.NewPostgresRateLimitStore(pgDb)
+	}
+	rateLimiter := middleware.NewRateLimiter(rateLimitStore, cfg.RateLimit.TrustProxy, logger)
+	rateLimits := RateLimitPolicies{
+		Default:  newPolicy("default", cfg.RateLimit.Default),
+		Login:    newPolicy("login", cfg.RateLimit.Login),
+		Register: newPolicy("register", cfg.RateLimit.Register),
+	}
 
 	// Initialize the WorkoutHandler
-	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
+	workoutHandler := api.NewWorkoutHandler(workoutStore, exerciseStore, userStore, cfg.Workouts.TrashRetention, cfg.Workouts.RequireIfMatch, logger)
 	// Initialize the UserHandler
 	userHandler := api.NewUserHandler(userStore, logger)
 	// Initialize the TokenHandler
-	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
+	lockoutPolicy := lockout.Policy{
+		MaxFailures: cfg.Auth.LoginMaxFailures,
+		Window:      cfg.Auth.LoginLockout,
+		BaseDelay:   cfg.Auth.LoginFailureDelay,
+	}
+	tokenHandler := api.NewTokenHandler(tokenStore, userStore, loginStore, mfaStore, lockoutPolicy, rateLimiter.ClientIP, cfg.Auth.TokenTTL, cfg.Auth.MFATokenTTL, logger)
+	// Initialize the OIDCHandler
+	oidcClient := &http.Client{Timeout: 10 * time.Second}
+	oidcProviders := make([]*oidc.Provider, len(cfg.OIDC))
+	for i, providerCfg := range cfg.OIDC {
+		oidcProviders[i] = oidc.NewProvider(providerCfg, oidcClient)
+	}
+	oidcHandler := api.NewOIDCHandler(oidcProviders, identityStore, tokenHandler.CompleteLogin, logger)
+	// Initialize the MFAHandler
+	mfaHandler := api.NewMFAHandler(mfaStore, loginStore, lockoutPolicy, rateLimiter.ClientIP, logger)
+	// Initialize the APIKeyHandler
+	apiKeyHandler := api.NewAPIKeyHandler(apiKeyStore, logger)
+	// Initialize the OAuthHandler
+	oauthHandler := api.NewOAuthHandler(oauthStore, cfg.OAuth.CodeTTL, cfg.OAuth.AccessTokenTTL, cfg.OAuth.RefreshTokenTTL, logger)
+	// Initialize the WebhookHandler
+	webhookHandler := api.NewWebhookHandler(webhookStore, webhookWorker, logger)
+	// Initialize the JobHandler
+	jobHandler := api.NewJobHandler(jobStore, logger)
+	// Initialize the ReminderHandler
+	reminderHandler := api.NewReminderHandler(reminderStore, notifier.Channels(), logger)
+	// Initialize the NotificationHandler
+	notificationHandler := api.NewNotificationHandler(notificationStore, logger)
+	// Initialize the GoalHandler
+	goalHandler := api.NewGoalHandler(goalStore, logger)
+	// Initialize the CalendarHandler
+	calendarHandler := api.NewCalendarHandler(workoutStore, logger)
+	// Initialize the CalendarFeedHandler
+	calendarFeedHandler := api.NewCalendarFeedHandler(calendarFeedStore, workoutStore, reminderStore, cfg.Server.PublicURL, logger)
+	// Initialize the ExerciseHandler
+	exerciseHandler := api.NewExerciseHandler(exerciseStore, equipmentStore, logger)
+	// Initialize the EquipmentHandler
+	equipmentHandler := api.NewEquipmentHandler(equipmentStore, logger)
+	// Initialize the authentication middleware
+	userMiddleware := middleware.NewUserMiddleware(userStore, apiKeyStore, oauthStore, cfg.Auth.AdminUsers)
+	// Initialize the idempotency key middleware
+	idempotency := middleware.NewIdempotency(idempotencyStore, cfg.Workouts.IdempotencyWindow, logger)
 
 	app := &Application{
-		Logger:         logger,
-		WorkoutHandler: workoutHandler,
-		UserHandler:    userHandler,
-		TokenHandler:   tokenHandler,
-		Db:             pgDb,
+		Logger:              logger,
+		WorkoutHandler:      workoutHandler,
+		UserHandler:         userHandler,
+		TokenHandler:        tokenHandler,
+		MFAHandler:          mfaHandler,
+		APIKeyHandler:       apiKeyHandler,
+		OAuthHandler:        oauthHandler,
+		OIDCHandler:         oidcHandler,
+		WebhookHandler:      webhookHandler,
+		JobHandler:          jobHandler,
+		ReminderHandler:     reminderHandler,
+		NotificationHandler: notificationHandler,
+		GoalHandler:         goalHandler,
+		CalendarHandler:     calendarHandler,
+		CalendarFeedHandler: calendarFeedHandler,
+		ExerciseHandler:     exerciseHandler,
+		EquipmentHandler:    equipmentHandler,
+		Middleware:          userMiddleware,
+		WebhookWorker:       webhookWorker,
+		JobRunner:           jobRunner,
+		RateLimiter:         rateLimiter,
+		RateLimits:          rateLimits,
+		Idempotency:         idempotency,
+		Db:                  pgDb,
 	}
 	return app, nil
 }
 
-func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "OK")
+func newPolicy(name string, cfg config.RateLimitPolicy) ratelimit.Policy {
+	return ratelimit.Policy{Name: name, Requests: cfg.Requests, Period: cfg.Period}
 }
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"workout-tracker/response"
+	"workout-tracker/store"
+)
+
+// readinessTimeout bounds how long a readiness probe waits on the database.
+const readinessTimeout = 2 * time.Second
+
+type poolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMs     int64 `json:"wait_duration_ms"`
+}
+
+type databaseHealth struct {
+	Status           string    `json:"status"`
+	MigrationVersion int64     `json:"migration_version"`
+	Pool             poolStats `json:"pool"`
+}
+
+type readiness struct {
+	Status   string         `json:"status"`
+	Database databaseHealth `json:"database"`
+}
+
+// BeginShutdown makes the readiness check fail so load balancers stop
+// routing new requests while in-flight ones drain.
+func (a *Application) BeginShutdown() {
+	a.shuttingDown.Store(true)
+}
+
+// LivenessCheck reports that the process is up and serving HTTP.
+func (a *Application) LivenessCheck(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HealthCheck reports whether the application can serve traffic: the
+// database answers a ping and the server is not shutting down.
+func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	stats := a.Db.Stats()
+	result := readiness{
+		Status: "ok",
+		Database: databaseHealth{
+			Status: "ok",
+			Pool: poolStats{
+				MaxOpenConnections: stats.MaxOpenConnections,
+				OpenConnections:    stats.OpenConnections,
+				InUse:              stats.InUse,
+				Idle:               stats.Idle,
+				WaitCount:          stats.WaitCount,
+				WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+			},
+		},
+	}
+
+	err := a.Db.PingContext(ctx)
+	if err == nil {
+		result.Database.MigrationVersion, err = store.MigrationVersion(ctx, a.Db)
+	}
+	if err != nil {
+		// The probe is public, so why the database is unavailable only goes
+		// to the log.
+		a.Logger.ErrorContext(ctx, "readiness check failed", "error", err)
+		result.Status = "unavailable"
+		result.Database.Status = "unavailable"
+	}
+	if a.shuttingDown.Load() {
+		result.Status = "shutting_down"
+	}
+
+	status := http.StatusOK
+	if result.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	response.JSON(w, status, result)
+}
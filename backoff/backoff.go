@@ -0,0 +1,16 @@
+package backoff
+
+import "time"
+
+// Delay is how long to wait after the given failed attempt, starting at
+// one: base, doubling with every further attempt, and capped at limit.
+func Delay(attempt int, base, limit time.Duration) time.Duration {
+	if attempt <= 0 || base <= 0 {
+		return 0
+	}
+	delay := base
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
@@ -0,0 +1,52 @@
+package calories
+
+import "math"
+
+const (
+	// DefaultMET is used for exercises missing from the catalog and for
+	// workouts logged without entries.
+	DefaultMET = 5.0
+	// DefaultBodyweightKg is used until the user logs their bodyweight.
+	DefaultBodyweightKg = 70.0
+
+	secondsPerRep     = 3
+	restSecondsPerSet = 60
+)
+
+type Activity struct {
+	MET             float64
+	Sets            int
+	Reps            *int
+	DurationSeconds *int
+}
+
+// Seconds returns how long the activity took, estimating the time of rep
+// based sets from a fixed tempo plus rest between sets.
+func (a Activity) Seconds() int {
+	if a.DurationSeconds != nil {
+		return a.Sets * *a.DurationSeconds
+	}
+	reps := 0
+	if a.Reps != nil {
+		reps = *a.Reps
+	}
+	return a.Sets * (reps*secondsPerRep + restSecondsPerSet)
+}
+
+// Estimate returns the kilocalories burned using MET x bodyweight (kg) x
+// hours. Without activities the whole workout duration is counted at
+// DefaultMET.
+func Estimate(activities []Activity, bodyweightKg float64, workoutMinutes int) int {
+	if bodyweightKg <= 0 {
+		bodyweightKg = DefaultBodyweightKg
+	}
+	if len(activities) == 0 {
+		return int(math.Round(DefaultMET * bodyweightKg * float64(workoutMinutes) / 60))
+	}
+
+	total := 0.0
+	for _, activity := range activities {
+		total += activity.MET * bodyweightKg * float64(activity.Seconds()) / 3600
+	}
+	return int(math.Round(total))
+}
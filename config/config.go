@@ -0,0 +1,675 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix is prepended to a setting's upper-cased name to form its
+// environment variable, e.g. db-dsn is read from WORKOUT_DB_DSN.
+const envPrefix = "WORKOUT_"
+
+type ServerConfig struct {
+	Addr            string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	// ShutdownDelay is how long the server keeps serving after it reports
+	// not ready, so that load balancers stop sending it requests first.
+	ShutdownDelay time.Duration
+	// PublicURL is where clients reach the server, for links that are
+	// used outside of it such as calendar feeds.
+	PublicURL string
+}
+
+type DatabaseConfig struct {
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	QueryTimeout    time.Duration
+	// QueryTimeouts overrides QueryTimeout for individual store operations,
+	// keyed like "GoalStore.GetGoalProgress".
+	QueryTimeouts map[string]time.Duration
+}
+
+type AuthConfig struct {
+	TokenTTL          time.Duration
+	BcryptCost        int
+	LoginMaxFailures  int
+	LoginLockout      time.Duration
+	LoginFailureDelay time.Duration
+	MFATokenTTL       time.Duration
+	// AdminUsers are the usernames allowed on the /admin routes.
+	AdminUsers []string
+}
+
+type LogConfig struct {
+	Level  string
+	Format string
+}
+
+type TracingConfig struct {
+	Exporter     string
+	OTLPEndpoint string
+	SampleRatio  float64
+}
+
+// RateLimitPolicy allows Requests per Period, written "120/1m".
+type RateLimitPolicy struct {
+	Requests int
+	Period   time.Duration
+}
+
+type RateLimitConfig struct {
+	Store      string
+	TrustProxy bool
+	Default    RateLimitPolicy
+	Login      RateLimitPolicy
+	Register   RateLimitPolicy
+}
+
+type OAuthConfig struct {
+	CodeTTL         time.Duration
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+type WebhookConfig struct {
+	PollInterval time.Duration
+	Timeout      time.Duration
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	// AllowPrivateNetworks lets webhooks reach loopback and private
+	// addresses, for deployments where every user is trusted.
+	AllowPrivateNetworks bool
+}
+
+type JobConfig struct {
+	Workers      int
+	PollInterval time.Duration
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	// Lease is how long a job may run before another worker may claim it
+	// again.
+	Lease     time.Duration
+	Retention time.Duration
+}
+
+type WorkoutConfig struct {
+	// TrashRetention is how long deleted workouts can be restored before
+	// they are purged.
+	TrashRetention time.Duration
+	// RequireIfMatch makes updates and deletes of workouts carry the ETag
+	// the client last saw, so they never overwrite a change it missed.
+	RequireIfMatch bool
+	// IdempotencyWindow is how long the response to a request sent with an
+	// Idempotency-Key is replayed to retries.
+	IdempotencyWindow time.Duration
+}
+
+// SMTPConfig is the mail server notifications are emailed through. Email
+// notifications are off while Addr is empty.
+type SMTPConfig struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// OIDCProviderConfig is an OpenID Connect identity provider users may log
+// in with. Its endpoints are discovered from Issuer.
+type OIDCProviderConfig struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+}
+
+type Config struct {
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Auth      AuthConfig
+	Log       LogConfig
+	Tracing   TracingConfig
+	RateLimit RateLimitConfig
+	OAuth     OAuthConfig
+	OIDC      []OIDCProviderConfig
+	Webhooks  WebhookConfig
+	Jobs      JobConfig
+	SMTP      SMTPConfig
+	Workouts  WorkoutConfig
+}
+
+// Default returns the settings used for local development.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            "localhost:1500",
+			PublicURL:       "http://localhost:1500",
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     time.Minute,
+			ShutdownTimeout: 15 * time.Second,
+			ShutdownDelay:   5 * time.Second,
+		},
+		Database: DatabaseConfig{
+			DSN:             "host=localhost user=postgres password=postgres dbname=postgres port=5432 sslmode=disable",
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			QueryTimeout:    5 * time.Second,
+			QueryTimeouts:   map[string]time.Duration{},
+		},
+		Auth: AuthConfig{
+			TokenTTL:          24 * time.Hour,
+			BcryptCost:        10,
+			LoginMaxFailures:  5,
+			LoginLockout:      15 * time.Minute,
+			LoginFailureDelay: 250 * time.Millisecond,
+			MFATokenTTL:       5 * time.Minute,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter:     "none",
+			OTLPEndpoint: "http://localhost:4318",
+			SampleRatio:  1,
+		},
+		RateLimit: RateLimitConfig{
+			Store:    "memory",
+			Default:  RateLimitPolicy{Requests: 120, Period: time.Minute},
+			Login:    RateLimitPolicy{Requests: 10, Period: 15 * time.Minute},
+			Register: RateLimitPolicy{Requests: 5, Period: time.Hour},
+		},
+		OAuth: OAuthConfig{
+			CodeTTL:         time.Minute,
+			AccessTokenTTL:  time.Hour,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Webhooks: WebhookConfig{
+			PollInterval: 5 * time.Second,
+			Timeout:      10 * time.Second,
+			MaxAttempts:  8,
+			RetryBackoff: 30 * time.Second,
+		},
+		Jobs: JobConfig{
+			Workers:      4,
+			PollInterval: time.Second,
+			MaxAttempts:  5,
+			RetryBackoff: 10 * time.Second,
+			Lease:        5 * time.Minute,
+			Retention:    7 * 24 * time.Hour,
+		},
+		SMTP: SMTPConfig{
+			From: "workouts@localhost",
+		},
+		Workouts: WorkoutConfig{
+			TrashRetention:    30 * 24 * time.Hour,
+			IdempotencyWindow: 24 * time.Hour,
+		},
+	}
+}
+
+type setting struct {
+	name  string
+	usage string
+	set   func(cfg *Config, value string) error
+}
+
+// settings lists every option once; it drives the config file keys, the
+// environment variables and the command line flags.
+var settings = []setting{
+	{"addr", "HTTP listen address", stringSetter(func(c *Config) *string { return &c.Server.Addr })},
+	{"read-timeout", "maximum duration for reading a request", durationSetter(func(c *Config) *time.Duration { return &c.Server.ReadTimeout })},
+	{"write-timeout", "maximum duration for writing a response", durationSetter(func(c *Config) *time.Duration { return &c.Server.WriteTimeout })},
+	{"idle-timeout", "how long keep-alive connections stay open", durationSetter(func(c *Config) *time.Duration { return &c.Server.IdleTimeout })},
+	{"shutdown-timeout", "how long to wait for in-flight requests on shutdown", durationSetter(func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout })},
+	{"shutdown-delay", "how long to keep serving after reporting not ready on shutdown", durationSetter(func(c *Config) *time.Duration { return &c.Server.ShutdownDelay })},
+	{"public-url", "base URL clients reach the server at, used in calendar feed links", stringSetter(func(c *Config) *string { return &c.Server.PublicURL })},
+	{"db-dsn", "PostgreSQL connection string", stringSetter(func(c *Config) *string { return &c.Database.DSN })},
+	{"db-max-open-conns", "maximum open database connections", intSetter(func(c *Config) *int { return &c.Database.MaxOpenConns })},
+	{"db-max-idle-conns", "maximum idle database connections", intSetter(func(c *Config) *int { return &c.Database.MaxIdleConns })},
+	{"db-conn-max-lifetime", "maximum lifetime of a database connection", durationSetter(func(c *Config) *time.Duration { return &c.Database.ConnMaxLifetime })},
+	{"db-conn-max-idle-time", "maximum idle time of a database connection", durationSetter(func(c *Config) *time.Duration { return &c.Database.ConnMaxIdleTime })},
+	{"db-query-timeout", "default timeout of a store operation", durationSetter(func(c *Config) *time.Duration { return &c.Database.QueryTimeout })},
+	{"db-query-timeouts", "per-operation timeouts, e.g. GoalStore.GetGoalProgress=10s,WorkoutStore.GetDailyActivity=10s", durationMapSetter(func(c *Config) map[string]time.Duration { return c.Database.QueryTimeouts })},
+	{"auth-token-ttl", "lifetime of authentication tokens", durationSetter(func(c *Config) *time.Duration { return &c.Auth.TokenTTL })},
+	{"bcrypt-cost", "bcrypt cost for password hashes", intSetter(func(c *Config) *int { return &c.Auth.BcryptCost })},
+	{"login-max-failures", "failed logins within login-lockout that lock a username", intSetter(func(c *Config) *int { return &c.Auth.LoginMaxFailures })},
+	{"login-lockout", "how long failed logins count and a lock lasts", durationSetter(func(c *Config) *time.Duration { return &c.Auth.LoginLockout })},
+	{"login-failure-delay", "delay after the first failed login, doubling with each further failure", durationSetter(func(c *Config) *time.Duration { return &c.Auth.LoginFailureDelay })},
+	{"mfa-token-ttl", "how long a login may wait for its two-factor code", durationSetter(func(c *Config) *time.Duration { return &c.Auth.MFATokenTTL })},
+	{"admin-users", "usernames allowed to use the admin routes, as a JSON list", jsonSetter(func(c *Config) interface{} { return &c.Auth.AdminUsers })},
+	{"log-level", "minimum log level: debug, info, warn or error", stringSetter(func(c *Config) *string { return &c.Log.Level })},
+	{"log-format", "log output format: json or text", stringSetter(func(c *Config) *string { return &c.Log.Format })},
+	{"tracing-exporter", "trace exporter: none, stdout or otlp", stringSetter(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{"otlp-endpoint", "OTLP/HTTP collector URL for traces; /v1/traces is added when it has no path", stringSetter(func(c *Config) *string { return &c.Tracing.OTLPEndpoint })},
+	{"tracing-sample-ratio", "fraction of new traces to sample, between 0 and 1", floatSetter(func(c *Config) *float64 { return &c.Tracing.SampleRatio })},
+	{"rate-limit-store", "where rate limit buckets are kept: memory, postgres or none to disable", stringSetter(func(c *Config) *string { return &c.RateLimit.Store })},
+	{"rate-limit-trust-proxy", "take client addresses from X-Forwarded-For", boolSetter(func(c *Config) *bool { return &c.RateLimit.TrustProxy })},
+	{"rate-limit-default", "requests per period for each user or address, e.g. 120/1m", policySetter(func(c *Config) *RateLimitPolicy { return &c.RateLimit.Default })},
+	{"rate-limit-login", "login attempts per period for each address", policySetter(func(c *Config) *RateLimitPolicy { return &c.RateLimit.Login })},
+	{"rate-limit-register", "registrations per period for each address", policySetter(func(c *Config) *RateLimitPolicy { return &c.RateLimit.Register })},
+	{"oauth-code-ttl", "how long an OAuth authorization code may wait to be exchanged", durationSetter(func(c *Config) *time.Duration { return &c.OAuth.CodeTTL })},
+	{"oauth-access-token-ttl", "lifetime of OAuth access tokens", durationSetter(func(c *Config) *time.Duration { return &c.OAuth.AccessTokenTTL })},
+	{"oauth-refresh-token-ttl", "lifetime of OAuth refresh tokens", durationSetter(func(c *Config) *time.Duration { return &c.OAuth.RefreshTokenTTL })},
+	{"oidc-providers", "OpenID Connect providers to log in with, as a JSON list of {name, issuer, client_id, client_secret, redirect_url, scopes}", jsonSetter(func(c *Config) interface{} { return &c.OIDC })},
+	{"webhook-poll-interval", "how often the webhook worker looks for due deliveries", durationSetter(func(c *Config) *time.Duration { return &c.Webhooks.PollInterval })},
+	{"webhook-timeout", "how long a webhook endpoint may take to answer", durationSetter(func(c *Config) *time.Duration { return &c.Webhooks.Timeout })},
+	{"webhook-max-attempts", "delivery attempts before a webhook delivery is given up", intSetter(func(c *Config) *int { return &c.Webhooks.MaxAttempts })},
+	{"webhook-retry-backoff", "delay before the first webhook retry, doubling with each further attempt", durationSetter(func(c *Config) *time.Duration { return &c.Webhooks.RetryBackoff })},
+	{"webhook-allow-private-networks", "let webhooks reach loopback and private network addresses", boolSetter(func(c *Config) *bool { return &c.Webhooks.AllowPrivateNetworks })},
+	{"job-workers", "background jobs run at once", intSetter(func(c *Config) *int { return &c.Jobs.Workers })},
+	{"job-poll-interval", "how often idle job workers look for due jobs", durationSetter(func(c *Config) *time.Duration { return &c.Jobs.PollInterval })},
+	{"job-max-attempts", "attempts before a failing job is dead-lettered", intSetter(func(c *Config) *int { return &c.Jobs.MaxAttempts })},
+	{"job-retry-backoff", "delay before the first job retry, doubling with each further attempt", durationSetter(func(c *Config) *time.Duration { return &c.Jobs.RetryBackoff })},
+	{"job-lease", "how long a job may run before it is claimed again", durationSetter(func(c *Config) *time.Duration { return &c.Jobs.Lease })},
+	{"job-retention", "how long finished jobs and webhook deliveries are kept", durationSetter(func(c *Config) *time.Duration { return &c.Jobs.Retention })},
+	{"smtp-addr", "host:port of the mail server for email notifications; empty turns them off", stringSetter(func(c *Config) *string { return &c.SMTP.Addr })},
+	{"smtp-username", "mail server username", stringSetter(func(c *Config) *string { return &c.SMTP.Username })},
+	{"smtp-password", "mail server password", stringSetter(func(c *Config) *string { return &c.SMTP.Password })},
+	{"smtp-from", "sender address of email notifications", stringSetter(func(c *Config) *string { return &c.SMTP.From })},
+	{"trash-retention", "how long deleted workouts stay in the trash before they are purged", durationSetter(func(c *Config) *time.Duration { return &c.Workouts.TrashRetention })},
+	{"require-if-match", "reject workout updates and deletes without an If-Match header", boolSetter(func(c *Config) *bool { return &c.Workouts.RequireIfMatch })},
+	{"idempotency-window", "how long responses to requests with an Idempotency-Key are replayed to retries", durationSetter(func(c *Config) *time.Duration { return &c.Workouts.IdempotencyWindow })},
+}
+
+func newFlagSet() (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("workout-tracker", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to a JSON config file (env "+envPrefix+"CONFIG)")
+	for _, s := range settings {
+		fs.Var(&rawValue{}, s.name, s.usage+" (env "+envName(s.name)+")")
+	}
+	return fs, configPath
+}
+
+// PrintUsage writes the flags Load accepts to w.
+func PrintUsage(w io.Writer) {
+	fs, _ := newFlagSet()
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+// Load builds the configuration from, in increasing order of precedence,
+// the defaults, a JSON config file, environment variables and flags. The
+// config file is named by -config or WORKOUT_CONFIG and is optional. Load
+// prints nothing; for -h it returns flag.ErrHelp.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	fs, configPath := newFlagSet()
+	fs.SetOutput(io.Discard)
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	path := *configPath
+	if path == "" {
+		path = getenv(envPrefix + "CONFIG")
+	}
+	if path != "" {
+		err = cfg.loadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if value := getenv(envName(s.name)); value != "" {
+			err = s.set(cfg, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", envName(s.name), err)
+			}
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		s, ok := lookup(f.Name)
+		if !ok || err != nil {
+			return
+		}
+		if setErr := s.set(cfg, f.Value.String()); setErr != nil {
+			err = fmt.Errorf("invalid -%s: %w", s.name, setErr)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile applies a flat JSON object keyed by setting name, e.g.
+// {"addr": ":8080", "db-max-open-conns": 25, "read-timeout": "5s"}.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// Numbers are kept as written, so that large integers are not turned
+	// into floats such as 1e+06 on the way.
+	values := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&values)
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for key, value := range values {
+		s, ok := lookup(key)
+		if !ok {
+			return fmt.Errorf("unknown setting %q in config file %s", key, path)
+		}
+		switch structured := value.(type) {
+		case json.Number:
+			value = structured.String()
+		case map[string]interface{}:
+			value = joinPairs(structured)
+		case []interface{}:
+			encoded, err := json.Marshal(structured)
+			if err != nil {
+				return fmt.Errorf("invalid %q in config file %s: %w", key, path, err)
+			}
+			value = string(encoded)
+		}
+		err = s.set(c, fmt.Sprint(value))
+		if err != nil {
+			return fmt.Errorf("invalid %q in config file %s: %w", key, path, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("addr must not be empty"))
+	}
+	if u, err := url.Parse(c.Server.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, errors.New("public-url must be an absolute http or https URL"))
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 || c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server timeouts must be positive"))
+	}
+	if c.Server.ShutdownDelay < 0 {
+		errs = append(errs, errors.New("shutdown-delay must not be negative"))
+	}
+	if c.Database.DSN == "" {
+		errs = append(errs, errors.New("db-dsn must not be empty"))
+	}
+	if c.Database.MaxOpenConns <= 0 {
+		errs = append(errs, errors.New("db-max-open-conns must be positive"))
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, errors.New("db-max-idle-conns must be between 0 and db-max-open-conns"))
+	}
+	if c.Database.ConnMaxLifetime < 0 || c.Database.ConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("database connection lifetimes must not be negative"))
+	}
+	if c.Database.QueryTimeout <= 0 {
+		errs = append(errs, errors.New("db-query-timeout must be positive"))
+	}
+	for operation, timeout := range c.Database.QueryTimeouts {
+		if timeout <= 0 {
+			errs = append(errs, fmt.Errorf("db-query-timeouts: timeout of %s must be positive", operation))
+		}
+	}
+	if c.Auth.TokenTTL <= 0 {
+		errs = append(errs, errors.New("auth-token-ttl must be positive"))
+	}
+	if c.Auth.MFATokenTTL <= 0 {
+		errs = append(errs, errors.New("mfa-token-ttl must be positive"))
+	}
+	if c.Auth.BcryptCost < bcrypt.MinCost || c.Auth.BcryptCost > bcrypt.MaxCost {
+		errs = append(errs, fmt.Errorf("bcrypt-cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+	}
+	if c.Auth.LoginMaxFailures <= 0 || c.Auth.LoginLockout <= 0 {
+		errs = append(errs, errors.New("login-max-failures and login-lockout must be positive"))
+	}
+	if c.Auth.LoginFailureDelay < 0 {
+		errs = append(errs, errors.New("login-failure-delay must not be negative"))
+	}
+	var level slog.Level
+	if level.UnmarshalText([]byte(c.Log.Level)) != nil {
+		errs = append(errs, errors.New("log-level must be debug, info, warn or error"))
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		errs = append(errs, errors.New("log-format must be json or text"))
+	}
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if c.Tracing.OTLPEndpoint == "" {
+			errs = append(errs, errors.New("otlp-endpoint must not be empty when tracing-exporter is otlp"))
+		}
+	default:
+		errs = append(errs, errors.New("tracing-exporter must be none, stdout or otlp"))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing-sample-ratio must be between 0 and 1"))
+	}
+	switch c.RateLimit.Store {
+	case "memory", "postgres", "none":
+	default:
+		errs = append(errs, errors.New("rate-limit-store must be memory, postgres or none"))
+	}
+	for name, policy := range map[string]RateLimitPolicy{
+		"rate-limit-default":  c.RateLimit.Default,
+		"rate-limit-login":    c.RateLimit.Login,
+		"rate-limit-register": c.RateLimit.Register,
+	} {
+		if policy.Requests <= 0 || policy.Period <= 0 {
+			errs = append(errs, fmt.Errorf("%s must allow a positive number of requests per positive period", name))
+		}
+	}
+	if c.OAuth.CodeTTL <= 0 || c.OAuth.AccessTokenTTL <= 0 || c.OAuth.RefreshTokenTTL <= 0 {
+		errs = append(errs, errors.New("oauth-code-ttl, oauth-access-token-ttl and oauth-refresh-token-ttl must be positive"))
+	}
+	names := map[string]bool{}
+	for _, provider := range c.OIDC {
+		if provider.Name == "" || provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			errs = append(errs, errors.New("oidc-providers need a name, issuer, client_id and redirect_url"))
+		}
+		if names[provider.Name] {
+			errs = append(errs, fmt.Errorf("oidc-providers: %q is listed twice", provider.Name))
+		}
+		names[provider.Name] = true
+	}
+	if c.Webhooks.PollInterval <= 0 || c.Webhooks.Timeout <= 0 || c.Webhooks.RetryBackoff <= 0 {
+		errs = append(errs, errors.New("webhook-poll-interval, webhook-timeout and webhook-retry-backoff must be positive"))
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		errs = append(errs, errors.New("webhook-max-attempts must be at least 1"))
+	}
+	if c.Jobs.Workers < 1 {
+		errs = append(errs, errors.New("job-workers must be at least 1"))
+	}
+	if c.Jobs.PollInterval <= 0 || c.Jobs.RetryBackoff <= 0 || c.Jobs.Lease <= 0 || c.Jobs.Retention <= 0 {
+		errs = append(errs, errors.New("job-poll-interval, job-retry-backoff, job-lease and job-retention must be positive"))
+	}
+	if c.Jobs.MaxAttempts < 1 {
+		errs = append(errs, errors.New("job-max-attempts must be at least 1"))
+	}
+	if c.SMTP.Addr != "" {
+		if _, err := mail.ParseAddress(c.SMTP.From); err != nil {
+			errs = append(errs, fmt.Errorf("smtp-from must be an email address: %w", err))
+		}
+	}
+	if c.Workouts.TrashRetention <= 0 {
+		errs = append(errs, errors.New("trash-retention must be positive"))
+	}
+	if c.Workouts.IdempotencyWindow <= 0 {
+		errs = append(errs, errors.New("idempotency-window must be positive"))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func lookup(name string) (setting, bool) {
+	for _, s := range settings {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func stringSetter(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func intSetter(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func floatSetter(field func(*Config) *float64) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func durationSetter(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func boolSetter(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+// policySetter parses "requests/period", e.g. "10/15m".
+func policySetter(field func(*Config) *RateLimitPolicy) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		requests, period, ok := strings.Cut(value, "/")
+		if !ok {
+			return fmt.Errorf("expected requests/period, got %q", value)
+		}
+		parsedRequests, err := strconv.Atoi(requests)
+		if err != nil {
+			return err
+		}
+		parsedPeriod, err := time.ParseDuration(period)
+		if err != nil {
+			return err
+		}
+		*field(c) = RateLimitPolicy{Requests: parsedRequests, Period: parsedPeriod}
+		return nil
+	}
+}
+
+// durationMapSetter parses comma separated name=duration pairs into the map.
+func durationMapSetter(field func(*Config) map[string]time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		for _, pair := range strings.Split(value, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			name, duration, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("expected name=duration, got %q", pair)
+			}
+			parsed, err := time.ParseDuration(strings.TrimSpace(duration))
+			if err != nil {
+				return err
+			}
+			field(c)[strings.TrimSpace(name)] = parsed
+		}
+		return nil
+	}
+}
+
+// jsonSetter parses a JSON document into the field. Lists in the config
+// file are passed through as JSON.
+func jsonSetter(field func(*Config) interface{}) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		return json.Unmarshal([]byte(value), field(c))
+	}
+}
+
+// joinPairs flattens a JSON object from the config file into the
+// name=value,name=value form that map settings parse.
+func joinPairs(object map[string]interface{}) string {
+	pairs := make([]string, 0, len(object))
+	for key, value := range object {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// rawValue records a flag's text so it can be applied after the config
+// file and environment.
+type rawValue struct {
+	value string
+}
+
+func (v *rawValue) String() string {
+	return v.value
+}
+
+func (v *rawValue) Set(value string) error {
+	v.value = value
+	return nil
+}
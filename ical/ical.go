@@ -0,0 +1,123 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineOctets is the longest a content line may be before it is folded
+// (RFC 5545, section 3.1).
+const maxLineOctets = 75
+
+const dateTimeFormat = "20060102T150405Z"
+
+// Calendar is an iCalendar object holding events, published as a feed
+// calendar apps subscribe to.
+type Calendar struct {
+	ProdId string
+	Name   string
+	// RefreshInterval suggests how often subscribers fetch the feed again
+	RefreshInterval time.Duration
+	Events          []Event
+}
+
+// Event is a VEVENT. Uid must stay the same for as long as the event
+// exists, so calendar apps update the event when it changes instead of
+// adding another.
+type Event struct {
+	Uid          string
+	Stamp        time.Time
+	LastModified time.Time
+	Start        time.Time
+	End          time.Time
+	Summary      string
+	Description  string
+}
+
+// Encode writes the calendar in the iCalendar format: CRLF line endings,
+// long lines folded and times in UTC.
+func (c *Calendar) Encode(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(out, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", c.ProdId)
+	line("CALSCALE", "GREGORIAN")
+	if c.Name != "" {
+		line("NAME", EscapeText(c.Name))
+		line("X-WR-CALNAME", EscapeText(c.Name))
+	}
+	if c.RefreshInterval > 0 {
+		line("REFRESH-INTERVAL;VALUE=DURATION", formatDuration(c.RefreshInterval))
+		line("X-PUBLISHED-TTL", formatDuration(c.RefreshInterval))
+	}
+	for _, event := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", event.Uid)
+		line("DTSTAMP", formatTime(event.Stamp))
+		if !event.LastModified.IsZero() {
+			line("LAST-MODIFIED", formatTime(event.LastModified))
+		}
+		line("DTSTART", formatTime(event.Start))
+		line("DTEND", formatTime(event.End))
+		line("SUMMARY", EscapeText(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION", EscapeText(event.Description))
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return out.Flush()
+}
+
+// EscapeText escapes a TEXT value: backslashes, semicolons, commas and
+// line breaks.
+func EscapeText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", `\n`)
+	return replacer.Replace(text)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(dateTimeFormat)
+}
+
+// formatDuration formats a duration of whole minutes or more, e.g. PT1H30M.
+func formatDuration(d time.Duration) string {
+	hours := int(d / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	value := "PT"
+	if hours > 0 {
+		value += strconv.Itoa(hours) + "H"
+	}
+	if minutes > 0 || hours == 0 {
+		value += strconv.Itoa(minutes) + "M"
+	}
+	return value
+}
+
+// writeFolded writes a content line, breaking it every 75 octets with a
+// CRLF and a space, and never inside a UTF-8 character.
+func writeFolded(out *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		out.WriteString(line[:cut])
+		out.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space counts towards the continuation line
+		limit = maxLineOctets - 1
+	}
+	out.WriteString(line)
+	out.WriteString("\r\n")
+}
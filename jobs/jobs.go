@@ -0,0 +1,187 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+	"workout-tracker/backoff"
+	"workout-tracker/config"
+	"workout-tracker/store"
+)
+
+// maxBackoff caps the delay between retries of a job.
+const maxBackoff = time.Hour
+
+// outcomeTimeout bounds recording the outcome of a job.
+const outcomeTimeout = 10 * time.Second
+
+// Handler runs a job. A returned error, or a panic, fails the attempt.
+type Handler func(ctx context.Context, job *store.Job) error
+
+// schedule enqueues a job of kind once every interval.
+type schedule struct {
+	kind     string
+	interval time.Duration
+	lastSlot time.Time
+}
+
+// Runner runs queued jobs with a pool of workers. Each worker claims one
+// due job at a time with SKIP LOCKED, so any number of runners can share
+// the queue.
+type Runner struct {
+	store        store.JobStore
+	handlers     map[string]Handler
+	schedules    []*schedule
+	workers      int
+	pollInterval time.Duration
+	maxAttempts  int
+	retryBackoff time.Duration
+	lease        time.Duration
+	logger       *slog.Logger
+}
+
+func NewRunner(jobStore store.JobStore, cfg config.JobConfig, logger *slog.Logger) *Runner {
+	return &Runner{
+		store:        jobStore,
+		handlers:     map[string]Handler{},
+		workers:      cfg.Workers,
+		pollInterval: cfg.PollInterval,
+		maxAttempts:  cfg.MaxAttempts,
+		retryBackoff: cfg.RetryBackoff,
+		lease:        cfg.Lease,
+		logger:       logger,
+	}
+}
+
+// Register sets the handler of a kind of job. Jobs of kinds without a
+// handler are dead-lettered.
+func (rn *Runner) Register(kind string, handler Handler) {
+	rn.handlers[kind] = handler
+}
+
+// Every enqueues a job of kind at the start of every interval, counted
+// from the Unix epoch. The job's unique key names the interval, so runners
+// on several instances enqueue it once between them.
+func (rn *Runner) Every(kind string, interval time.Duration) {
+	rn.schedules = append(rn.schedules, &schedule{kind: kind, interval: interval})
+}
+
+// Run polls for jobs until ctx is cancelled, then waits for the jobs being
+// run to finish.
+func (rn *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < rn.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rn.work(ctx)
+		}()
+	}
+	if len(rn.schedules) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rn.schedule(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (rn *Runner) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		jobs, err := rn.store.ClaimJobs(ctx, 1, rn.lease)
+		if err != nil && ctx.Err() == nil {
+			rn.logger.ErrorContext(ctx, "failed to claim jobs", "error", err)
+		}
+		if len(jobs) == 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(rn.pollInterval):
+			}
+			continue
+		}
+		// A job that started is given its lease to finish, even on shutdown
+		jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rn.lease)
+		rn.RunJob(jobCtx, &jobs[0])
+		cancel()
+	}
+}
+
+// RunJob runs a claimed job and records the outcome: done, retried after
+// a backoff, or dead-lettered once it used up its attempts.
+func (rn *Runner) RunJob(ctx context.Context, job *store.Job) {
+	logger := rn.logger.With("job_id", job.Id, "kind", job.Kind, "attempt", job.Attempts)
+
+	var err error
+	handler, ok := rn.handlers[job.Kind]
+	if ok {
+		err = rn.call(ctx, handler, job)
+	} else {
+		err = fmt.Errorf("no handler for jobs of kind %q", job.Kind)
+	}
+
+	// The outcome is recorded even if the handler used up the job's context
+	outcomeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), outcomeTimeout)
+	defer cancel()
+	var recorded bool
+	switch {
+	case err == nil:
+		recorded, err = rn.store.CompleteJob(outcomeCtx, job)
+	case !ok || job.Attempts >= rn.maxAttempts:
+		logger.ErrorContext(ctx, "job failed for good", "error", err)
+		recorded, err = rn.store.BuryJob(outcomeCtx, job, err.Error())
+	default:
+		logger.WarnContext(ctx, "job failed, will retry", "error", err)
+		recorded, err = rn.store.RetryJob(outcomeCtx, job, time.Now().Add(Backoff(job.Attempts, rn.retryBackoff)), err.Error())
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to record job outcome", "error", err)
+	} else if !recorded {
+		logger.WarnContext(ctx, "job outcome not recorded, its lease ran out and it was claimed again")
+	}
+}
+
+// call runs the handler, turning a panic into an error so it fails only
+// the job.
+func (rn *Runner) call(ctx context.Context, handler Handler, job *store.Job) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("job panicked: %v", recovered)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+func (rn *Runner) schedule(ctx context.Context) {
+	for {
+		now := time.Now()
+		for _, s := range rn.schedules {
+			slot := now.Truncate(s.interval)
+			if slot.Equal(s.lastSlot) {
+				continue
+			}
+			key := fmt.Sprintf("%s@%d", s.kind, slot.Unix())
+			_, err := rn.store.EnqueueJob(ctx, &store.Job{Kind: s.kind, Payload: []byte("{}"), RunAt: slot, UniqueKey: &key})
+			if err != nil {
+				if ctx.Err() == nil {
+					rn.logger.ErrorContext(ctx, "failed to schedule job", "kind", s.kind, "error", err)
+				}
+				continue
+			}
+			s.lastSlot = slot
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rn.pollInterval):
+		}
+	}
+}
+
+// Backoff is how long to wait before retrying after the given failed
+// attempt, starting at one: base, doubling with every further attempt.
+func Backoff(attempt int, base time.Duration) time.Duration {
+	return backoff.Delay(attempt, base, maxBackoff)
+}
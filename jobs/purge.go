@@ -0,0 +1,55 @@
+package jobs
+
+import (
+	"context"
+	"time"
+	"workout-tracker/store"
+)
+
+// KindPurgeHistory jobs delete finished jobs and webhook deliveries older
+// than the retention.
+const KindPurgeHistory = "purge_history"
+
+func PurgeHistory(jobStore store.JobStore, webhookStore store.WebhookStore, retention time.Duration) Handler {
+	return func(ctx context.Context, job *store.Job) error {
+		before := time.Now().Add(-retention)
+		_, err := jobStore.PurgeJobs(ctx, before)
+		if err != nil {
+			return err
+		}
+		_, err = webhookStore.PurgeDeliveries(ctx, before)
+		return err
+	}
+}
+
+// KindPurgeTrash jobs permanently delete workouts that have been in the
+// trash for longer than the retention.
+const KindPurgeTrash = "purge_trash"
+
+func PurgeTrash(workoutStore store.WorkoutStore, retention time.Duration) Handler {
+	return func(ctx context.Context, job *store.Job) error {
+		_, err := workoutStore.PurgeDeletedWorkouts(ctx, time.Now().Add(-retention))
+		return err
+	}
+}
+
+// KindPurgeIdempotencyKeys jobs delete idempotency keys older than the
+// window they are replayed for.
+const KindPurgeIdempotencyKeys = "purge_idempotency_keys"
+
+func PurgeIdempotencyKeys(idempotencyStore store.IdempotencyStore, window time.Duration) Handler {
+	return func(ctx context.Context, job *store.Job) error {
+		_, err := idempotencyStore.PurgeKeys(ctx, time.Now().Add(-window))
+		return err
+	}
+}
+
+// KindPurgeOIDCLogins jobs delete external logins that expired unfinished.
+const KindPurgeOIDCLogins = "purge_oidc_logins"
+
+func PurgeOIDCLogins(identityStore store.IdentityStore) Handler {
+	return func(ctx context.Context, job *store.Job) error {
+		_, err := identityStore.PurgeOIDCLogins(ctx, time.Now())
+		return err
+	}
+}
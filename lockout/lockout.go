@@ -0,0 +1,39 @@
+package lockout
+
+import (
+	"time"
+	"workout-tracker/backoff"
+)
+
+// maxDelay caps the progressive delay so a request never hangs for long.
+const maxDelay = 5 * time.Second
+
+// Policy locks an account for Window once MaxFailures logins have failed
+// within it, and slows each failed login down by BaseDelay, doubling with
+// every consecutive failure.
+type Policy struct {
+	MaxFailures int
+	Window      time.Duration
+	BaseDelay   time.Duration
+}
+
+// Locked reports whether failures within the window lock the account.
+func (p Policy) Locked(failures int) bool {
+	return failures >= p.MaxFailures
+}
+
+// LockedUntil is when a lock lifts, given the times of the failures within
+// the window, oldest first: once so many of them have left the window that
+// fewer than MaxFailures remain. It is the zero time if they do not lock.
+func (p Policy) LockedUntil(failures []time.Time) time.Time {
+	if !p.Locked(len(failures)) {
+		return time.Time{}
+	}
+	return failures[len(failures)-p.MaxFailures].Add(p.Window)
+}
+
+// Delay is how long to wait before answering the given consecutive
+// failure, starting at one.
+func (p Policy) Delay(failures int) time.Duration {
+	return backoff.Delay(failures, p.BaseDelay, maxDelay)
+}
@@ -0,0 +1,121 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey string
+
+const (
+	requestIDKey   = contextKey("request_id")
+	requestInfoKey = contextKey("request_info")
+)
+
+// validRequestID limits client supplied request IDs to something safe to
+// echo back and log.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// requestInfo is filled in by inner handlers and read by AccessLog once the
+// request completes.
+type requestInfo struct {
+	userID int
+	err    error
+}
+
+// RequestID returns the ID of the request ctx belongs to, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// SetUserID records the authenticated user for the access log.
+func SetUserID(ctx context.Context, userID int) {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		info.userID = userID
+	}
+}
+
+// RequestIDMiddleware propagates the caller's X-Request-ID, or generates
+// one, through the request context and echoes it in the response.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// errorRecorder lets the response helpers attach the underlying error of a
+// failed request to its access log entry.
+type errorRecorder struct {
+	chimiddleware.WrapResponseWriter
+	info *requestInfo
+}
+
+func (w *errorRecorder) RecordError(err error) {
+	w.info.err = err
+}
+
+// AccessLog logs one entry per request with its route, status, latency and
+// user. Server errors are logged at error level and client errors at warn.
+func AccessLog(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			info := &requestInfo{}
+			ww := &errorRecorder{WrapResponseWriter: chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor), info: info}
+			ctx := context.WithValue(r.Context(), requestInfoKey, info)
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			}
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				attrs = append(attrs, slog.String("route", rctx.RoutePattern()))
+			}
+			if info.userID != 0 {
+				attrs = append(attrs, slog.Int("user_id", info.userID))
+			}
+			if info.err != nil {
+				attrs = append(attrs, slog.String("error", info.err.Error()))
+			}
+
+			level := slog.LevelInfo
+			switch {
+			case status >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case status >= http.StatusBadRequest:
+				level = slog.LevelWarn
+			}
+			logger.LogAttrs(r.Context(), level, "request completed", attrs...)
+		})
+	}
+}
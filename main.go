@@ -1,37 +1,127 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 	"workout-tracker/app"
+	"workout-tracker/config"
 	"workout-tracker/routes"
+	"workout-tracker/tracing"
 )
 
 func main() {
+	if !run() {
+		os.Exit(1)
+	}
+}
+
+// run serves until a signal or a failed listen, then shuts down. It
+// reports whether the server stopped cleanly, and returns rather than
+// exiting so that the shutdown steps and deferred cleanup still run.
+func run() bool {
+	// Load the configuration from the config file, environment and flags
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		config.PrintUsage(os.Stderr)
+		return true
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	// Install the tracer provider before anything starts spans
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		panic(err)
+	}
+
 	// Create a new application instance
-	application, err := app.NewLog()
+	application, err := app.NewLog(cfg)
 	if err != nil {
 		panic(err)
 	}
 	defer application.Db.Close()
 
 	// Start the application
-	application.Logger.Println("Application started successfully")
+	application.Logger.Info("application started", "addr", cfg.Server.Addr)
 
 	// Set up the routes
 	r := routes.SetupRoutes(application)
 
 	server := &http.Server{
-		Addr:         "localhost:1500",
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		Addr:         cfg.Server.Addr,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
 		Handler:      r,
 	}
 
+	// Stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Run jobs and deliver webhooks in the background until shutdown
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	background.Add(2)
+	go func() {
+		defer background.Done()
+		application.JobRunner.Run(backgroundCtx)
+	}()
+	go func() {
+		defer background.Done()
+		application.WebhookWorker.Run(backgroundCtx)
+	}()
+
 	// Start the HTTP server
-	err = server.ListenAndServe()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	clean := true
+	select {
+	case err = <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			application.Logger.Error("failed to start server", "error", err)
+			clean = false
+		}
+	case <-ctx.Done():
+		stop()
+		application.BeginShutdown()
+
+		// Keep serving while load balancers notice the failing readiness
+		// check, so requests they still send are not refused
+		application.Logger.Info("shutting down, waiting for traffic to stop", "delay", cfg.Server.ShutdownDelay.String())
+		time.Sleep(cfg.Server.ShutdownDelay)
+
+		application.Logger.Info("draining requests", "timeout", cfg.Server.ShutdownTimeout.String())
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		err = server.Shutdown(shutdownCtx)
+		if err != nil {
+			application.Logger.Error("failed to drain requests before shutdown", "error", err)
+		}
+	}
+
+	// Let running jobs and the webhook delivery being sent finish
+	stopBackground()
+	background.Wait()
+
+	// Flush buffered spans before exiting
+	flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	err = shutdownTracing(flushCtx)
 	if err != nil {
-		application.Logger.Fatalf("Failed to start server: %v", err)
+		application.Logger.Error("failed to flush traces", "error", err)
 	}
+	application.Logger.Info("server stopped")
+	return clean
 }
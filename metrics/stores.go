@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"context"
+	"time"
+	"workout-tracker/store"
+)
+
+type workoutStore struct {
+	next store.WorkoutStore
+}
+
+// InstrumentWorkoutStore times every WorkoutStore method.
+func InstrumentWorkoutStore(next store.WorkoutStore) store.WorkoutStore {
+	return &workoutStore{next: next}
+}
+
+func (s *workoutStore) CreateWorkout(ctx context.Context, workout *store.Workout) (created *store.Workout, err error) {
+	defer observeStore("WorkoutStore", "CreateWorkout", time.Now(), &err)
+	return s.next.CreateWorkout(ctx, workout)
+}
+
+func (s *workoutStore) GetWorkoutById(ctx context.Context, id int64) (workout *store.Workout, err error) {
+	defer observeStore("WorkoutStore", "GetWorkoutById", time.Now(), &err)
+	return s.next.GetWorkoutById(ctx, id)
+}
+
+func (s *workoutStore) UpdateWorkout(ctx context.Context, workout *store.Workout, revision *store.WorkoutRevision) (err error) {
+	defer observeStore("WorkoutStore", "UpdateWorkout", time.Now(), &err)
+	return s.next.UpdateWorkout(ctx, workout, revision)
+}
+
+func (s *workoutStore) DeleteWorkout(ctx context.Context, id int64, version int) (err error) {
+	defer observeStore("WorkoutStore", "DeleteWorkout", time.Now(), &err)
+	return s.next.DeleteWorkout(ctx, id, version)
+}
+
+func (s *workoutStore) GetWorkoutOwner(ctx context.Context, id int64) (owner int, err error) {
+	defer observeStore("WorkoutStore", "GetWorkoutOwner", time.Now(), &err)
+	return s.next.GetWorkoutOwner(ctx, id)
+}
+
+func (s *workoutStore) GetDailyActivity(ctx context.Context, userId int, timezone string) (days []store.DailyActivity, err error) {
+	defer observeStore("WorkoutStore", "GetDailyActivity", time.Now(), &err)
+	return s.next.GetDailyActivity(ctx, userId, timezone)
+}
+
+func (s *workoutStore) GetBestOneRepMax(ctx context.Context, userId int, exerciseName string, excludeWorkoutId int64) (best float64, err error) {
+	defer observeStore("WorkoutStore", "GetBestOneRepMax", time.Now(), &err)
+	return s.next.GetBestOneRepMax(ctx, userId, exerciseName, excludeWorkoutId)
+}
+
+func (s *workoutStore) GetWorkoutsSince(ctx context.Context, userId int, since time.Time, limit int) (workouts []store.Workout, err error) {
+	defer observeStore("WorkoutStore", "GetWorkoutsSince", time.Now(), &err)
+	return s.next.GetWorkoutsSince(ctx, userId, since, limit)
+}
+
+func (s *workoutStore) GetDeletedWorkouts(ctx context.Context, userId int, limit int) (workouts []store.Workout, err error) {
+	defer observeStore("WorkoutStore", "GetDeletedWorkouts", time.Now(), &err)
+	return s.next.GetDeletedWorkouts(ctx, userId, limit)
+}
+
+func (s *workoutStore) RestoreWorkout(ctx context.Context, id int64, userId int) (restored bool, err error) {
+	defer observeStore("WorkoutStore", "RestoreWorkout", time.Now(), &err)
+	return s.next.RestoreWorkout(ctx, id, userId)
+}
+
+func (s *workoutStore) PurgeDeletedWorkouts(ctx context.Context, deletedBefore time.Time) (purged int64, err error) {
+	defer observeStore("WorkoutStore", "PurgeDeletedWorkouts", time.Now(), &err)
+	return s.next.PurgeDeletedWorkouts(ctx, deletedBefore)
+}
+
+func (s *workoutStore) GetWorkoutRevisions(ctx context.Context, workoutId int64, limit int) (revisions []store.WorkoutRevision, err error) {
+	defer observeStore("WorkoutStore", "GetWorkoutRevisions", time.Now(), &err)
+	return s.next.GetWorkoutRevisions(ctx, workoutId, limit)
+}
+
+func (s *workoutStore) GetWorkoutRevision(ctx context.Context, workoutId int64, number int) (revision *store.WorkoutRevision, err error) {
+	defer observeStore("WorkoutStore", "GetWorkoutRevision", time.Now(), &err)
+	return s.next.GetWorkoutRevision(ctx, workoutId, number)
+}
+
+type userStore struct {
+	next store.UserStore
+}
+
+// InstrumentUserStore times every UserStore method.
+func InstrumentUserStore(next store.UserStore) store.UserStore {
+	return &userStore{next: next}
+}
+
+func (s *userStore) CreateUser(ctx context.Context, user *store.User) (err error) {
+	defer observeStore("UserStore", "CreateUser", time.Now(), &err)
+	return s.next.CreateUser(ctx, user)
+}
+
+func (s *userStore) GetUserByName(ctx context.Context, username string) (user *store.User, err error) {
+	defer observeStore("UserStore", "GetUserByName", time.Now(), &err)
+	return s.next.GetUserByName(ctx, username)
+}
+
+func (s *userStore) UpdateUser(ctx context.Context, user *store.User) (err error) {
+	defer observeStore("UserStore", "UpdateUser", time.Now(), &err)
+	return s.next.UpdateUser(ctx, user)
+}
+
+func (s *userStore) GetUserToken(ctx context.Context, scope, tokenPlaintextPassword string) (user *store.User, err error) {
+	defer observeStore("UserStore", "GetUserToken", time.Now(), &err)
+	return s.next.GetUserToken(ctx, scope, tokenPlaintextPassword)
+}
+
+func (s *userStore) CreateBodyweightEntry(ctx context.Context, entry *store.BodyweightEntry) (err error) {
+	defer observeStore("UserStore", "CreateBodyweightEntry", time.Now(), &err)
+	return s.next.CreateBodyweightEntry(ctx, entry)
+}
+
+func (s *userStore) GetLatestBodyweight(ctx context.Context, userId int) (entry *store.BodyweightEntry, err error) {
+	defer observeStore("UserStore", "GetLatestBodyweight", time.Now(), &err)
+	return s.next.GetLatestBodyweight(ctx, userId)
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+	"workout-tracker/response"
+	"workout-tracker/store"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKey    = 255
+	// idempotencyLease is how long a request may take before a retry with
+	// its key is handled in its place. It is well above the write timeout,
+	// so only requests that died are taken over.
+	idempotencyLease = time.Minute
+)
+
+type Idempotency struct {
+	store  store.IdempotencyStore
+	window time.Duration
+	logger *slog.Logger
+}
+
+// NewIdempotency remembers the response to each request sent with an
+// Idempotency-Key for window, so that retries of it are answered with the
+// same response instead of being handled again.
+func NewIdempotency(store store.IdempotencyStore, window time.Duration, logger *slog.Logger) *Idempotency {
+	return &Idempotency{store: store, window: window, logger: logger}
+}
+
+// idempotencyRecorder passes a response through while keeping a copy of it.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *idempotencyRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *idempotencyRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// RecordError keeps the access log's error recording working through the
+// recorder.
+func (w *idempotencyRecorder) RecordError(err error) {
+	if recorder, ok := w.ResponseWriter.(interface{ RecordError(error) }); ok {
+		recorder.RecordError(err)
+	}
+}
+
+// validIdempotencyKey accepts up to 255 visible ASCII characters.
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKey {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < '!' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Handle makes next idempotent for requests carrying an Idempotency-Key.
+// Keys belong to the authenticated user. A retry with the same body gets
+// the stored response, marked with Idempotent-Replayed; reusing a key for
+// a different request is rejected with 422, and a retry arriving while the
+// first request is still running with 409. Server errors are not stored, so
+// the retry of a failed request is handled again.
+func (i *Idempotency) Handle(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyHeader := r.Header.Get(IdempotencyKeyHeader)
+		user, ok := r.Context().Value(userContextKey).(*store.User)
+		if keyHeader == "" || !ok || user.IsAnonymous() {
+			next(w, r)
+			return
+		}
+		if !validIdempotencyKey(keyHeader) {
+			response.BadRequest(w, "Invalid Idempotency-Key", errors.New("key must be at most 255 visible ASCII characters"))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			response.BadRequest(w, "Failed to read request body", err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.New()
+		hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+		hash.Write(body)
+
+		key := &store.IdempotencyKey{UserId: user.Id, Key: keyHeader, RequestHash: hash.Sum(nil)}
+		now := time.Now()
+		existing, err := i.store.ReserveKey(r.Context(), key, now.Add(-i.window), now.Add(-idempotencyLease))
+		if err != nil {
+			response.InternalServerError(w, "Failed to check Idempotency-Key", err)
+			return
+		}
+		if existing != nil {
+			switch {
+			case !bytes.Equal(existing.RequestHash, key.RequestHash):
+				response.Error(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request", nil)
+			case existing.StatusCode == 0:
+				response.Error(w, http.StatusConflict, "A request with this Idempotency-Key is still being processed", nil)
+			default:
+				w.Header().Set("Content-Type", existing.ContentType)
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(existing.StatusCode)
+				w.Write(existing.Response)
+			}
+			return
+		}
+
+		recorder := &idempotencyRecorder{ResponseWriter: w}
+		next(recorder, r)
+
+		// The response has been sent; failing to store it only costs the
+		// protection against a duplicate. The client may be gone by now, but
+		// its retry still needs the response.
+		ctx := context.WithoutCancel(r.Context())
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status >= http.StatusInternalServerError {
+			err = i.store.ReleaseKey(ctx, key)
+		} else {
+			key.StatusCode = status
+			key.ContentType = recorder.Header().Get("Content-Type")
+			key.Response = recorder.body.Bytes()
+			err = i.store.SaveResponse(ctx, key)
+		}
+		if err != nil {
+			i.logger.ErrorContext(ctx, "failed to store idempotent response", "key", keyHeader, "error", err)
+		}
+	}
+}
@@ -2,21 +2,52 @@ package middleware
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strings"
+	"workout-tracker/logging"
+	"workout-tracker/response"
 	"workout-tracker/store"
 	"workout-tracker/tokens"
 )
 
 type UserMiddleware struct {
-	userStore store.UserStore
+	userStore   store.UserStore
+	apiKeyStore store.APIKeyStore
+	oauthStore  store.OAuthStore
+	admins      map[string]bool
+}
+
+func NewUserMiddleware(userStore store.UserStore, apiKeyStore store.APIKeyStore, oauthStore store.OAuthStore, admins []string) *UserMiddleware {
+	adminSet := make(map[string]bool, len(admins))
+	for _, username := range admins {
+		adminSet[username] = true
+	}
+	return &UserMiddleware{
+		userStore:   userStore,
+		apiKeyStore: apiKeyStore,
+		oauthStore:  oauthStore,
+		admins:      adminSet,
+	}
+}
+
+// delegated is a credential acting for a user with limited scopes, i.e. an
+// API key or an OAuth access token.
+type delegated interface {
+	HasScope(scope string) bool
 }
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey      = contextKey("user")
+	delegatedContextKey = contextKey("delegated")
+)
 
 func SetUser(r *http.Request, user *store.User) *http.Request {
+	if !user.IsAnonymous() {
+		logging.SetUserID(r.Context(), user.Id)
+	}
 	ctx := context.WithValue(r.Context(), userContextKey, user)
 	return r.WithContext(ctx)
 }
@@ -29,6 +60,29 @@ func GetUser(r *http.Request) *store.User {
 	return user
 }
 
+// GetAPIKey returns the API key the request was authenticated with, or nil
+// for other credentials.
+func GetAPIKey(r *http.Request) *store.APIKey {
+	key, _ := r.Context().Value(delegatedContextKey).(*store.APIKey)
+	return key
+}
+
+// GetOAuthToken returns the OAuth access token the request was
+// authenticated with, or nil for other credentials.
+func GetOAuthToken(r *http.Request) *store.OAuthToken {
+	token, _ := r.Context().Value(delegatedContextKey).(*store.OAuthToken)
+	return token
+}
+
+func setDelegated(r *http.Request, credential delegated) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), delegatedContextKey, credential))
+}
+
+func getDelegated(r *http.Request) delegated {
+	credential, _ := r.Context().Value(delegatedContextKey).(delegated)
+	return credential
+}
+
 func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
@@ -46,7 +100,15 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 		token := headerParts[1]
-		user, err := um.userStore.GetUserToken(tokens.ScopeAuth, token)
+		if tokens.IsAPIKey(token) {
+			um.authenticateAPIKey(w, r, next, token)
+			return
+		}
+		if tokens.IsAccessToken(token) {
+			um.authenticateAccessToken(w, r, next, token)
+			return
+		}
+		user, err := um.userStore.GetUserToken(r.Context(), tokens.ScopeAuth, token)
 		if err != nil {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
@@ -60,3 +122,86 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 		return
 	})
 }
+
+func (um *UserMiddleware) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, plainText string) {
+	user, key, err := um.apiKeyStore.GetUserByAPIKey(r.Context(), plainText)
+	if err != nil {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return
+	}
+	if user == nil {
+		http.Error(w, "Invalid or expired API key", http.StatusUnauthorized)
+		return
+	}
+	r = SetUser(r, user)
+	next.ServeHTTP(w, setDelegated(r, key))
+}
+
+func (um *UserMiddleware) authenticateAccessToken(w http.ResponseWriter, r *http.Request, next http.Handler, plainText string) {
+	user, token, err := um.oauthStore.GetUserByAccessToken(r.Context(), plainText)
+	if err != nil {
+		http.Error(w, "Invalid access token", http.StatusUnauthorized)
+		return
+	}
+	if user == nil {
+		http.Error(w, "Invalid or expired access token", http.StatusUnauthorized)
+		return
+	}
+	r = SetUser(r, user)
+	next.ServeHTTP(w, setDelegated(r, token))
+}
+
+// RequireUser only admits logged in users. API keys and OAuth tokens are
+// refused, so routes have to opt in to them with RequireUserScope.
+func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+		if user.IsAnonymous() {
+			response.Unauthorized(w, "You must be logged in to access this route")
+			return
+		}
+		if getDelegated(r) != nil {
+			response.Forbidden(w, "API keys and OAuth tokens cannot access this route")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAdmin admits logged in users listed in admin-users. Like
+// RequireUser, it refuses API keys and OAuth tokens.
+func (um *UserMiddleware) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		if !um.admins[GetUser(r).UserName] {
+			response.Forbidden(w, "Only administrators can access this route")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireUserScope admits logged in users, and API keys and OAuth tokens
+// granted scope.
+func (um *UserMiddleware) RequireUserScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+		if user.IsAnonymous() {
+			response.Unauthorized(w, "You must be logged in to access this route")
+			return
+		}
+		um.RequireScope(scope, next).ServeHTTP(w, r)
+	})
+}
+
+// RequireScope refuses API keys and OAuth tokens that were not granted
+// scope. Session tokens and anonymous requests are left to the handler.
+func (um *UserMiddleware) RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credential := getDelegated(r)
+		if credential != nil && !credential.HasScope(scope) {
+			response.Forbidden(w, fmt.Sprintf("This credential lacks the %s scope", scope))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
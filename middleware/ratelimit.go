@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"workout-tracker/metrics"
+	"workout-tracker/ratelimit"
+	"workout-tracker/response"
+	"workout-tracker/store"
+)
+
+// KeyFunc identifies the client a request counts against.
+type KeyFunc func(r *http.Request) string
+
+type RateLimiter struct {
+	store      ratelimit.Store
+	trustProxy bool
+	logger     *slog.Logger
+}
+
+// NewRateLimiter limits requests using buckets kept in store; a nil store
+// disables limiting. With trustProxy the client address is taken from the
+// X-Forwarded-For header set by the reverse proxy.
+func NewRateLimiter(store ratelimit.Store, trustProxy bool, logger *slog.Logger) *RateLimiter {
+	return &RateLimiter{store: store, trustProxy: trustProxy, logger: logger}
+}
+
+// ClientIP returns the address the request came from.
+func (rl *RateLimiter) ClientIP(r *http.Request) string {
+	if rl.trustProxy {
+		// The last hop was appended by our proxy; earlier ones are client
+		// supplied and can be spoofed.
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			hops := strings.Split(forwarded, ",")
+			return strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ByIP counts requests per client address.
+func (rl *RateLimiter) ByIP(r *http.Request) string {
+	return "ip:" + rl.ClientIP(r)
+}
+
+// ByUser counts requests per authenticated user, and per address for
+// anonymous requests.
+func (rl *RateLimiter) ByUser(r *http.Request) string {
+	user, ok := r.Context().Value(userContextKey).(*store.User)
+	if !ok || user.IsAnonymous() {
+		return rl.ByIP(r)
+	}
+	return "user:" + strconv.Itoa(user.Id)
+}
+
+// Limit rejects requests beyond the policy with 429 Too Many Requests. Every
+// response carries the RateLimit headers; rejections also carry Retry-After.
+func (rl *RateLimiter) Limit(policy ratelimit.Policy, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if rl.store == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := rl.store.Take(r.Context(), policy.Name+":"+key(r), policy, time.Now())
+			if err != nil {
+				// Fail open: an unavailable store must not take the API down
+				rl.logger.ErrorContext(r.Context(), "rate limit check failed", "policy", policy.Name, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Requests, seconds(policy.Period)))
+			header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+			if !result.Allowed {
+				header.Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+				metrics.RateLimited.WithLabelValues(policy.Name).Inc()
+				response.TooManyRequests(w, "Too many requests, please try again later")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds d up to whole seconds, as the headers require.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
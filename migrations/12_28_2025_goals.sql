@@ -0,0 +1,32 @@
+-- +goose up
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS bodyweight_entries (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    weight DECIMAL(5,2) NOT NULL,
+    recorded_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS goals (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    goal_type TEXT NOT NULL,
+    exercise_name VARCHAR(255),
+    target_value DECIMAL(12,2) NOT NULL,
+    deadline TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_goal_type CHECK (goal_type IN ('one_rep_max', 'weekly_workouts', 'monthly_volume', 'bodyweight')),
+    CONSTRAINT one_rep_max_requires_exercise CHECK (goal_type <> 'one_rep_max' OR exercise_name IS NOT NULL)
+);
+-- +goose statementend
+
+-- +goose down
+-- +goose statementbegin
+DROP TABLE goals;
+-- +goose statementend
+
+-- +goose statementbegin
+DROP TABLE bodyweight_entries;
+-- +goose statementend
@@ -0,0 +1,10 @@
+-- +goose up
+-- +goose statementbegin
+ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+ALTER TABLE users DROP COLUMN timezone;
+-- +goose statementend
@@ -0,0 +1,52 @@
+-- +goose up
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS exercises (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    met_value DECIMAL(4,1) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE UNIQUE INDEX IF NOT EXISTS exercises_name_idx ON exercises (LOWER(name));
+-- +goose statementend
+
+-- +goose statementbegin
+INSERT INTO exercises (name, met_value) VALUES
+    ('Squats', 5.0),
+    ('Deadlift', 6.0),
+    ('Bench Press', 3.5),
+    ('Overhead Press', 3.5),
+    ('Barbell Row', 3.5),
+    ('Leg Press', 5.0),
+    ('Lat Pulldown', 3.5),
+    ('Bicep Curls', 3.5),
+    ('Lunges', 4.0),
+    ('Push-ups', 3.8),
+    ('Pull-ups', 8.0),
+    ('Dips', 3.8),
+    ('Plank', 3.0),
+    ('Burpees', 8.0),
+    ('Jump Rope', 12.3),
+    ('Running', 9.8),
+    ('Walking', 3.5),
+    ('Cycling', 7.5),
+    ('Rowing', 7.0),
+    ('Swimming', 6.0)
+ON CONFLICT DO NOTHING;
+-- +goose statementend
+
+-- +goose statementbegin
+ALTER TABLE workout ADD COLUMN calories_estimated BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+ALTER TABLE workout DROP COLUMN calories_estimated;
+-- +goose statementend
+
+-- +goose statementbegin
+DROP TABLE exercises;
+-- +goose statementend
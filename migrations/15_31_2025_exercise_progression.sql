@@ -0,0 +1,36 @@
+-- +goose up
+-- +goose statementbegin
+ALTER TABLE exercises
+    ADD COLUMN weight_increment DECIMAL(5,2) NOT NULL DEFAULT 2.5,
+    ADD COLUMN target_reps INTEGER NOT NULL DEFAULT 8;
+-- +goose statementend
+
+-- +goose statementbegin
+UPDATE exercises SET weight_increment = 5.0, target_reps = 5 WHERE name IN ('Squats', 'Deadlift');
+-- +goose statementend
+
+-- +goose statementbegin
+UPDATE exercises SET weight_increment = 10.0, target_reps = 10 WHERE name = 'Leg Press';
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS user_exercise_settings (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    exercise_id BIGINT NOT NULL REFERENCES exercises(id) ON DELETE CASCADE,
+    weight_increment DECIMAL(5,2) NOT NULL,
+    rounding DECIMAL(5,2) NOT NULL,
+    target_reps INTEGER NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, exercise_id)
+);
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+DROP TABLE user_exercise_settings;
+-- +goose statementend
+
+-- +goose statementbegin
+ALTER TABLE exercises DROP COLUMN weight_increment, DROP COLUMN target_reps;
+-- +goose statementend
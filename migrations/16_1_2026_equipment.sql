@@ -0,0 +1,35 @@
+-- +goose up
+-- +goose statementbegin
+ALTER TABLE exercises ADD COLUMN equipment TEXT NOT NULL DEFAULT 'barbell';
+-- +goose statementend
+
+-- +goose statementbegin
+UPDATE exercises SET equipment = 'dumbbell' WHERE name IN ('Bicep Curls', 'Lunges');
+-- +goose statementend
+
+-- +goose statementbegin
+UPDATE exercises SET equipment = 'machine' WHERE name IN ('Leg Press', 'Lat Pulldown');
+-- +goose statementend
+
+-- +goose statementbegin
+UPDATE exercises SET equipment = 'bodyweight'
+WHERE name IN ('Push-ups', 'Pull-ups', 'Dips', 'Plank', 'Burpees', 'Jump Rope', 'Running', 'Walking', 'Cycling', 'Rowing', 'Swimming');
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS user_equipment (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    profile JSONB NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+DROP TABLE user_equipment;
+-- +goose statementend
+
+-- +goose statementbegin
+ALTER TABLE exercises DROP COLUMN equipment;
+-- +goose statementend
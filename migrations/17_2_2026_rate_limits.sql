@@ -0,0 +1,18 @@
+-- +goose up
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_updated_at ON rate_limit_buckets(updated_at);
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+DROP TABLE rate_limit_buckets;
+-- +goose statementend
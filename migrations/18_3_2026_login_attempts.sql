@@ -0,0 +1,22 @@
+-- +goose up
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    outcome TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    attempted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE INDEX IF NOT EXISTS idx_login_attempts_username ON login_attempts(username, attempted_at);
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+DROP TABLE login_attempts;
+-- +goose statementend
@@ -0,0 +1,33 @@
+-- +goose up
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    totp_secret TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE
+);
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+DROP TABLE mfa_recovery_codes;
+-- +goose statementend
+
+-- +goose statementbegin
+DROP TABLE user_mfa;
+-- +goose statementend
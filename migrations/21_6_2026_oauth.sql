@@ -0,0 +1,53 @@
+-- +goose up
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id TEXT PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    secret_hash BYTEA,
+    redirect_uris TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS oauth_codes (
+    hash BYTEA PRIMARY KEY,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS oauth_tokens (
+    hash BYTEA PRIMARY KEY,
+    grant_id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    scopes TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE INDEX IF NOT EXISTS idx_oauth_tokens_grant_id ON oauth_tokens(grant_id);
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+DROP TABLE oauth_tokens;
+-- +goose statementend
+
+-- +goose statementbegin
+DROP TABLE oauth_codes;
+-- +goose statementend
+
+-- +goose statementbegin
+DROP TABLE oauth_clients;
+-- +goose statementend
@@ -0,0 +1,31 @@
+-- +goose up
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, subject)
+);
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS oidc_logins (
+    state_hash BYTEA PRIMARY KEY,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+DROP TABLE oidc_logins;
+-- +goose statementend
+
+-- +goose statementbegin
+DROP TABLE user_identities;
+-- +goose statementend
@@ -0,0 +1,49 @@
+-- +goose up
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS reminders (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    days TEXT NOT NULL DEFAULT '',
+    time_of_day TEXT NOT NULL,
+    timezone TEXT NOT NULL,
+    inactive_days INTEGER NOT NULL DEFAULT 0,
+    channels TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_fired_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE INDEX IF NOT EXISTS idx_reminders_next_run_at ON reminders(next_run_at) WHERE active;
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    data JSONB,
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, created_at);
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+DROP TABLE notifications;
+-- +goose statementend
+
+-- +goose statementbegin
+DROP TABLE reminders;
+-- +goose statementend
@@ -0,0 +1,15 @@
+-- +goose up
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    hash BYTEA NOT NULL UNIQUE,
+    last_fetched_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+DROP TABLE calendar_feeds;
+-- +goose statementend
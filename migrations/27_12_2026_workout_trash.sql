@@ -0,0 +1,18 @@
+-- +goose up
+-- +goose statementbegin
+ALTER TABLE workout ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE INDEX IF NOT EXISTS idx_workout_deleted_at ON workout(deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+DROP INDEX IF EXISTS idx_workout_deleted_at;
+-- +goose statementend
+
+-- +goose statementbegin
+ALTER TABLE workout DROP COLUMN deleted_at;
+-- +goose statementend
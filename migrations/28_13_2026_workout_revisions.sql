@@ -0,0 +1,50 @@
+-- +goose up
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS workout_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    workout_id BIGINT NOT NULL REFERENCES workout(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    action TEXT NOT NULL,
+    reverted_from INTEGER,
+    changes JSONB NOT NULL DEFAULT '{}',
+    entries JSONB NOT NULL DEFAULT '[]',
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (workout_id, revision)
+);
+-- +goose statementend
+
+-- +goose statementbegin
+-- Existing workouts start their history at their current state
+INSERT INTO workout_revisions (workout_id, revision, user_id, action, snapshot, created_at)
+SELECT w.id, 1, w.user_id, 'created',
+    jsonb_build_object(
+        'title', w.title,
+        'description', COALESCE(w.description, ''),
+        'duration', w.duration,
+        'calories_burned', w.calories_burned,
+        'calories_estimated', w.calories_estimated,
+        'entries', COALESCE((
+            SELECT jsonb_agg(jsonb_build_object(
+                'id', e.id,
+                'exercise_name', e.exercise_name,
+                'sets', e.sets,
+                'reps', e.reps,
+                'duration_seconds', e.duration_seconds,
+                'weight', e.weight,
+                'notes', COALESCE(e.notes, ''),
+                'order_index', e.order_index
+            ) ORDER BY e.order_index)
+            FROM workout_entries e WHERE e.workout_id = w.id
+        ), '[]'::jsonb)
+    ),
+    COALESCE(w.updated_at, w.created_at, CURRENT_TIMESTAMP)
+FROM workout w;
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+DROP TABLE workout_revisions;
+-- +goose statementend
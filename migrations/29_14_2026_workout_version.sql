@@ -0,0 +1,10 @@
+-- +goose up
+-- +goose statementbegin
+ALTER TABLE workout ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+ALTER TABLE workout DROP COLUMN version;
+-- +goose statementend
@@ -0,0 +1,18 @@
+-- +goose up
+-- +goose statementbegin
+ALTER TABLE oidc_logins ADD COLUMN user_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
+-- +goose statementend
+
+-- +goose statementbegin
+CREATE INDEX IF NOT EXISTS idx_oidc_logins_expires_at ON oidc_logins(expires_at);
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+DROP INDEX IF EXISTS idx_oidc_logins_expires_at;
+-- +goose statementend
+
+-- +goose statementbegin
+ALTER TABLE oidc_logins DROP COLUMN user_id;
+-- +goose statementend
@@ -0,0 +1,12 @@
+-- +goose up
+-- +goose statementbegin
+CREATE TABLE IF NOT EXISTS login_locks (
+    username VARCHAR(255) PRIMARY KEY
+);
+-- +goose statementend
+
+
+-- +goose down
+-- +goose statementbegin
+DROP TABLE login_locks;
+-- +goose statementend
@@ -0,0 +1,150 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+	"workout-tracker/config"
+	"workout-tracker/store"
+)
+
+// sendTimeout bounds sending one mail, in case the job's context allows
+// longer.
+const sendTimeout = 30 * time.Second
+
+// SendMailFunc has the signature of smtp.SendMail plus a context, so tests
+// can capture the messages instead.
+type SendMailFunc func(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+
+// Email mails notifications to the user's address.
+type Email struct {
+	cfg      config.SMTPConfig
+	sendMail SendMailFunc
+}
+
+func NewEmail(cfg config.SMTPConfig, sendMail SendMailFunc) *Email {
+	if sendMail == nil {
+		sendMail = SendMail
+	}
+	return &Email{cfg: cfg, sendMail: sendMail}
+}
+
+func (n *Email) Notify(ctx context.Context, job *store.NotificationJob) error {
+	if job.Email == "" {
+		return errors.New("user has no email address")
+	}
+	from, err := mail.ParseAddress(n.cfg.From)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(job.Email)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if n.cfg.Username != "" {
+		host, _, err := net.SplitHostPort(n.cfg.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, host)
+	}
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	return n.sendMail(ctx, n.cfg.Addr, auth, from.Address, []string{to.Address}, message(from, to, job))
+}
+
+// SendMail works like smtp.SendMail, which has no timeouts, but gives up
+// once ctx is done, even when the server stops answering halfway.
+func SendMail(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return err
+		}
+	}
+	// Unblocks reads and writes when ctx is cancelled before its deadline
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		err = c.Auth(auth)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.Mail(from)
+	if err != nil {
+		return err
+	}
+	for _, addr := range to {
+		err = c.Rcpt(addr)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message builds a plain text mail. The subject comes from user input, so
+// line breaks are dropped before it goes into a header.
+func message(from, to *mail.Address, job *store.NotificationJob) []byte {
+	subject := strings.Join(strings.Fields(job.Notification.Title), " ")
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", to.String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@%s>\r\n", job.Key, from.Address[strings.LastIndex(from.Address, "@")+1:])
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(job.Notification.Body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	return msg.Bytes()
+}
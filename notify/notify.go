@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"workout-tracker/store"
+)
+
+// Channels notifications can be sent through.
+const (
+	ChannelInApp   = "in_app"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// Notifier sends a notification through one channel. A returned error
+// fails the send job, which is retried.
+type Notifier interface {
+	Notify(ctx context.Context, job *store.NotificationJob) error
+}
+
+// Dispatcher sends notification jobs to the notifier of their channel.
+type Dispatcher struct {
+	notifiers map[string]Notifier
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{notifiers: map[string]Notifier{}}
+}
+
+// Register sets the notifier of a channel. Only registered channels are
+// offered to users.
+func (d *Dispatcher) Register(channel string, notifier Notifier) {
+	d.notifiers[channel] = notifier
+}
+
+// Channels returns the registered channels, sorted.
+func (d *Dispatcher) Channels() []string {
+	channels := make([]string, 0, len(d.notifiers))
+	for channel := range d.notifiers {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// HandleSendNotification returns the job handler for JobSendNotification
+// jobs.
+func (d *Dispatcher) HandleSendNotification() func(context.Context, *store.Job) error {
+	return func(ctx context.Context, job *store.Job) error {
+		var send store.NotificationJob
+		err := json.Unmarshal(job.Payload, &send)
+		if err != nil {
+			return err
+		}
+		notifier, ok := d.notifiers[send.Channel]
+		if !ok {
+			return fmt.Errorf("no notifier for channel %q", send.Channel)
+		}
+		return notifier.Notify(ctx, &send)
+	}
+}
+
+// InApp keeps notifications in the user's inbox.
+type InApp struct {
+	store store.NotificationStore
+}
+
+func NewInApp(notificationStore store.NotificationStore) *InApp {
+	return &InApp{store: notificationStore}
+}
+
+func (n *InApp) Notify(ctx context.Context, job *store.NotificationJob) error {
+	notification := job.Notification
+	notification.UserId = job.UserId
+	return n.store.CreateNotification(ctx, &notification)
+}
@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"context"
+	"time"
+	"workout-tracker/store"
+	"workout-tracker/webhooks"
+)
+
+// Webhook publishes notifications as reminder.triggered events to the
+// user's webhook subscriptions.
+type Webhook struct {
+	publisher *webhooks.Publisher
+}
+
+func NewWebhook(publisher *webhooks.Publisher) *Webhook {
+	return &Webhook{publisher: publisher}
+}
+
+func (n *Webhook) Notify(ctx context.Context, job *store.NotificationJob) error {
+	// The event id derives from the key so a retried job publishes nothing new
+	event := &webhooks.Event{
+		Id:        "evt_" + job.Key,
+		Type:      webhooks.EventReminder,
+		CreatedAt: time.Now().UTC(),
+		Data: map[string]interface{}{
+			"type":  job.Notification.Type,
+			"title": job.Notification.Title,
+			"body":  job.Notification.Body,
+			"data":  job.Notification.Data,
+		},
+	}
+	return n.publisher.Publish(ctx, job.UserId, event)
+}
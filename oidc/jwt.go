@@ -0,0 +1,286 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// leeway tolerates clock drift between us and the provider.
+const leeway = time.Minute
+
+// keyRefreshInterval limits how often an unknown key ID makes us fetch the
+// provider's keys again.
+const keyRefreshInterval = time.Minute
+
+// Claims are the ID token claims used to log in.
+type Claims struct {
+	Issuer          string    `json:"iss"`
+	Subject         string    `json:"sub"`
+	Audience        audience  `json:"aud"`
+	AuthorizedParty string    `json:"azp"`
+	Expiry          int64     `json:"exp"`
+	IssuedAt        int64     `json:"iat"`
+	Nonce           string    `json:"nonce"`
+	Email           string    `json:"email"`
+	EmailVerified   boolClaim `json:"email_verified"`
+}
+
+// audience is a single string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	err := json.Unmarshal(data, &list)
+	*a = list
+	return err
+}
+
+func (a audience) contains(value string) bool {
+	for _, entry := range a {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+// boolClaim accepts true as well as "true", which some providers send for
+// email_verified.
+type boolClaim bool
+
+func (b *boolClaim) UnmarshalJSON(data []byte) error {
+	var value bool
+	if json.Unmarshal(data, &value) == nil {
+		*b = boolClaim(value)
+		return nil
+	}
+	var text string
+	err := json.Unmarshal(data, &text)
+	*b = boolClaim(text == "true")
+	return err
+}
+
+// validate checks the claims following OpenID Connect Core, section 3.1.3.7.
+func (c *Claims) validate(issuer, clientID, nonce string, now time.Time) error {
+	if c.Issuer != issuer {
+		return fmt.Errorf("ID token was issued by %q", c.Issuer)
+	}
+	if !c.Audience.contains(clientID) {
+		return errors.New("ID token was issued for another client")
+	}
+	if len(c.Audience) > 1 && c.AuthorizedParty != clientID {
+		return errors.New("ID token was authorized for another client")
+	}
+	if c.Subject == "" {
+		return errors.New("ID token has no subject")
+	}
+	if now.After(time.Unix(c.Expiry, 0).Add(leeway)) {
+		return errors.New("ID token has expired")
+	}
+	if time.Unix(c.IssuedAt, 0).After(now.Add(leeway)) {
+		return errors.New("ID token was issued in the future")
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Nonce), []byte(nonce)) != 1 {
+		return errors.New("ID token nonce does not match the login")
+	}
+	return nil
+}
+
+// verifyJWT checks the signature of a compact JWS and decodes its claims.
+// Only RS256 and ES256 are accepted.
+func verifyJWT(ctx context.Context, raw string, keys *keySet) (*Claims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("ID token is not a JWT")
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("ID token header is invalid: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err = json.Unmarshal(headerJSON, &header)
+	if err != nil {
+		return nil, fmt.Errorf("ID token header is invalid: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("ID token signature is invalid: %w", err)
+	}
+
+	key, err := keys.get(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) != nil {
+			return nil, errors.New("ID token signature does not verify")
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(signature) != 64 {
+			return nil, errors.New("ID token signature does not verify")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return nil, errors.New("ID token signature does not verify")
+		}
+	default:
+		return nil, fmt.Errorf("ID token uses unsupported algorithm %q", header.Alg)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("ID token payload is invalid: %w", err)
+	}
+	claims := &Claims{}
+	err = json.Unmarshal(payload, claims)
+	if err != nil {
+		return nil, fmt.Errorf("ID token payload is invalid: %w", err)
+	}
+	return claims, nil
+}
+
+// jwk is a JSON Web Key. Only RSA and P-256 keys are used.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid P-256 coordinates")
+		}
+		// ecdh rejects points that are not on the curve
+		_, err = ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// keySet caches a provider's signing keys, fetching them again when a
+// token names a key we do not know, as happens after key rotation.
+type keySet struct {
+	uri     string
+	getJSON func(ctx context.Context, target string, v interface{}) error
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func newKeySet(uri string, getJSON func(context.Context, string, interface{}) error) *keySet {
+	return &keySet{uri: uri, getJSON: getJSON}
+}
+
+func (ks *keySet) get(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok := ks.find(kid)
+	if ok {
+		return key, nil
+	}
+	if time.Since(ks.fetched) < keyRefreshInterval {
+		return nil, fmt.Errorf("no signing key %q", kid)
+	}
+
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := ks.getJSON(ctx, ks.uri, &document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	ks.keys = map[string]crypto.PublicKey{}
+	ks.fetched = time.Now()
+	for _, k := range document.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		parsed, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		ks.keys[k.Kid] = parsed
+	}
+
+	key, ok = ks.find(kid)
+	if !ok {
+		return nil, fmt.Errorf("no signing key %q", kid)
+	}
+	return key, nil
+}
+
+// find looks a key up by ID. Tokens without a key ID are accepted when the
+// provider publishes exactly one key.
+func (ks *keySet) find(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
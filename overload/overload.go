@@ -0,0 +1,137 @@
+package overload
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	ActionIncrease = "increase"
+	ActionHold     = "hold"
+	ActionDeload   = "deload"
+	ActionAddReps  = "add_reps"
+)
+
+const (
+	// HistorySessions is how many recent sessions a suggestion looks at.
+	HistorySessions = 5
+	// MissesBeforeDeload is how many sessions in a row at the same weight
+	// may miss the target reps before the weight is reduced.
+	MissesBeforeDeload = 3
+
+	deloadFactor = 0.9
+)
+
+// Session is the working set of one exercise in one workout: the heaviest
+// weight used, the fewest reps completed at that weight and the number of
+// sets performed at it. Weight is nil for bodyweight exercises.
+type Session struct {
+	WorkoutId   int       `json:"workout_id"`
+	PerformedAt time.Time `json:"performed_at"`
+	Weight      *float64  `json:"weight"`
+	Reps        int       `json:"reps"`
+	Sets        int       `json:"sets"`
+}
+
+type Settings struct {
+	WeightIncrement float64 `json:"weight_increment"`
+	Rounding        float64 `json:"rounding"`
+	TargetReps      int     `json:"target_reps"`
+}
+
+// Rounder snaps a weight to one the lifter can load, rounding up or down.
+type Rounder func(weight float64, up bool) float64
+
+// StepRounder rounds to multiples of step.
+func StepRounder(step float64) Rounder {
+	return func(weight float64, up bool) float64 {
+		if up {
+			return RoundUp(weight, step)
+		}
+		return RoundDown(weight, step)
+	}
+}
+
+type Suggestion struct {
+	Action      string   `json:"action"`
+	Weight      *float64 `json:"weight"`
+	Reps        int      `json:"reps"`
+	Sets        int      `json:"sets"`
+	Reason      string   `json:"reason"`
+	LastSession Session  `json:"last_session"`
+}
+
+// Suggest returns the next session's target from the recent sessions,
+// newest first, or nil when there is no history. Hitting the target reps
+// adds the weight increment; missing it holds the weight until
+// MissesBeforeDeload misses in a row, after which the weight drops by 10%.
+// New weights are snapped to loadable ones with round.
+func Suggest(sessions []Session, settings Settings, round Rounder) *Suggestion {
+	if len(sessions) == 0 {
+		return nil
+	}
+	last := sessions[0]
+	suggestion := &Suggestion{
+		Reps:        settings.TargetReps,
+		Sets:        last.Sets,
+		LastSession: last,
+	}
+
+	if last.Weight == nil || *last.Weight == 0 {
+		suggestion.Action = ActionAddReps
+		suggestion.Reps = last.Reps + 1
+		suggestion.Reason = "Bodyweight exercise: add a rep to every set"
+		return suggestion
+	}
+
+	if last.Reps >= settings.TargetReps {
+		weight := round(*last.Weight+settings.WeightIncrement, true)
+		suggestion.Action = ActionIncrease
+		suggestion.Weight = &weight
+		suggestion.Reason = fmt.Sprintf("Hit %d reps last session", settings.TargetReps)
+		return suggestion
+	}
+
+	misses := 0
+	for _, session := range sessions {
+		if session.Weight == nil || *session.Weight != *last.Weight || session.Reps >= settings.TargetReps {
+			break
+		}
+		misses++
+	}
+
+	if misses >= MissesBeforeDeload {
+		weight := round(*last.Weight*deloadFactor, false)
+		suggestion.Action = ActionDeload
+		suggestion.Weight = &weight
+		suggestion.Reason = fmt.Sprintf("Missed %d reps in %d sessions in a row", settings.TargetReps, misses)
+		return suggestion
+	}
+
+	weight := *last.Weight
+	suggestion.Action = ActionHold
+	suggestion.Weight = &weight
+	suggestion.Reason = fmt.Sprintf("Missed %d reps last session", settings.TargetReps)
+	return suggestion
+}
+
+// RoundUp rounds weight up to the nearest multiple of step.
+func RoundUp(weight, step float64) float64 {
+	if step <= 0 {
+		return weight
+	}
+	return roundCents(math.Ceil(weight/step-1e-9) * step)
+}
+
+// RoundDown rounds weight down to the nearest multiple of step.
+func RoundDown(weight, step float64) float64 {
+	if step <= 0 {
+		return weight
+	}
+	return roundCents(math.Floor(weight/step+1e-9) * step)
+}
+
+func roundCents(weight float64) float64 {
+	return math.Round(weight*100) / 100
+}
@@ -0,0 +1,378 @@
+package plates
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	EquipmentBarbell  = "barbell"
+	EquipmentDumbbell = "dumbbell"
+	EquipmentMachine  = "machine"
+)
+
+// Limits on an equipment profile. They keep the work of rounding and
+// loading a bar bounded whatever profile a user saves.
+const (
+	maxItems         = 20
+	maxPairs         = 20
+	maxWeight        = 1000
+	minWeight        = 0.01
+	maxDumbbellSteps = 200
+	// maxLoadPerSide is the heaviest load per side, in hundredths, that
+	// LoadBarbell considers.
+	maxLoadPerSide = 500 * 100
+)
+
+type Direction int
+
+const (
+	Nearest Direction = iota
+	Up
+	Down
+)
+
+type Plate struct {
+	Weight float64 `json:"weight"`
+	Pairs  int     `json:"pairs"`
+}
+
+type DumbbellRange struct {
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Step float64 `json:"step"`
+}
+
+type Machine struct {
+	Name      string  `json:"name"`
+	Increment float64 `json:"increment"`
+	MaxWeight float64 `json:"max_weight"`
+}
+
+// Equipment is what a lifter has available. Barbell and plate weights are
+// in the same unit as logged workout weights.
+type Equipment struct {
+	Barbells  []float64       `json:"barbells"`
+	Plates    []Plate         `json:"plates"`
+	Dumbbells []DumbbellRange `json:"dumbbells"`
+	Machines  []Machine       `json:"machines"`
+}
+
+// Loading is how to load a barbell for a target weight.
+type Loading struct {
+	Target  float64   `json:"target"`
+	Weight  float64   `json:"weight"`
+	Bar     float64   `json:"bar"`
+	PerSide []float64 `json:"per_side"`
+	Exact   bool      `json:"exact"`
+}
+
+type WarmupSet struct {
+	Percent int `json:"percent"`
+	Reps    int `json:"reps"`
+	Loading
+}
+
+// warmupSteps is the ladder used before a working set, as percentages of
+// the working weight. Zero percent is the empty bar.
+var warmupSteps = []struct{ percent, reps int }{
+	{0, 10},
+	{40, 5},
+	{60, 3},
+	{80, 2},
+}
+
+// DefaultEquipment is a typical commercial gym, used until the user saves
+// their own profile.
+func DefaultEquipment() *Equipment {
+	return &Equipment{
+		Barbells: []float64{20, 15},
+		Plates: []Plate{
+			{Weight: 25, Pairs: 4},
+			{Weight: 20, Pairs: 4},
+			{Weight: 15, Pairs: 2},
+			{Weight: 10, Pairs: 2},
+			{Weight: 5, Pairs: 2},
+			{Weight: 2.5, Pairs: 2},
+			{Weight: 1.25, Pairs: 2},
+		},
+		Dumbbells: []DumbbellRange{{Min: 2.5, Max: 50, Step: 2.5}},
+	}
+}
+
+func (e *Equipment) Validate() error {
+	if len(e.Barbells) > maxItems || len(e.Plates) > maxItems || len(e.Dumbbells) > maxItems || len(e.Machines) > maxItems {
+		return fmt.Errorf("At most %d barbells, plates, dumbbell ranges and machines each are allowed", maxItems)
+	}
+	for _, bar := range e.Barbells {
+		if !validWeight(bar) {
+			return fmt.Errorf("Barbell weights must be between %g and %d", minWeight, maxWeight)
+		}
+	}
+	for _, plate := range e.Plates {
+		if !validWeight(plate.Weight) || plate.Pairs < 0 || plate.Pairs > maxPairs {
+			return fmt.Errorf("Plates need a weight between %g and %d and between 0 and %d pairs", minWeight, maxWeight, maxPairs)
+		}
+	}
+	for _, dumbbells := range e.Dumbbells {
+		if !validWeight(dumbbells.Min) || !validWeight(dumbbells.Max) || dumbbells.Max < dumbbells.Min || dumbbells.Step < minWeight {
+			return fmt.Errorf("Dumbbell ranges need %g <= min <= max <= %d and a step of at least %g", minWeight, maxWeight, minWeight)
+		}
+		if (dumbbells.Max-dumbbells.Min)/dumbbells.Step > maxDumbbellSteps {
+			return fmt.Errorf("Dumbbell ranges may have at most %d steps", maxDumbbellSteps)
+		}
+	}
+	for _, machine := range e.Machines {
+		if machine.Name == "" || machine.Increment < minWeight || machine.Increment > maxWeight || machine.MaxWeight < 0 || machine.MaxWeight > maxWeight {
+			return fmt.Errorf("Machines need a name, an increment between %g and %d and a max weight between 0 and %d", minWeight, maxWeight, maxWeight)
+		}
+	}
+	return nil
+}
+
+func validWeight(weight float64) bool {
+	return weight >= minWeight && weight <= maxWeight
+}
+
+// Round snaps weight to what can be loaded for an exercise using the given
+// kind of equipment. It reports false when the equipment profile cannot
+// help, e.g. bodyweight exercises or a machine that is not in the profile.
+func (e *Equipment) Round(kind, exerciseName string, weight float64, dir Direction) (float64, bool) {
+	switch kind {
+	case EquipmentBarbell:
+		if len(e.Barbells) == 0 {
+			return 0, false
+		}
+		return e.LoadBarbell(e.Barbells[0], weight, dir).Weight, true
+
+	case EquipmentDumbbell:
+		var candidates []float64
+		for _, dumbbells := range e.Dumbbells {
+			for i := 0; i <= maxDumbbellSteps; i++ {
+				w := dumbbells.Min + float64(i)*dumbbells.Step
+				if w > dumbbells.Max+1e-9 {
+					break
+				}
+				candidates = append(candidates, roundCents(w))
+			}
+		}
+		if len(candidates) == 0 {
+			return 0, false
+		}
+		return pick(candidates, weight, dir), true
+
+	case EquipmentMachine:
+		for _, machine := range e.Machines {
+			if !strings.EqualFold(machine.Name, exerciseName) {
+				continue
+			}
+			steps := weight / machine.Increment
+			switch dir {
+			case Up:
+				steps = math.Ceil(steps - 1e-9)
+			case Down:
+				steps = math.Floor(steps + 1e-9)
+			default:
+				steps = math.Round(steps)
+			}
+			rounded := math.Max(steps, 0) * machine.Increment
+			if machine.MaxWeight > 0 {
+				rounded = math.Min(rounded, machine.MaxWeight)
+			}
+			return roundCents(rounded), true
+		}
+	}
+	return 0, false
+}
+
+// LoadBarbell finds the plates per side that bring the bar closest to
+// target in the given direction, using the fewest plates for that weight.
+func (e *Equipment) LoadBarbell(bar, target float64, dir Direction) Loading {
+	return e.newBarLoader(bar, target).load(bar, target, dir)
+}
+
+// WarmupLadder returns the warm-up sets leading to a working weight, each
+// rounded down to a loadable weight and skipping steps that would repeat a
+// weight or reach the working weight.
+func (e *Equipment) WarmupLadder(bar, target float64) []WarmupSet {
+	// Every step is lighter than the working weight, so one table serves all
+	loader := e.newBarLoader(bar, target)
+	ladder := []WarmupSet{}
+	previous := -1.0
+	for _, step := range warmupSteps {
+		loading := loader.load(bar, target*float64(step.percent)/100, Down)
+		if loading.Weight <= previous || loading.Weight >= target {
+			continue
+		}
+		previous = loading.Weight
+		ladder = append(ladder, WarmupSet{Percent: step.percent, Reps: step.reps, Loading: loading})
+	}
+	return ladder
+}
+
+// barLoader knows which loads per side, in hundredths, the plates can make
+// up to a limit, and the fewest plates making each.
+type barLoader struct {
+	// available is the plates there are pairs of, lightest first
+	available []Plate
+	// fewest[s] is the fewest plates per side summing to s hundredths, and
+	// used[i][s] how many of available[i] that combination takes
+	fewest []int
+	used   [][]uint8
+}
+
+const unreachable = math.MaxInt32
+
+// newBarLoader builds the loads per side up to the one for target on bar
+// plus the largest plate. That covers the lightest load of at least target
+// whenever there is one, so loading any weight up to target gives the same
+// answer as a table of every load would.
+func (e *Equipment) newBarLoader(bar, target float64) *barLoader {
+	var available []Plate
+	for _, plate := range e.Plates {
+		if plate.Pairs > 0 {
+			available = append(available, plate)
+		}
+	}
+	sort.Slice(available, func(i, j int) bool { return available[i].Weight < available[j].Weight })
+
+	maxSum, largest := 0, 0
+	for _, plate := range available {
+		maxSum += plate.Pairs * toCents(plate.Weight)
+		largest = max(largest, toCents(plate.Weight))
+	}
+	needed := int(math.Ceil(math.Max(target-bar, 0)/2*100)) + largest
+	maxSum = min(maxSum, needed, maxLoadPerSide)
+
+	// Plates are added lightest first so ties go to the combination with
+	// more heavy plates, the way lifters load a bar.
+	fewest := make([]int, maxSum+1)
+	for s := range fewest {
+		fewest[s] = unreachable
+	}
+	fewest[0] = 0
+	next := make([]int, maxSum+1)
+	used := make([][]uint8, len(available))
+	window := make([]int, 0, maxSum+1)
+	for i, plate := range available {
+		weight := toCents(plate.Weight)
+		used[i] = make([]uint8, maxSum+1)
+		// Taking k of the plate for s leaves s-k*weight, so the sums with
+		// the same remainder modulo weight draw from each other. Along each
+		// of them, window holds the positions j within the last Pairs whose
+		// fewest[j*weight+r] - j may still be the smallest, earliest first,
+		// so ties go to more of this plate.
+		for r := 0; r < weight && r <= maxSum; r++ {
+			window, head := window[:0], 0
+			for j, s := 0, r; s <= maxSum; j, s = j+1, s+weight {
+				if fewest[s] != unreachable {
+					for len(window) > head && fewest[window[len(window)-1]*weight+r]-window[len(window)-1] > fewest[s]-j {
+						window = window[:len(window)-1]
+					}
+					window = append(window, j)
+				}
+				for len(window) > head && window[head] < j-plate.Pairs {
+					head++
+				}
+				next[s] = unreachable
+				if len(window) > head {
+					from := window[head]
+					next[s] = fewest[from*weight+r] + j - from
+					used[i][s] = uint8(j - from)
+				}
+			}
+		}
+		fewest, next = next, fewest
+	}
+	return &barLoader{available: available, fewest: fewest, used: used}
+}
+
+func (l *barLoader) load(bar, target float64, dir Direction) Loading {
+	var reachable []float64
+	for s, count := range l.fewest {
+		if count != unreachable {
+			reachable = append(reachable, float64(s))
+		}
+	}
+	perSide := int(pick(reachable, math.Max(target-bar, 0)/2*100, dir))
+
+	loading := Loading{
+		Target:  target,
+		Bar:     bar,
+		Weight:  roundCents(bar + float64(perSide)*2/100),
+		PerSide: []float64{},
+	}
+	for i := len(l.available) - 1; i >= 0; i-- {
+		k := int(l.used[i][perSide])
+		for j := 0; j < k; j++ {
+			loading.PerSide = append(loading.PerSide, l.available[i].Weight)
+		}
+		perSide -= k * toCents(l.available[i].Weight)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(loading.PerSide)))
+	loading.Exact = math.Abs(loading.Weight-target) < 0.005
+	return loading
+}
+
+// pick chooses the candidate closest to target in the given direction,
+// falling back to the nearest extreme when none lies on that side.
+func pick(candidates []float64, target float64, dir Direction) float64 {
+	best := candidates[0]
+	found := false
+	for _, candidate := range candidates {
+		switch dir {
+		case Up:
+			if candidate < target-1e-9 {
+				continue
+			}
+			if !found || candidate < best {
+				best = candidate
+			}
+		case Down:
+			if candidate > target+1e-9 {
+				continue
+			}
+			if !found || candidate > best {
+				best = candidate
+			}
+		default:
+			if !found || math.Abs(candidate-target) < math.Abs(best-target) {
+				best = candidate
+			}
+		}
+		found = true
+	}
+	if found {
+		return best
+	}
+	if dir == Up {
+		return maxOf(candidates)
+	}
+	return minOf(candidates)
+}
+
+func maxOf(values []float64) float64 {
+	result := values[0]
+	for _, value := range values {
+		result = math.Max(result, value)
+	}
+	return result
+}
+
+func minOf(values []float64) float64 {
+	result := values[0]
+	for _, value := range values {
+		result = math.Min(result, value)
+	}
+	return result
+}
+
+func toCents(weight float64) int {
+	return int(math.Round(weight * 100))
+}
+
+func roundCents(weight float64) float64 {
+	return math.Round(weight*100) / 100
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pruneThreshold is how many buckets the memory store holds before it
+// drops the ones that have refilled completely.
+const pruneThreshold = 10000
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	policy  Policy
+}
+
+// MemoryStore keeps buckets in process. Limits are per instance, so use the
+// Postgres store when running more than one.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, policy Policy, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.buckets) >= pruneThreshold {
+		s.prune(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Requests), updated: now, policy: policy}
+		s.buckets[key] = b
+	}
+	var result Result
+	b.tokens, result = Take(b.tokens, b.updated, policy, now)
+	b.updated = now
+	return result, nil
+}
+
+// prune forgets buckets that would be full by now; they behave exactly like
+// a new bucket.
+func (s *MemoryStore) prune(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) >= b.policy.Period {
+			delete(s.buckets, key)
+		}
+	}
+}
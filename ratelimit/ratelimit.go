@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Policy allows bursts of up to Requests and refills at Requests per Period.
+type Policy struct {
+	Name     string
+	Requests int
+	Period   time.Duration
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed; zero
+	// when this one was.
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets, keyed by policy and client.
+type Store interface {
+	Take(ctx context.Context, key string, policy Policy, now time.Time) (Result, error)
+}
+
+// perSecond is the refill rate of the policy.
+func (p Policy) perSecond() float64 {
+	return float64(p.Requests) / p.Period.Seconds()
+}
+
+// Take refills a bucket holding tokens as of updated and tries to spend one
+// token at now. It returns the tokens left in the bucket and the outcome.
+// A bucket that has never been used should be passed full.
+func Take(tokens float64, updated time.Time, policy Policy, now time.Time) (float64, Result) {
+	capacity := float64(policy.Requests)
+	if elapsed := now.Sub(updated); elapsed > 0 {
+		tokens = math.Min(capacity, tokens+elapsed.Seconds()*policy.perSecond())
+	}
+
+	result := Result{Limit: policy.Requests}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - tokens) / policy.perSecond())
+	}
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = secondsToDuration((capacity - tokens) / policy.perSecond())
+	return tokens, result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
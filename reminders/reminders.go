@@ -0,0 +1,186 @@
+package reminders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	"workout-tracker/store"
+)
+
+// KindEvaluateReminders jobs fire the reminders that are due.
+const KindEvaluateReminders = "evaluate_reminders"
+
+// NotificationReminder is the type of the notifications reminders send.
+const NotificationReminder = "reminder"
+
+// evaluateBatch is how many due reminders one evaluation handles. The rest
+// are left for the next one.
+const evaluateBatch = 500
+
+// Weekdays maps the day names reminders use to weekdays.
+var Weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseTimeOfDay parses a 24 hour "HH:MM" time.
+func ParseTimeOfDay(value string) (hour, minute int, err error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, errors.New("time of day must be HH:MM, e.g. 07:00")
+	}
+	return parsed.Hour(), parsed.Minute(), nil
+}
+
+// NextRun returns the first time after after at which the reminder is due:
+// its time of day, in its timezone, on one of its days. Inactivity
+// reminders are checked every day. A time of day that does not exist on a
+// day, because the clocks go forward, is moved forward with them.
+func NextRun(reminder *store.Reminder, after time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(reminder.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	hour, minute, err := ParseTimeOfDay(reminder.TimeOfDay)
+	if err != nil {
+		return time.Time{}, err
+	}
+	days := map[time.Weekday]bool{}
+	for _, day := range reminder.Days {
+		weekday, ok := Weekdays[day]
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid day %q", day)
+		}
+		days[weekday] = true
+	}
+	if reminder.Kind == store.ReminderSchedule && len(days) == 0 {
+		return time.Time{}, errors.New("schedule reminders need at least one day")
+	}
+
+	local := after.In(loc)
+	for i := 0; i <= 7; i++ {
+		// Dates are built from the calendar day, not by adding 24 hours,
+		// so the time of day holds across daylight saving changes
+		run := time.Date(local.Year(), local.Month(), local.Day()+i, hour, minute, 0, 0, loc)
+		// time.Date puts a time in the gap before the change, move it past
+		if run.Hour() != hour || run.Minute() != minute {
+			gap := (hour*60 + minute) - (run.Hour()*60 + run.Minute())
+			if gap < 0 {
+				gap += 24 * 60
+			}
+			run = run.Add(time.Duration(gap) * time.Minute)
+		}
+		if !run.After(after) {
+			continue
+		}
+		if reminder.Kind == store.ReminderSchedule && !days[run.Weekday()] {
+			continue
+		}
+		return run, nil
+	}
+	return time.Time{}, errors.New("reminder never runs")
+}
+
+// Evaluate decides whether a due reminder fires, given when the user last
+// logged a workout, and returns the notification to send if it does.
+// Schedule reminders are skipped on days the user already trained.
+// Inactivity reminders fire once per stretch of inactivity.
+func Evaluate(reminder *store.Reminder, lastWorkoutAt *time.Time, now time.Time) (*store.Notification, bool) {
+	loc, err := time.LoadLocation(reminder.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	switch reminder.Kind {
+	case store.ReminderSchedule:
+		if lastWorkoutAt != nil && sameDay(lastWorkoutAt.In(loc), now.In(loc)) {
+			return nil, false
+		}
+		return newNotification(reminder, "Time to train", reminder.Name, nil), true
+
+	case store.ReminderInactivity:
+		since := reminder.CreatedAt
+		if lastWorkoutAt != nil {
+			since = *lastWorkoutAt
+		}
+		if now.Sub(since) < time.Duration(reminder.InactiveDays)*24*time.Hour {
+			return nil, false
+		}
+		// Already reminded about this stretch
+		if reminder.LastFiredAt != nil && reminder.LastFiredAt.After(since) {
+			return nil, false
+		}
+		days := int(now.Sub(since) / (24 * time.Hour))
+		body := fmt.Sprintf("You haven't logged a workout in %d days.", days)
+		if lastWorkoutAt == nil {
+			body = "You haven't logged a workout yet."
+		}
+		return newNotification(reminder, reminder.Name, body, lastWorkoutAt), true
+	}
+	return nil, false
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+func newNotification(reminder *store.Reminder, title, body string, lastWorkoutAt *time.Time) *store.Notification {
+	data, _ := json.Marshal(map[string]interface{}{
+		"reminder_id":     reminder.Id,
+		"kind":            reminder.Kind,
+		"last_workout_at": lastWorkoutAt,
+	})
+	return &store.Notification{
+		UserId: reminder.UserId,
+		Type:   NotificationReminder,
+		Title:  title,
+		Body:   body,
+		Data:   data,
+	}
+}
+
+// HandleEvaluate returns the job handler that fires due reminders and
+// moves every due reminder to its next run.
+func HandleEvaluate(reminderStore store.ReminderStore, logger *slog.Logger) func(context.Context, *store.Job) error {
+	return func(ctx context.Context, job *store.Job) error {
+		now := time.Now()
+		due, err := reminderStore.GetDueReminders(ctx, now, evaluateBatch)
+		if err != nil {
+			return err
+		}
+
+		for i := range due {
+			reminder := &due[i]
+			next, err := NextRun(reminder, now)
+			if err != nil {
+				// Only reachable if the timezone database changed under a
+				// stored reminder; try again in a day rather than every job
+				logger.ErrorContext(ctx, "failed to schedule reminder", "reminder_id", reminder.Id, "error", err)
+				next = now.Add(24 * time.Hour)
+			}
+
+			lastWorkoutAt, err := reminderStore.GetLastWorkoutAt(ctx, reminder.UserId)
+			if err != nil {
+				return err
+			}
+			notification, fire := Evaluate(reminder, lastWorkoutAt, now)
+			if fire {
+				_, err = reminderStore.FireReminder(ctx, reminder, next, notification)
+			} else {
+				_, err = reminderStore.RescheduleReminder(ctx, reminder, next)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -2,14 +2,20 @@ package response
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 )
 
-var logger *log.Logger
+// errorRecorder is implemented by the access log's response writer so the
+// cause of a failed request is logged alongside it, never sent to logs as
+// part of a response body.
+type errorRecorder interface {
+	RecordError(err error)
+}
 
-func InitLogger(l *log.Logger) {
-	logger = l
+func recordError(w http.ResponseWriter, err error) {
+	if recorder, ok := w.(errorRecorder); ok && err != nil {
+		recorder.RecordError(err)
+	}
 }
 
 // StandardResponse is the base structure for all API responses
@@ -40,26 +46,23 @@ type UserResponse struct {
 	Bio      string `json:"bio"`
 }
 
+// errorMessage returns the text of err, tolerating handlers that pass nil
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
 // JSON sends a JSON response with the given status code
 func JSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-
-	// Log the response if logger is initialized
-	if logger != nil {
-		logData, _ := json.Marshal(data)
-		logger.Printf("Sending response [%d]: %s", statusCode, string(logData))
-	}
-
 	json.NewEncoder(w).Encode(data)
 }
 
 // Success sends a success response with the given message and data
 func Success(w http.ResponseWriter, message string, data interface{}) {
-	if logger != nil {
-		logger.Printf("Success: %s", message)
-	}
-
 	resp := StandardResponse{
 		Success: true,
 		Message: message,
@@ -70,10 +73,6 @@ func Success(w http.ResponseWriter, message string, data interface{}) {
 
 // Created sends a 201 Created response with the given message and data
 func Created(w http.ResponseWriter, message string, data interface{}) {
-	if logger != nil {
-		logger.Printf("Created: %s", message)
-	}
-
 	resp := StandardResponse{
 		Success: true,
 		Message: message,
@@ -84,24 +83,17 @@ func Created(w http.ResponseWriter, message string, data interface{}) {
 
 // Error sends an error response with the given status code, message, and error
 func Error(w http.ResponseWriter, statusCode int, message string, err error) {
-	if logger != nil {
-		logger.Printf("Error [%d]: %s - %v", statusCode, message, err)
-	}
-
+	recordError(w, err)
 	resp := ErrorResponse{
 		Success: false,
 		Message: message,
-		Error:   err.Error(),
+		Error:   errorMessage(err),
 	}
 	JSON(w, statusCode, resp)
 }
 
 // NotFound sends a 404 Not Found response
 func NotFound(w http.ResponseWriter, message string) {
-	if logger != nil {
-		logger.Printf("NotFound: %s", message)
-	}
-
 	resp := ErrorResponse{
 		Success: false,
 		Message: message,
@@ -112,38 +104,28 @@ func NotFound(w http.ResponseWriter, message string) {
 
 // BadRequest sends a 400 Bad Request response
 func BadRequest(w http.ResponseWriter, message string, err error) {
-	if logger != nil {
-		logger.Printf("BadRequest: %s - %v", message, err)
-	}
-
+	recordError(w, err)
 	resp := ErrorResponse{
 		Success: false,
 		Message: message,
-		Error:   err.Error(),
+		Error:   errorMessage(err),
 	}
 	JSON(w, http.StatusBadRequest, resp)
 }
 
 // InternalServerError sends a 500 Internal Server Error response
 func InternalServerError(w http.ResponseWriter, message string, err error) {
-	if logger != nil {
-		logger.Printf("InternalServerError: %s - %v", message, err)
-	}
-
+	recordError(w, err)
 	resp := ErrorResponse{
 		Success: false,
 		Message: message,
-		Error:   err.Error(),
+		Error:   errorMessage(err),
 	}
 	JSON(w, http.StatusInternalServerError, resp)
 }
 
 // WorkoutUpdated sends a response for a successfully updated workout
 func WorkoutUpdated(w http.ResponseWriter, workoutID int, workout interface{}, updatedFields interface{}) {
-	if logger != nil {
-		logger.Printf("Workout updated: ID=%d, Fields=%v", workoutID, updatedFields)
-	}
-
 	workoutResp := WorkoutResponse{
 		WorkoutID:     workoutID,
 		UpdatedFields: updatedFields,
@@ -157,10 +139,6 @@ func WorkoutUpdated(w http.ResponseWriter, workoutID int, workout interface{}, u
 
 // WorkoutDeleted sends a response for a successfully deleted workout
 func WorkoutDeleted(w http.ResponseWriter, workoutID int, workoutInfo interface{}) {
-	if logger != nil {
-		logger.Printf("Workout deleted: ID=%d", workoutID)
-	}
-
 	Success(w, "Workout successfully deleted", map[string]interface{}{
 		"workout_id":   workoutID,
 		"workout_info": workoutInfo,
@@ -169,32 +147,18 @@ func WorkoutDeleted(w http.ResponseWriter, workoutID int, workoutInfo interface{
 
 // WorkoutCreated sends a response for a successfully created workout
 func WorkoutCreated(w http.ResponseWriter, workout interface{}) {
-	if logger != nil {
-		logger.Printf("Workout created")
-	}
-
 	Created(w, "Workout successfully created", workout)
 }
 
 func UserCreated(w http.ResponseWriter, user interface{}) {
-	if logger != nil {
-		logger.Printf("User created")
-	}
 	Created(w, "User successfully created", user)
 }
 
 func UserUpdated(w http.ResponseWriter, user interface{}) {
-	if logger != nil {
-		logger.Printf("User updated")
-	}
 	Success(w, "User successfully updated", user)
 }
 
 func Forbidden(w http.ResponseWriter, sprintf string) {
-	if logger != nil {
-		logger.Printf("Forbidden: %s", sprintf)
-	}
-
 	resp := ErrorResponse{
 		Success: false,
 		Message: sprintf,
@@ -202,3 +166,43 @@ func Forbidden(w http.ResponseWriter, sprintf string) {
 	}
 	JSON(w, http.StatusForbidden, resp)
 }
+
+// Unauthorized sends a 401 Unauthorized response
+func Unauthorized(w http.ResponseWriter, message string) {
+	resp := ErrorResponse{
+		Success: false,
+		Message: message,
+		Error:   "Unauthorized",
+	}
+	JSON(w, http.StatusUnauthorized, resp)
+}
+
+// TooManyRequests sends a 429 Too Many Requests response
+func TooManyRequests(w http.ResponseWriter, message string) {
+	resp := ErrorResponse{
+		Success: false,
+		Message: message,
+		Error:   "Rate limit exceeded",
+	}
+	JSON(w, http.StatusTooManyRequests, resp)
+}
+
+// PreconditionFailed sends a 412 Precondition Failed response
+func PreconditionFailed(w http.ResponseWriter, message string) {
+	resp := ErrorResponse{
+		Success: false,
+		Message: message,
+		Error:   "Precondition failed",
+	}
+	JSON(w, http.StatusPreconditionFailed, resp)
+}
+
+// PreconditionRequired sends a 428 Precondition Required response
+func PreconditionRequired(w http.ResponseWriter, message string) {
+	resp := ErrorResponse{
+		Success: false,
+		Message: message,
+		Error:   "Precondition required",
+	}
+	JSON(w, http.StatusPreconditionRequired, resp)
+}
@@ -3,18 +3,92 @@ package routes
 import (
 	"github.com/go-chi/chi/v5"
 	"workout-tracker/app"
+	"workout-tracker/logging"
+	"workout-tracker/metrics"
+	"workout-tracker/tokens"
+	"workout-tracker/tracing"
 )
 
 func SetupRoutes(app *app.Application) *chi.Mux {
 	routes := chi.NewRouter()
+	routes.Use(logging.RequestIDMiddleware)
+	routes.Use(tracing.Middleware)
+	routes.Use(metrics.Middleware)
+	routes.Use(logging.AccessLog(app.Logger))
 
 	routes.Get("/health", app.HealthCheck)
-	routes.Get("/workouts/{id}", app.WorkoutHandler.HandleGetWorkoutById)
-	routes.Post("/workouts", app.WorkoutHandler.HandleCreateWorkout)
-	routes.Put("/workouts/{id}", app.WorkoutHandler.HandleUpdateWorkout)
-	routes.Delete("/workouts/{id}", app.WorkoutHandler.HandleDeleteWorkout)
+	routes.Get("/health/live", app.LivenessCheck)
+	routes.Get("/health/ready", app.HealthCheck)
+	routes.Handle("/metrics", metrics.Handler())
 
-	routes.Post("/users", app.UserHandler.HandleRegisterUser)
-	routes.Post("/tokens/authentication", app.TokenHandler.HandleCreateToken)
+	routes.Group(func(r chi.Router) {
+		r.Use(app.Middleware.Authenticate)
+		r.Use(app.RateLimiter.Limit(app.RateLimits.Default, app.RateLimiter.ByUser))
+
+		r.Get("/workouts/trash", app.Middleware.RequireScope(tokens.ScopeWorkoutsRead, tracing.Handler(app.WorkoutHandler.HandleGetTrash)))
+		r.Get("/workouts/{id}", app.Middleware.RequireScope(tokens.ScopeWorkoutsRead, tracing.Handler(app.WorkoutHandler.HandleGetWorkoutById)))
+		r.Post("/workouts", app.Middleware.RequireScope(tokens.ScopeWorkoutsWrite, app.Idempotency.Handle(tracing.Handler(app.WorkoutHandler.HandleCreateWorkout))))
+		r.Put("/workouts/{id}", app.Middleware.RequireScope(tokens.ScopeWorkoutsWrite, tracing.Handler(app.WorkoutHandler.HandleUpdateWorkout)))
+		r.Delete("/workouts/{id}", app.Middleware.RequireScope(tokens.ScopeWorkoutsWrite, tracing.Handler(app.WorkoutHandler.HandleDeleteWorkout)))
+		r.Post("/workouts/{id}/restore", app.Middleware.RequireScope(tokens.ScopeWorkoutsWrite, tracing.Handler(app.WorkoutHandler.HandleRestoreWorkout)))
+		r.Get("/workouts/{id}/revisions", app.Middleware.RequireScope(tokens.ScopeWorkoutsRead, tracing.Handler(app.WorkoutHandler.HandleGetWorkoutRevisions)))
+		r.Post("/workouts/{id}/revisions/{revision}/revert", app.Middleware.RequireScope(tokens.ScopeWorkoutsWrite, tracing.Handler(app.WorkoutHandler.HandleRevertWorkout)))
+
+		r.Patch("/users/me", app.Middleware.RequireUser(tracing.Handler(app.UserHandler.HandleUpdateUser)))
+		r.Post("/users/me/bodyweight", app.Middleware.RequireUser(tracing.Handler(app.UserHandler.HandleLogBodyweight)))
+		r.Post("/users/me/mfa/totp", app.Middleware.RequireUser(tracing.Handler(app.MFAHandler.HandleEnrollTOTP)))
+		r.Post("/users/me/mfa/totp/verify", app.Middleware.RequireUser(tracing.Handler(app.MFAHandler.HandleVerifyTOTP)))
+		r.Delete("/users/me/mfa/totp", app.Middleware.RequireUser(tracing.Handler(app.MFAHandler.HandleDisableTOTP)))
+		r.Get("/users/me/api-keys", app.Middleware.RequireUser(tracing.Handler(app.APIKeyHandler.HandleGetAPIKeys)))
+		r.Post("/users/me/api-keys", app.Middleware.RequireUser(tracing.Handler(app.APIKeyHandler.HandleCreateAPIKey)))
+		r.Delete("/users/me/api-keys/{id}", app.Middleware.RequireUser(tracing.Handler(app.APIKeyHandler.HandleDeleteAPIKey)))
+		r.Post("/users/me/identities/{provider}", app.Middleware.RequireUser(tracing.Handler(app.OIDCHandler.HandleStartLink)))
+		r.Get("/users/me/webhooks", app.Middleware.RequireUser(tracing.Handler(app.WebhookHandler.HandleGetWebhooks)))
+		r.Post("/users/me/webhooks", app.Middleware.RequireUser(tracing.Handler(app.WebhookHandler.HandleCreateWebhook)))
+		r.Patch("/users/me/webhooks/{id}", app.Middleware.RequireUser(tracing.Handler(app.WebhookHandler.HandleUpdateWebhook)))
+		r.Delete("/users/me/webhooks/{id}", app.Middleware.RequireUser(tracing.Handler(app.WebhookHandler.HandleDeleteWebhook)))
+		r.Post("/users/me/webhooks/{id}/ping", app.Middleware.RequireUser(tracing.Handler(app.WebhookHandler.HandlePingWebhook)))
+		r.Get("/users/me/webhooks/{id}/deliveries", app.Middleware.RequireUser(tracing.Handler(app.WebhookHandler.HandleGetDeliveries)))
+		r.Get("/users/me/reminders", app.Middleware.RequireUser(tracing.Handler(app.ReminderHandler.HandleGetReminders)))
+		r.Post("/users/me/reminders", app.Middleware.RequireUser(tracing.Handler(app.ReminderHandler.HandleCreateReminder)))
+		r.Delete("/users/me/reminders/{id}", app.Middleware.RequireUser(tracing.Handler(app.ReminderHandler.HandleDeleteReminder)))
+		r.Get("/users/me/notifications", app.Middleware.RequireUser(tracing.Handler(app.NotificationHandler.HandleGetNotifications)))
+		r.Post("/users/me/notifications/read-all", app.Middleware.RequireUser(tracing.Handler(app.NotificationHandler.HandleMarkAllRead)))
+		r.Post("/users/me/notifications/{id}/read", app.Middleware.RequireUser(tracing.Handler(app.NotificationHandler.HandleMarkRead)))
+		r.Post("/oauth/clients", app.Middleware.RequireUser(tracing.Handler(app.OAuthHandler.HandleRegisterClient)))
+		r.Get("/oauth/authorize", app.Middleware.RequireUser(tracing.Handler(app.OAuthHandler.HandleGetAuthorization)))
+		r.Post("/oauth/authorize", app.Middleware.RequireUser(tracing.Handler(app.OAuthHandler.HandleAuthorize)))
+		r.Get("/users/me/goals", app.Middleware.RequireUserScope(tokens.ScopeAnalyticsRead, tracing.Handler(app.GoalHandler.HandleGetGoals)))
+		r.Post("/users/me/goals", app.Middleware.RequireUser(tracing.Handler(app.GoalHandler.HandleCreateGoal)))
+		r.Delete("/users/me/goals/{id}", app.Middleware.RequireUser(tracing.Handler(app.GoalHandler.HandleDeleteGoal)))
+		r.Get("/users/me/calendar", app.Middleware.RequireUserScope(tokens.ScopeAnalyticsRead, tracing.Handler(app.CalendarHandler.HandleGetCalendar)))
+		r.Post("/users/me/calendar/feed", app.Middleware.RequireUser(tracing.Handler(app.CalendarFeedHandler.HandleCreateFeed)))
+		r.Delete("/users/me/calendar/feed", app.Middleware.RequireUser(tracing.Handler(app.CalendarFeedHandler.HandleDeleteFeed)))
+		r.Get("/users/me/equipment", app.Middleware.RequireUser(tracing.Handler(app.EquipmentHandler.HandleGetEquipment)))
+		r.Put("/users/me/equipment", app.Middleware.RequireUser(tracing.Handler(app.EquipmentHandler.HandleUpdateEquipment)))
+		r.Get("/users/me/equipment/plates", app.Middleware.RequireUser(tracing.Handler(app.EquipmentHandler.HandleGetPlateLoading)))
+
+		r.Get("/admin/jobs", app.Middleware.RequireAdmin(tracing.Handler(app.JobHandler.HandleGetJobs)))
+		r.Post("/admin/jobs/{id}/retry", app.Middleware.RequireAdmin(tracing.Handler(app.JobHandler.HandleRetryJob)))
+
+		r.Get("/exercises", tracing.Handler(app.ExerciseHandler.HandleGetExercises))
+		r.Get("/exercises/{id}/suggestion", app.Middleware.RequireUserScope(tokens.ScopeAnalyticsRead, tracing.Handler(app.ExerciseHandler.HandleGetSuggestion)))
+		r.Put("/exercises/{id}/settings", app.Middleware.RequireUser(tracing.Handler(app.ExerciseHandler.HandleUpdateProgressionSettings)))
+	})
+
+	routes.With(app.RateLimiter.Limit(app.RateLimits.Register, app.RateLimiter.ByIP)).Post("/users", tracing.Handler(app.UserHandler.HandleRegisterUser))
+	routes.With(app.RateLimiter.Limit(app.RateLimits.Login, app.RateLimiter.ByIP)).Post("/tokens/authentication", tracing.Handler(app.TokenHandler.HandleCreateToken))
+	routes.With(app.RateLimiter.Limit(app.RateLimits.Login, app.RateLimiter.ByIP)).Post("/tokens/mfa", tracing.Handler(app.TokenHandler.HandleExchangeMFAToken))
+	routes.Get("/auth/oidc", tracing.Handler(app.OIDCHandler.HandleGetProviders))
+	routes.With(app.RateLimiter.Limit(app.RateLimits.Login, app.RateLimiter.ByIP)).Get("/auth/oidc/{provider}/login", tracing.Handler(app.OIDCHandler.HandleStartLogin))
+	routes.With(app.RateLimiter.Limit(app.RateLimits.Login, app.RateLimiter.ByIP)).Get("/auth/oidc/{provider}/callback", tracing.Handler(app.OIDCHandler.HandleCallback))
+
+	routes.Group(func(r chi.Router) {
+		r.Use(app.RateLimiter.Limit(app.RateLimits.Default, app.RateLimiter.ByIP))
+		r.Post("/oauth/token", tracing.Handler(app.OAuthHandler.HandleToken))
+		r.Post("/oauth/revoke", tracing.Handler(app.OAuthHandler.HandleRevoke))
+		r.Post("/oauth/introspect", tracing.Handler(app.OAuthHandler.HandleIntrospect))
+		r.Get("/calendar/feed.ics", tracing.Handler(app.CalendarFeedHandler.HandleGetFeed))
+	})
 	return routes
 }
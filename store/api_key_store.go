@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"workout-tracker/tokens"
+)
+
+// APIKey is a long-lived credential for integrations. Only its hash is
+// stored; Prefix identifies it in listings.
+type APIKey struct {
+	Id         int64      `json:"id"`
+	UserId     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type PostgresAPIKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{db: db}
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *APIKey, hash []byte) error
+	GetAPIKeysByUser(ctx context.Context, userId int) ([]APIKey, error)
+	DeleteAPIKey(ctx context.Context, id int64, userId int) (bool, error)
+	GetUserByAPIKey(ctx context.Context, plainText string) (*User, *APIKey, error)
+}
+
+func (ks *PostgresAPIKeyStore) CreateAPIKey(ctx context.Context, key *APIKey, hash []byte) error {
+	ctx, cancel := withTimeout(ctx, "APIKeyStore.CreateAPIKey")
+	defer cancel()
+
+	query := "INSERT INTO api_keys (user_id, name, prefix, hash, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at"
+	return ks.db.QueryRowContext(ctx, query, key.UserId, key.Name, key.Prefix, hash, strings.Join(key.Scopes, " "), key.ExpiresAt).Scan(&key.Id, &key.CreatedAt)
+}
+
+func (ks *PostgresAPIKeyStore) GetAPIKeysByUser(ctx context.Context, userId int) ([]APIKey, error) {
+	ctx, cancel := withTimeout(ctx, "APIKeyStore.GetAPIKeysByUser")
+	defer cancel()
+
+	query := "SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at FROM api_keys WHERE user_id = $1 ORDER BY created_at"
+	rows, err := ks.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		var scopes string
+		err = rows.Scan(&key.Id, &key.UserId, &key.Name, &key.Prefix, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		key.Scopes = strings.Fields(scopes)
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes a key. It reports false when the user has no key
+// with that id.
+func (ks *PostgresAPIKeyStore) DeleteAPIKey(ctx context.Context, id int64, userId int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "APIKeyStore.DeleteAPIKey")
+	defer cancel()
+
+	result, err := ks.db.ExecContext(ctx, "DELETE FROM api_keys WHERE id = $1 AND user_id = $2", id, userId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// GetUserByAPIKey returns the owner of an unexpired key and the key itself,
+// recording that it was used.
+func (ks *PostgresAPIKeyStore) GetUserByAPIKey(ctx context.Context, plainText string) (*User, *APIKey, error) {
+	ctx, cancel := withTimeout(ctx, "APIKeyStore.GetUserByAPIKey")
+	defer cancel()
+
+	query := "WITH k AS (UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP " +
+		"WHERE hash = $1 AND (expires_at IS NULL OR expires_at > $2) " +
+		"RETURNING id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at) " +
+		"SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.timezone, u.created_at, u.updated_at, " +
+		"k.id, k.name, k.prefix, k.scopes, k.expires_at, k.last_used_at, k.created_at " +
+		"FROM k INNER JOIN users u ON u.id = k.user_id"
+
+	user := &User{
+		PasswordHash: password{},
+	}
+	key := &APIKey{}
+	var scopes string
+	err := ks.db.QueryRowContext(ctx, query, tokens.HashSecret(plainText), time.Now()).Scan(
+		&user.Id,
+		&user.UserName,
+		&user.Email,
+		&user.PasswordHash.hash,
+		&user.Bio,
+		&user.Timezone,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&key.Id,
+		&key.Name,
+		&key.Prefix,
+		&scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	key.UserId = user.Id
+	key.Scopes = strings.Fields(scopes)
+	return user, key, nil
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"workout-tracker/tokens"
+)
+
+type PostgresCalendarFeedStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCalendarFeedStore(db *sql.DB) *PostgresCalendarFeedStore {
+	return &PostgresCalendarFeedStore{db: db}
+}
+
+// CalendarFeedStore keeps the secret of each user's calendar feed. A user
+// has at most one feed; setting a new secret retires the old URL.
+type CalendarFeedStore interface {
+	SetFeedSecret(ctx context.Context, userId int, hash []byte) error
+	DeleteFeed(ctx context.Context, userId int) (bool, error)
+	GetUserByFeedSecret(ctx context.Context, plainText string) (*User, error)
+}
+
+func (fs *PostgresCalendarFeedStore) SetFeedSecret(ctx context.Context, userId int, hash []byte) error {
+	ctx, cancel := withTimeout(ctx, "CalendarFeedStore.SetFeedSecret")
+	defer cancel()
+
+	query := "INSERT INTO calendar_feeds (user_id, hash) VALUES ($1, $2) " +
+		"ON CONFLICT (user_id) DO UPDATE SET hash = EXCLUDED.hash, last_fetched_at = NULL, created_at = CURRENT_TIMESTAMP"
+	_, err := fs.db.ExecContext(ctx, query, userId, hash)
+	return err
+}
+
+func (fs *PostgresCalendarFeedStore) DeleteFeed(ctx context.Context, userId int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "CalendarFeedStore.DeleteFeed")
+	defer cancel()
+
+	result, err := fs.db.ExecContext(ctx, "DELETE FROM calendar_feeds WHERE user_id = $1", userId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// GetUserByFeedSecret returns the owner of the feed with that secret,
+// recording that it was fetched, or nil if there is none.
+func (fs *PostgresCalendarFeedStore) GetUserByFeedSecret(ctx context.Context, plainText string) (*User, error) {
+	ctx, cancel := withTimeout(ctx, "CalendarFeedStore.GetUserByFeedSecret")
+	defer cancel()
+
+	query := "WITH f AS (UPDATE calendar_feeds SET last_fetched_at = $2 WHERE hash = $1 RETURNING user_id) " +
+		"SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.timezone, u.created_at, u.updated_at " +
+		"FROM f INNER JOIN users u ON u.id = f.user_id"
+
+	user := &User{
+		PasswordHash: password{},
+	}
+	err := fs.db.QueryRowContext(ctx, query, tokens.HashSecret(plainText), time.Now()).Scan(
+		&user.Id,
+		&user.UserName,
+		&user.Email,
+		&user.PasswordHash.hash,
+		&user.Bio,
+		&user.Timezone,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
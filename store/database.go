@@ -1,23 +1,26 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/pressly/goose/v3"
 	"io/fs"
+	"workout-tracker/config"
 )
 
-func Connect() (*sql.DB, error) {
-	db, err := sql.Open("pgx", "host=localhost user=postgres password=postgres dbname=postgres port=5432 sslmode=disable")
+func Connect(cfg config.DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open("pgx", cfg.DSN)
 	if err != nil {
 		return nil, errors.New("failed to connect to the database: " + err.Error())
 	}
-	fmt.Println("Connected to the database")
 
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 	return db, nil
 }
 
@@ -40,3 +43,8 @@ func Migrate(db *sql.DB, dir string) error {
 	}
 	return nil
 }
+
+// MigrationVersion returns the version of the latest applied migration.
+func MigrationVersion(ctx context.Context, db *sql.DB) (int64, error) {
+	return goose.GetDBVersionContext(ctx, db)
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"workout-tracker/plates"
+)
+
+type PostgresEquipmentStore struct {
+	db *sql.DB
+}
+
+func NewPostgresEquipmentStore(db *sql.DB) *PostgresEquipmentStore {
+	return &PostgresEquipmentStore{db: db}
+}
+
+type EquipmentStore interface {
+	GetEquipment(ctx context.Context, userId int) (*plates.Equipment, error)
+	UpdateEquipment(ctx context.Context, userId int, equipment *plates.Equipment) error
+}
+
+// GetEquipment returns the user's equipment profile, or the default gym
+// when they have not saved one.
+func (es *PostgresEquipmentStore) GetEquipment(ctx context.Context, userId int) (*plates.Equipment, error) {
+	ctx, cancel := withTimeout(ctx, "EquipmentStore.GetEquipment")
+	defer cancel()
+
+	var profile []byte
+	err := es.db.QueryRowContext(ctx, "SELECT profile FROM user_equipment WHERE user_id = $1", userId).Scan(&profile)
+	if err == sql.ErrNoRows {
+		return plates.DefaultEquipment(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	equipment := &plates.Equipment{}
+	err = json.Unmarshal(profile, equipment)
+	if err != nil {
+		return nil, err
+	}
+	return equipment, nil
+}
+
+func (es *PostgresEquipmentStore) UpdateEquipment(ctx context.Context, userId int, equipment *plates.Equipment) error {
+	ctx, cancel := withTimeout(ctx, "EquipmentStore.UpdateEquipment")
+	defer cancel()
+
+	profile, err := json.Marshal(equipment)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO user_equipment (user_id, profile) VALUES ($1, $2) " +
+		"ON CONFLICT (user_id) DO UPDATE SET profile = EXCLUDED.profile, updated_at = CURRENT_TIMESTAMP"
+	_, err = es.db.ExecContext(ctx, query, userId, profile)
+	return err
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"workout-tracker/overload"
+)
+
+// defaultRounding is the smallest jump in weight most gyms can load: a pair
+// of 1.25 plates.
+const defaultRounding = 2.5
+
+type Exercise struct {
+	Id              int       `json:"id"`
+	Name            string    `json:"name"`
+	METValue        float64   `json:"met_value"`
+	Equipment       string    `json:"equipment"`
+	WeightIncrement float64   `json:"weight_increment"`
+	TargetReps      int       `json:"target_reps"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type PostgresExerciseStore struct {
+	db *sql.DB
+}
+
+func NewPostgresExerciseStore(db *sql.DB) *PostgresExerciseStore {
+	return &PostgresExerciseStore{db: db}
+}
+
+type ExerciseStore interface {
+	GetExercises(ctx context.Context) ([]Exercise, error)
+	GetExerciseById(ctx context.Context, id int64) (*Exercise, error)
+	GetExerciseByName(ctx context.Context, name string) (*Exercise, error)
+	GetProgressionSettings(ctx context.Context, userId int, exercise *Exercise) (*overload.Settings, error)
+	UpsertProgressionSettings(ctx context.Context, userId int, exerciseId int, settings *overload.Settings) error
+	GetRecentSessions(ctx context.Context, userId int, exerciseName string, limit int) ([]overload.Session, error)
+}
+
+const exerciseColumns = "id, name, met_value, equipment, weight_increment, target_reps, created_at"
+
+func scanExercise(row interface{ Scan(...interface{}) error }, exercise *Exercise) error {
+	return row.Scan(&exercise.Id, &exercise.Name, &exercise.METValue, &exercise.Equipment, &exercise.WeightIncrement, &exercise.TargetReps, &exercise.CreatedAt)
+}
+
+func (es *PostgresExerciseStore) GetExercises(ctx context.Context) ([]Exercise, error) {
+	ctx, cancel := withTimeout(ctx, "ExerciseStore.GetExercises")
+	defer cancel()
+
+	rows, err := es.db.QueryContext(ctx, "SELECT "+exerciseColumns+" FROM exercises ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exercises := []Exercise{}
+	for rows.Next() {
+		exercise := Exercise{}
+		err = scanExercise(rows, &exercise)
+		if err != nil {
+			return nil, err
+		}
+		exercises = append(exercises, exercise)
+	}
+	return exercises, rows.Err()
+}
+
+func (es *PostgresExerciseStore) GetExerciseById(ctx context.Context, id int64) (*Exercise, error) {
+	ctx, cancel := withTimeout(ctx, "ExerciseStore.GetExerciseById")
+	defer cancel()
+
+	exercise := &Exercise{}
+	err := scanExercise(es.db.QueryRowContext(ctx, "SELECT "+exerciseColumns+" FROM exercises WHERE id = $1", id), exercise)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return exercise, nil
+}
+
+func (es *PostgresExerciseStore) GetExerciseByName(ctx context.Context, name string) (*Exercise, error) {
+	ctx, cancel := withTimeout(ctx, "ExerciseStore.GetExerciseByName")
+	defer cancel()
+
+	exercise := &Exercise{}
+	err := scanExercise(es.db.QueryRowContext(ctx, "SELECT "+exerciseColumns+" FROM exercises WHERE LOWER(name) = LOWER($1)", name), exercise)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return exercise, nil
+}
+
+// GetProgressionSettings returns the user's overrides for the exercise, or
+// the catalog defaults when they have not configured any.
+func (es *PostgresExerciseStore) GetProgressionSettings(ctx context.Context, userId int, exercise *Exercise) (*overload.Settings, error) {
+	ctx, cancel := withTimeout(ctx, "ExerciseStore.GetProgressionSettings")
+	defer cancel()
+
+	settings := &overload.Settings{}
+	query := "SELECT weight_increment, rounding, target_reps FROM user_exercise_settings WHERE user_id = $1 AND exercise_id = $2"
+	err := es.db.QueryRowContext(ctx, query, userId, exercise.Id).Scan(&settings.WeightIncrement, &settings.Rounding, &settings.TargetReps)
+	if err == sql.ErrNoRows {
+		return &overload.Settings{
+			WeightIncrement: exercise.WeightIncrement,
+			Rounding:        defaultRounding,
+			TargetReps:      exercise.TargetReps,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (es *PostgresExerciseStore) UpsertProgressionSettings(ctx context.Context, userId int, exerciseId int, settings *overload.Settings) error {
+	ctx, cancel := withTimeout(ctx, "ExerciseStore.UpsertProgressionSettings")
+	defer cancel()
+
+	query := "INSERT INTO user_exercise_settings (user_id, exercise_id, weight_increment, rounding, target_reps) VALUES ($1, $2, $3, $4, $5) " +
+		"ON CONFLICT (user_id, exercise_id) DO UPDATE SET weight_increment = EXCLUDED.weight_increment, " +
+		"rounding = EXCLUDED.rounding, target_reps = EXCLUDED.target_reps, updated_at = CURRENT_TIMESTAMP"
+	_, err := es.db.ExecContext(ctx, query, userId, exerciseId, settings.WeightIncrement, settings.Rounding, settings.TargetReps)
+	return err
+}
+
+// GetRecentSessions returns the user's working sets of the exercise in their
+// last limit workouts containing it, newest first.
+func (es *PostgresExerciseStore) GetRecentSessions(ctx context.Context, userId int, exerciseName string, limit int) ([]overload.Session, error) {
+	ctx, cancel := withTimeout(ctx, "ExerciseStore.GetRecentSessions")
+	defer cancel()
+
+	query := "WITH recent AS (" +
+		"SELECT DISTINCT w.id, w.created_at FROM workout w INNER JOIN workout_entries e ON e.workout_id = w.id " +
+		"WHERE w.user_id = $1 AND w.deleted_at IS NULL AND LOWER(e.exercise_name) = LOWER($2) AND e.reps IS NOT NULL ORDER BY w.created_at DESC LIMIT $3) " +
+		"SELECT r.id, r.created_at, e.sets, e.reps, e.weight FROM recent r INNER JOIN workout_entries e ON e.workout_id = r.id " +
+		"WHERE LOWER(e.exercise_name) = LOWER($2) AND e.reps IS NOT NULL ORDER BY r.created_at DESC, e.order_index"
+	rows, err := es.db.QueryContext(ctx, query, userId, exerciseName, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []overload.Session
+	for rows.Next() {
+		var (
+			workoutId   int
+			performedAt time.Time
+			sets, reps  int
+			weight      *float64
+		)
+		err = rows.Scan(&workoutId, &performedAt, &sets, &reps, &weight)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(sessions) == 0 || sessions[len(sessions)-1].WorkoutId != workoutId {
+			sessions = append(sessions, overload.Session{WorkoutId: workoutId, PerformedAt: performedAt, Weight: weight, Reps: reps, Sets: sets})
+			continue
+		}
+
+		// Keep only the heaviest entries of the workout as its working sets.
+		session := &sessions[len(sessions)-1]
+		switch {
+		case weightOf(weight) > weightOf(session.Weight):
+			session.Weight, session.Reps, session.Sets = weight, reps, sets
+		case weightOf(weight) == weightOf(session.Weight):
+			session.Reps = min(session.Reps, reps)
+			session.Sets += sets
+		}
+	}
+	return sessions, rows.Err()
+}
+
+func weightOf(weight *float64) float64 {
+	if weight == nil {
+		return 0
+	}
+	return *weight
+}
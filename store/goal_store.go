@@ -0,0 +1,346 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	GoalTypeOneRepMax      = "one_rep_max"
+	GoalTypeWeeklyWorkouts = "weekly_workouts"
+	GoalTypeMonthlyVolume  = "monthly_volume"
+	GoalTypeBodyweight     = "bodyweight"
+)
+
+// trendWindow is how far back we look when projecting a completion date.
+const trendWindow = 28 * 24 * time.Hour
+
+// maxProjectionDays caps projections that are too far out to be meaningful.
+const maxProjectionDays = 3650
+
+type Goal struct {
+	Id           int        `json:"id"`
+	UserId       int        `json:"user_id"`
+	GoalType     string     `json:"goal_type"`
+	ExerciseName *string    `json:"exercise_name"`
+	TargetValue  float64    `json:"target_value"`
+	Deadline     *time.Time `json:"deadline"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type GoalProgress struct {
+	Goal                *Goal      `json:"goal"`
+	CurrentValue        float64    `json:"current_value"`
+	PercentComplete     float64    `json:"percent_complete"`
+	Completed           bool       `json:"completed"`
+	ProjectedCompletion *time.Time `json:"projected_completion"`
+	OnTrack             bool       `json:"on_track"`
+}
+
+type progressPoint struct {
+	at    time.Time
+	value float64
+}
+
+type PostgresGoalStore struct {
+	db *sql.DB
+}
+
+func NewPostgresGoalStore(db *sql.DB) *PostgresGoalStore {
+	return &PostgresGoalStore{db: db}
+}
+
+type GoalStore interface {
+	CreateGoal(context.Context, *Goal) (*Goal, error)
+	GetGoalsByUser(ctx context.Context, userId int) ([]Goal, error)
+	GetGoalOwner(ctx context.Context, id int64) (int, error)
+	DeleteGoal(ctx context.Context, id int64) error
+	GetGoalProgress(ctx context.Context, goal *Goal, now time.Time) (*GoalProgress, error)
+}
+
+func (gs *PostgresGoalStore) CreateGoal(ctx context.Context, goal *Goal) (*Goal, error) {
+	ctx, cancel := withTimeout(ctx, "GoalStore.CreateGoal")
+	defer cancel()
+
+	query := "INSERT INTO goals (user_id, goal_type, exercise_name, target_value, deadline) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at"
+
+	err := gs.db.QueryRowContext(ctx, query, goal.UserId, goal.GoalType, goal.ExerciseName, goal.TargetValue, goal.Deadline).Scan(&goal.Id, &goal.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return goal, nil
+}
+
+func (gs *PostgresGoalStore) GetGoalsByUser(ctx context.Context, userId int) ([]Goal, error) {
+	ctx, cancel := withTimeout(ctx, "GoalStore.GetGoalsByUser")
+	defer cancel()
+
+	query := "SELECT id, user_id, goal_type, exercise_name, target_value, deadline, created_at FROM goals WHERE user_id = $1 ORDER BY created_at"
+	rows, err := gs.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []Goal{}
+	for rows.Next() {
+		goal := Goal{}
+		err = rows.Scan(&goal.Id, &goal.UserId, &goal.GoalType, &goal.ExerciseName, &goal.TargetValue, &goal.Deadline, &goal.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, goal)
+	}
+	return goals, rows.Err()
+}
+
+func (gs *PostgresGoalStore) GetGoalOwner(ctx context.Context, id int64) (int, error) {
+	ctx, cancel := withTimeout(ctx, "GoalStore.GetGoalOwner")
+	defer cancel()
+
+	var userId int
+	query := "SELECT user_id FROM goals WHERE id = $1"
+	err := gs.db.QueryRowContext(ctx, query, id).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return userId, nil
+}
+
+func (gs *PostgresGoalStore) DeleteGoal(ctx context.Context, id int64) error {
+	ctx, cancel := withTimeout(ctx, "GoalStore.DeleteGoal")
+	defer cancel()
+
+	result, err := gs.db.ExecContext(ctx, "DELETE FROM goals WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetGoalProgress computes how far the user is towards the goal from their
+// logged workouts and bodyweight, and projects when it will be reached at the
+// recent rate of progress.
+func (gs *PostgresGoalStore) GetGoalProgress(ctx context.Context, goal *Goal, now time.Time) (*GoalProgress, error) {
+	ctx, cancel := withTimeout(ctx, "GoalStore.GetGoalProgress")
+	defer cancel()
+
+	switch goal.GoalType {
+	case GoalTypeOneRepMax:
+		if goal.ExerciseName == nil {
+			return nil, fmt.Errorf("goal %d has no exercise", goal.Id)
+		}
+		points, err := gs.oneRepMaxHistory(ctx, goal.UserId, *goal.ExerciseName)
+		if err != nil {
+			return nil, err
+		}
+		current := 0.0
+		for _, point := range points {
+			current = math.Max(current, point.value)
+		}
+		progress := newGoalProgress(goal, current, current/goal.TargetValue*100)
+		progress.setProjection(projectTrend(points, current, goal.TargetValue, now))
+		return progress, nil
+
+	case GoalTypeBodyweight:
+		points, err := gs.bodyweightHistory(ctx, goal.UserId)
+		if err != nil {
+			return nil, err
+		}
+		if len(points) == 0 {
+			progress := newGoalProgress(goal, 0, 0)
+			progress.setProjection(nil)
+			return progress, nil
+		}
+		start := points[0].value
+		for _, point := range points {
+			if point.at.After(goal.CreatedAt) {
+				break
+			}
+			start = point.value
+		}
+		current := points[len(points)-1].value
+		percent := 0.0
+		if span := start - goal.TargetValue; span != 0 {
+			percent = (start - current) / span * 100
+		} else if current == goal.TargetValue {
+			percent = 100
+		}
+		progress := newGoalProgress(goal, current, percent)
+		progress.setProjection(projectTrend(points, current, goal.TargetValue, now))
+		return progress, nil
+
+	case GoalTypeWeeklyWorkouts:
+		start := startOfWeek(now)
+		current, err := gs.workoutCount(ctx, goal.UserId, start, now)
+		if err != nil {
+			return nil, err
+		}
+		recent, err := gs.workoutCount(ctx, goal.UserId, now.Add(-trendWindow), now)
+		if err != nil {
+			return nil, err
+		}
+		progress := newGoalProgress(goal, current, current/goal.TargetValue*100)
+		progress.setProjection(projectRate(recent, current, goal.TargetValue, now))
+		return progress, nil
+
+	case GoalTypeMonthlyVolume:
+		start := startOfMonth(now)
+		current, err := gs.workoutVolume(ctx, goal.UserId, start, now)
+		if err != nil {
+			return nil, err
+		}
+		recent, err := gs.workoutVolume(ctx, goal.UserId, now.Add(-trendWindow), now)
+		if err != nil {
+			return nil, err
+		}
+		progress := newGoalProgress(goal, current, current/goal.TargetValue*100)
+		progress.setProjection(projectRate(recent, current, goal.TargetValue, now))
+		return progress, nil
+	}
+	return nil, fmt.Errorf("unknown goal type %q", goal.GoalType)
+}
+
+// oneRepMaxHistory returns the best estimated one rep max (Epley formula) of
+// each workout containing the exercise.
+func (gs *PostgresGoalStore) oneRepMaxHistory(ctx context.Context, userId int, exerciseName string) ([]progressPoint, error) {
+	query := "SELECT w.created_at, MAX(CASE WHEN e.reps = 1 THEN e.weight ELSE e.weight * (1 + e.reps / 30.0) END) " +
+		"FROM workout_entries e INNER JOIN workout w ON w.id = e.workout_id " +
+		"WHERE w.user_id = $1 AND w.deleted_at IS NULL AND LOWER(e.exercise_name) = LOWER($2) AND e.weight IS NOT NULL AND e.reps IS NOT NULL " +
+		"GROUP BY w.id, w.created_at ORDER BY w.created_at"
+	return gs.queryPoints(ctx, query, userId, exerciseName)
+}
+
+func (gs *PostgresGoalStore) bodyweightHistory(ctx context.Context, userId int) ([]progressPoint, error) {
+	query := "SELECT recorded_at, weight FROM bodyweight_entries WHERE user_id = $1 ORDER BY recorded_at"
+	return gs.queryPoints(ctx, query, userId)
+}
+
+func (gs *PostgresGoalStore) queryPoints(ctx context.Context, query string, args ...interface{}) ([]progressPoint, error) {
+	rows, err := gs.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []progressPoint
+	for rows.Next() {
+		point := progressPoint{}
+		err = rows.Scan(&point.at, &point.value)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	return points, rows.Err()
+}
+
+func (gs *PostgresGoalStore) workoutCount(ctx context.Context, userId int, from, to time.Time) (float64, error) {
+	var count float64
+	query := "SELECT COUNT(*) FROM workout WHERE user_id = $1 AND created_at >= $2 AND created_at < $3 AND deleted_at IS NULL"
+	err := gs.db.QueryRowContext(ctx, query, userId, from, to).Scan(&count)
+	return count, err
+}
+
+func (gs *PostgresGoalStore) workoutVolume(ctx context.Context, userId int, from, to time.Time) (float64, error) {
+	var volume float64
+	query := "SELECT COALESCE(SUM(e.sets * e.reps * e.weight), 0) FROM workout_entries e " +
+		"INNER JOIN workout w ON w.id = e.workout_id WHERE w.user_id = $1 AND w.created_at >= $2 AND w.created_at < $3 AND w.deleted_at IS NULL"
+	err := gs.db.QueryRowContext(ctx, query, userId, from, to).Scan(&volume)
+	return volume, err
+}
+
+func newGoalProgress(goal *Goal, current, percent float64) *GoalProgress {
+	percent = math.Min(math.Max(percent, 0), 100)
+	return &GoalProgress{
+		Goal:            goal,
+		CurrentValue:    math.Round(current*100) / 100,
+		PercentComplete: math.Round(percent*10) / 10,
+		Completed:       percent >= 100,
+	}
+}
+
+func (p *GoalProgress) setProjection(projected *time.Time) {
+	if p.Completed {
+		p.OnTrack = true
+		return
+	}
+	p.ProjectedCompletion = projected
+	p.OnTrack = projected != nil && (p.Goal.Deadline == nil || !projected.After(*p.Goal.Deadline))
+}
+
+// projectTrend fits a line through the points inside the trend window and
+// returns when the current value reaches the target at that slope.
+func projectTrend(points []progressPoint, current, target float64, now time.Time) *time.Time {
+	var recent []progressPoint
+	for _, point := range points {
+		if now.Sub(point.at) <= trendWindow {
+			recent = append(recent, point)
+		}
+	}
+	if len(recent) < 2 {
+		return nil
+	}
+
+	origin := recent[0].at
+	var meanX, meanY float64
+	for _, point := range recent {
+		meanX += point.at.Sub(origin).Hours() / 24
+		meanY += point.value
+	}
+	meanX /= float64(len(recent))
+	meanY /= float64(len(recent))
+
+	var covariance, variance float64
+	for _, point := range recent {
+		dx := point.at.Sub(origin).Hours()/24 - meanX
+		covariance += dx * (point.value - meanY)
+		variance += dx * dx
+	}
+	if variance == 0 || covariance == 0 {
+		return nil
+	}
+	return projectDays((target-current)/(covariance/variance), now)
+}
+
+// projectRate returns when the target is reached if the user keeps the
+// per-day rate they averaged over the trend window.
+func projectRate(recentTotal, current, target float64, now time.Time) *time.Time {
+	rate := recentTotal / (trendWindow.Hours() / 24)
+	if rate <= 0 {
+		return nil
+	}
+	return projectDays((target-current)/rate, now)
+}
+
+func projectDays(days float64, now time.Time) *time.Time {
+	if days < 0 || days > maxProjectionDays {
+		return nil
+	}
+	projected := now.Add(time.Duration(days * 24 * float64(time.Hour)))
+	return &projected
+}
+
+func startOfWeek(t time.Time) time.Time {
+	year, month, day := t.Date()
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+}
+
+func startOfMonth(t time.Time) time.Time {
+	year, month, _ := t.Date()
+	return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+}
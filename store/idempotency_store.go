@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// IdempotencyKey is the request a client sent with an Idempotency-Key and,
+// once it has been handled, the response to replay when the request is
+// retried. StatusCode is 0 while the request is still being handled.
+type IdempotencyKey struct {
+	UserId      int
+	Key         string
+	RequestHash []byte
+	StatusCode  int
+	ContentType string
+	Response    []byte
+	CreatedAt   time.Time
+}
+
+type PostgresIdempotencyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresIdempotencyStore(db *sql.DB) *PostgresIdempotencyStore {
+	return &PostgresIdempotencyStore{db: db}
+}
+
+// IdempotencyStore keeps the idempotency keys of each user. A key is
+// reserved by the first request carrying it and holds that request's
+// response until it expires.
+type IdempotencyStore interface {
+	ReserveKey(ctx context.Context, key *IdempotencyKey, expiredBefore, abandonedBefore time.Time) (*IdempotencyKey, error)
+	SaveResponse(ctx context.Context, key *IdempotencyKey) error
+	ReleaseKey(ctx context.Context, key *IdempotencyKey) error
+	PurgeKeys(ctx context.Context, createdBefore time.Time) (int64, error)
+}
+
+// ReserveKey claims key for the request it describes and returns nil, or
+// returns the record already holding the key. A key created before
+// expiredBefore, or still without a response since before abandonedBefore,
+// is claimed as if it were new.
+func (is *PostgresIdempotencyStore) ReserveKey(ctx context.Context, key *IdempotencyKey, expiredBefore, abandonedBefore time.Time) (*IdempotencyKey, error) {
+	ctx, cancel := withTimeout(ctx, "IdempotencyStore.ReserveKey")
+	defer cancel()
+
+	query := "INSERT INTO idempotency_keys (user_id, key, request_hash, created_at) VALUES ($1, $2, $3, $4) " +
+		"ON CONFLICT (user_id, key) DO UPDATE SET request_hash = EXCLUDED.request_hash, status_code = NULL, content_type = '', response = NULL, created_at = EXCLUDED.created_at " +
+		"WHERE idempotency_keys.created_at < $5 OR (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at < $6) RETURNING created_at"
+	err := is.db.QueryRowContext(ctx, query, key.UserId, key.Key, key.RequestHash, time.Now(), expiredBefore, abandonedBefore).Scan(&key.CreatedAt)
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	existing := &IdempotencyKey{UserId: key.UserId, Key: key.Key}
+	var statusCode sql.NullInt64
+	query = "SELECT request_hash, status_code, content_type, response, created_at FROM idempotency_keys WHERE user_id = $1 AND key = $2"
+	err = is.db.QueryRowContext(ctx, query, key.UserId, key.Key).Scan(&existing.RequestHash, &statusCode, &existing.ContentType, &existing.Response, &existing.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	existing.StatusCode = int(statusCode.Int64)
+	return existing, nil
+}
+
+// SaveResponse stores the response to the request that reserved the key,
+// unless another request has since claimed it.
+func (is *PostgresIdempotencyStore) SaveResponse(ctx context.Context, key *IdempotencyKey) error {
+	ctx, cancel := withTimeout(ctx, "IdempotencyStore.SaveResponse")
+	defer cancel()
+
+	query := "UPDATE idempotency_keys SET status_code = $3, content_type = $4, response = $5 WHERE user_id = $1 AND key = $2 AND created_at = $6"
+	_, err := is.db.ExecContext(ctx, query, key.UserId, key.Key, key.StatusCode, key.ContentType, key.Response, key.CreatedAt)
+	return err
+}
+
+// ReleaseKey frees a key whose request failed, so a retry is handled
+// afresh.
+func (is *PostgresIdempotencyStore) ReleaseKey(ctx context.Context, key *IdempotencyKey) error {
+	ctx, cancel := withTimeout(ctx, "IdempotencyStore.ReleaseKey")
+	defer cancel()
+
+	query := "DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND created_at = $3 AND status_code IS NULL"
+	_, err := is.db.ExecContext(ctx, query, key.UserId, key.Key, key.CreatedAt)
+	return err
+}
+
+func (is *PostgresIdempotencyStore) PurgeKeys(ctx context.Context, createdBefore time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx, "IdempotencyStore.PurgeKeys")
+	defer cancel()
+
+	result, err := is.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE created_at < $1", createdBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
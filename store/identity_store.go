@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// OIDCLogin is a login started with an external provider, waiting for the
+// provider to redirect back. UserId is set when a logged in user is linking
+// the identity to their account rather than logging in.
+type OIDCLogin struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	UserId       *int
+	ExpiresAt    time.Time
+}
+
+type PostgresIdentityStore struct {
+	db *sql.DB
+}
+
+func NewPostgresIdentityStore(db *sql.DB) *PostgresIdentityStore {
+	return &PostgresIdentityStore{db: db}
+}
+
+type IdentityStore interface {
+	SaveOIDCLogin(ctx context.Context, login *OIDCLogin, stateHash []byte) error
+	ConsumeOIDCLogin(ctx context.Context, stateHash []byte) (*OIDCLogin, error)
+	GetUserByIdentity(ctx context.Context, provider, subject string) (*User, error)
+	LinkIdentity(ctx context.Context, userId int, provider, subject, email string) error
+	PurgeOIDCLogins(ctx context.Context, expiredBefore time.Time) (int64, error)
+}
+
+func (is *PostgresIdentityStore) SaveOIDCLogin(ctx context.Context, login *OIDCLogin, stateHash []byte) error {
+	ctx, cancel := withTimeout(ctx, "IdentityStore.SaveOIDCLogin")
+	defer cancel()
+
+	query := "INSERT INTO oidc_logins (state_hash, provider, nonce, code_verifier, user_id, expires_at) VALUES ($1, $2, $3, $4, $5, $6)"
+	_, err := is.db.ExecContext(ctx, query, stateHash, login.Provider, login.Nonce, login.CodeVerifier, login.UserId, login.ExpiresAt)
+	return err
+}
+
+// ConsumeOIDCLogin deletes and returns an unexpired login, so each state
+// is accepted once.
+func (is *PostgresIdentityStore) ConsumeOIDCLogin(ctx context.Context, stateHash []byte) (*OIDCLogin, error) {
+	ctx, cancel := withTimeout(ctx, "IdentityStore.ConsumeOIDCLogin")
+	defer cancel()
+
+	login := &OIDCLogin{}
+	query := "DELETE FROM oidc_logins WHERE state_hash = $1 AND expires_at > $2 RETURNING provider, nonce, code_verifier, user_id, expires_at"
+	err := is.db.QueryRowContext(ctx, query, stateHash, time.Now()).Scan(&login.Provider, &login.Nonce, &login.CodeVerifier, &login.UserId, &login.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+func (is *PostgresIdentityStore) GetUserByIdentity(ctx context.Context, provider, subject string) (*User, error) {
+	ctx, cancel := withTimeout(ctx, "IdentityStore.GetUserByIdentity")
+	defer cancel()
+
+	query := "SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.timezone, u.created_at, u.updated_at " +
+		"FROM users u INNER JOIN user_identities i ON i.user_id = u.id WHERE i.provider = $1 AND i.subject = $2"
+
+	user := &User{
+		PasswordHash: password{},
+	}
+	err := is.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&user.Id,
+		&user.UserName,
+		&user.Email,
+		&user.PasswordHash.hash,
+		&user.Bio,
+		&user.Timezone,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (is *PostgresIdentityStore) LinkIdentity(ctx context.Context, userId int, provider, subject, email string) error {
+	ctx, cancel := withTimeout(ctx, "IdentityStore.LinkIdentity")
+	defer cancel()
+
+	query := "INSERT INTO user_identities (provider, subject, user_id, email) VALUES ($1, $2, $3, $4)"
+	_, err := is.db.ExecContext(ctx, query, provider, subject, userId, email)
+	return err
+}
+
+// PurgeOIDCLogins deletes logins that were never finished.
+func (is *PostgresIdentityStore) PurgeOIDCLogins(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx, "IdentityStore.PurgeOIDCLogins")
+	defer cancel()
+
+	result, err := is.db.ExecContext(ctx, "DELETE FROM oidc_logins WHERE expires_at < $1", expiredBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,258 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Job statuses. A dead job failed every attempt and waits for someone to
+// look at it.
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+// Job is a unit of background work. Jobs with a UniqueKey are enqueued at
+// most once.
+type Job struct {
+	Id          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedUntil *time.Time      `json:"locked_until"`
+	LastError   *string         `json:"last_error"`
+	UniqueKey   *string         `json:"unique_key"`
+	CreatedAt   time.Time       `json:"created_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+}
+
+// JobStats counts the jobs of a kind in a status.
+type JobStats struct {
+	Kind   string     `json:"kind"`
+	Status string     `json:"status"`
+	Count  int        `json:"count"`
+	Oldest *time.Time `json:"oldest"`
+}
+
+type PostgresJobStore struct {
+	db *sql.DB
+}
+
+func NewPostgresJobStore(db *sql.DB) *PostgresJobStore {
+	return &PostgresJobStore{db: db}
+}
+
+type JobStore interface {
+	EnqueueJob(ctx context.Context, job *Job) (bool, error)
+	ClaimJobs(ctx context.Context, limit int, lease time.Duration) ([]Job, error)
+	CompleteJob(ctx context.Context, job *Job) (bool, error)
+	RetryJob(ctx context.Context, job *Job, runAt time.Time, lastError string) (bool, error)
+	BuryJob(ctx context.Context, job *Job, lastError string) (bool, error)
+	GetJobStats(ctx context.Context) ([]JobStats, error)
+	GetJobs(ctx context.Context, status string, limit int) ([]Job, error)
+	RequeueJob(ctx context.Context, id int64) (bool, error)
+	PurgeJobs(ctx context.Context, finishedBefore time.Time) (int64, error)
+}
+
+// queryRower is a *sql.DB or a *sql.Tx, so that stores can enqueue jobs in
+// the transaction of the change they report.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// enqueueJob inserts a job, doing nothing when its unique key is taken. It
+// reports whether the job was inserted.
+func enqueueJob(ctx context.Context, q queryRower, job *Job) (bool, error) {
+	runAt := job.RunAt
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+	query := "INSERT INTO jobs (kind, payload, run_at, unique_key) VALUES ($1, $2, $3, $4) " +
+		"ON CONFLICT (unique_key) DO NOTHING RETURNING id, status, run_at, created_at"
+	err := q.QueryRowContext(ctx, query, job.Kind, []byte(job.Payload), runAt, job.UniqueKey).
+		Scan(&job.Id, &job.Status, &job.RunAt, &job.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// enqueueOutbox marshals payload into a job of kind, written by q.
+func enqueueOutbox(ctx context.Context, q queryRower, kind string, payload interface{}) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = enqueueJob(ctx, q, &Job{Kind: kind, Payload: encoded})
+	return err
+}
+
+func (js *PostgresJobStore) EnqueueJob(ctx context.Context, job *Job) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "JobStore.EnqueueJob")
+	defer cancel()
+
+	return enqueueJob(ctx, js.db, job)
+}
+
+const jobColumns = "id, kind, payload, status, attempts, run_at, locked_until, last_error, unique_key, created_at, finished_at"
+
+func scanJobs(rows *sql.Rows) ([]Job, error) {
+	jobs := []Job{}
+	for rows.Next() {
+		var job Job
+		var payload []byte
+		err := rows.Scan(&job.Id, &job.Kind, &payload, &job.Status, &job.Attempts, &job.RunAt, &job.LockedUntil, &job.LastError, &job.UniqueKey, &job.CreatedAt, &job.FinishedAt)
+		if err != nil {
+			return nil, err
+		}
+		job.Payload = payload
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// ClaimJobs marks up to limit due jobs as running for lease and counts the
+// attempt. Jobs locked by other workers are skipped; a running job whose
+// lease ran out, because its worker stopped, is claimed again.
+func (js *PostgresJobStore) ClaimJobs(ctx context.Context, limit int, lease time.Duration) ([]Job, error) {
+	ctx, cancel := withTimeout(ctx, "JobStore.ClaimJobs")
+	defer cancel()
+
+	now := time.Now()
+	query := "UPDATE jobs SET status = 'running', attempts = attempts + 1, locked_until = $3 WHERE id IN (" +
+		"SELECT id FROM jobs WHERE (status = 'pending' AND run_at <= $1) OR (status = 'running' AND locked_until <= $1) " +
+		"ORDER BY run_at LIMIT $2 FOR UPDATE SKIP LOCKED) RETURNING " + jobColumns
+	rows, err := js.db.QueryContext(ctx, query, now, limit, now.Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanJobs(rows)
+}
+
+// recordOutcome runs an update of a claimed job's outcome, whose last two
+// arguments are the job's id and the lease it was claimed with. The
+// outcome is recorded only while the job is still held by that claim: once
+// the lease ran out another worker may have claimed the job again, and
+// that worker's outcome wins. It reports whether the outcome was recorded.
+func (js *PostgresJobStore) recordOutcome(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	result, err := js.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// CompleteJob marks a claimed job as succeeded.
+func (js *PostgresJobStore) CompleteJob(ctx context.Context, job *Job) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "JobStore.CompleteJob")
+	defer cancel()
+
+	query := "UPDATE jobs SET status = 'succeeded', locked_until = NULL, last_error = NULL, finished_at = $1 " +
+		"WHERE id = $2 AND status = 'running' AND locked_until = $3"
+	return js.recordOutcome(ctx, query, time.Now(), job.Id, job.LockedUntil)
+}
+
+// RetryJob returns a failed claimed job to the queue, due at runAt.
+func (js *PostgresJobStore) RetryJob(ctx context.Context, job *Job, runAt time.Time, lastError string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "JobStore.RetryJob")
+	defer cancel()
+
+	query := "UPDATE jobs SET status = 'pending', run_at = $1, locked_until = NULL, last_error = $2 " +
+		"WHERE id = $3 AND status = 'running' AND locked_until = $4"
+	return js.recordOutcome(ctx, query, runAt, lastError, job.Id, job.LockedUntil)
+}
+
+// BuryJob moves a claimed job that will not be retried to the dead
+// letters.
+func (js *PostgresJobStore) BuryJob(ctx context.Context, job *Job, lastError string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "JobStore.BuryJob")
+	defer cancel()
+
+	query := "UPDATE jobs SET status = 'dead', locked_until = NULL, last_error = $1, finished_at = $2 " +
+		"WHERE id = $3 AND status = 'running' AND locked_until = $4"
+	return js.recordOutcome(ctx, query, lastError, time.Now(), job.Id, job.LockedUntil)
+}
+
+// GetJobStats counts jobs by kind and status, with the run_at of the
+// oldest, which shows how far behind the queue is.
+func (js *PostgresJobStore) GetJobStats(ctx context.Context) ([]JobStats, error) {
+	ctx, cancel := withTimeout(ctx, "JobStore.GetJobStats")
+	defer cancel()
+
+	query := "SELECT kind, status, COUNT(*), MIN(run_at) FROM jobs GROUP BY kind, status ORDER BY kind, status"
+	rows, err := js.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []JobStats{}
+	for rows.Next() {
+		var stat JobStats
+		err = rows.Scan(&stat.Kind, &stat.Status, &stat.Count, &stat.Oldest)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+// GetJobs returns the latest jobs in a status, newest first.
+func (js *PostgresJobStore) GetJobs(ctx context.Context, status string, limit int) ([]Job, error) {
+	ctx, cancel := withTimeout(ctx, "JobStore.GetJobs")
+	defer cancel()
+
+	query := "SELECT " + jobColumns + " FROM jobs WHERE status = $1 ORDER BY created_at DESC, id DESC LIMIT $2"
+	rows, err := js.db.QueryContext(ctx, query, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanJobs(rows)
+}
+
+// RequeueJob gives a dead job a fresh set of attempts. It reports false
+// when there is no dead job with that id.
+func (js *PostgresJobStore) RequeueJob(ctx context.Context, id int64) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "JobStore.RequeueJob")
+	defer cancel()
+
+	query := "UPDATE jobs SET status = 'pending', attempts = 0, run_at = $1, finished_at = NULL WHERE id = $2 AND status = 'dead'"
+	result, err := js.db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// PurgeJobs deletes succeeded jobs that finished before finishedBefore.
+// Dead jobs are kept until they are requeued.
+func (js *PostgresJobStore) PurgeJobs(ctx context.Context, finishedBefore time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx, "JobStore.PurgeJobs")
+	defer cancel()
+
+	result, err := js.db.ExecContext(ctx, "DELETE FROM jobs WHERE status = 'succeeded' AND finished_at < $1", finishedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
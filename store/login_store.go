@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	LoginSucceeded     = "success"
+	LoginWrongPassword = "wrong_password"
+	LoginUnknownUser   = "unknown_user"
+	LoginLocked        = "locked"
+	LoginMFARequired   = "mfa_required"
+	LoginWrongMFACode  = "wrong_mfa_code"
+	// LoginMFAVerified is a correct code given outside a login, such as to
+	// turn two-factor authentication off. It neither fails nor resets the
+	// lockout.
+	LoginMFAVerified = "mfa_verified"
+	// LoginPending is an attempt still being checked. It counts as a
+	// failure until it is finished, and stays one if it never is.
+	LoginPending = "pending"
+)
+
+// LoginAttempt is the audit record of one login. UserId is nil when the
+// username did not match an account.
+type LoginAttempt struct {
+	Id          int       `json:"id"`
+	Username    string    `json:"username"`
+	UserId      *int      `json:"user_id"`
+	Outcome     string    `json:"outcome"`
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// LoginFailures counts the failed logins for a username since its last
+// successful one. Wrong two-factor codes and pending attempts count as
+// failures too. Times holds when each happened, oldest first.
+type LoginFailures struct {
+	Count int
+	Times []time.Time
+}
+
+type PostgresLoginStore struct {
+	db *sql.DB
+}
+
+func NewPostgresLoginStore(db *sql.DB) *PostgresLoginStore {
+	return &PostgresLoginStore{db: db}
+}
+
+// LoginStore records login attempts. A login checked against the lockout
+// starts its attempt before verifying anything and finishes it with the
+// outcome, so that concurrent logins for a username each see the others.
+type LoginStore interface {
+	RecordLoginAttempt(context.Context, *LoginAttempt) error
+	StartLoginAttempt(ctx context.Context, attempt *LoginAttempt, since time.Time, maxFailures int) (*LoginFailures, error)
+	FinishLoginAttempt(ctx context.Context, attempt *LoginAttempt) error
+}
+
+func (ls *PostgresLoginStore) RecordLoginAttempt(ctx context.Context, attempt *LoginAttempt) error {
+	ctx, cancel := withTimeout(ctx, "LoginStore.RecordLoginAttempt")
+	defer cancel()
+
+	return recordLoginAttempt(ctx, ls.db, attempt)
+}
+
+func recordLoginAttempt(ctx context.Context, q queryRower, attempt *LoginAttempt) error {
+	query := "INSERT INTO login_attempts (username, user_id, outcome, ip_address, user_agent) VALUES ($1, $2, $3, $4, $5) RETURNING id, attempted_at"
+	return q.QueryRowContext(ctx, query, attempt.Username, attempt.UserId, attempt.Outcome, attempt.IPAddress, attempt.UserAgent).Scan(&attempt.Id, &attempt.AttemptedAt)
+}
+
+// StartLoginAttempt returns the failures of attempt's username since since
+// and records the attempt: as LoginLocked when there are maxFailures or
+// more, and as LoginPending otherwise. Attempts for a username start one at
+// a time, holding a lock on its login_locks row for only this short
+// transaction, so no two of them see the same failures.
+func (ls *PostgresLoginStore) StartLoginAttempt(ctx context.Context, attempt *LoginAttempt, since time.Time, maxFailures int) (*LoginFailures, error) {
+	ctx, cancel := withTimeout(ctx, "LoginStore.StartLoginAttempt")
+	defer cancel()
+
+	tx, err := ls.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO login_locks (username) VALUES ($1) ON CONFLICT DO NOTHING", attempt.Username)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, "SELECT username FROM login_locks WHERE username = $1 FOR UPDATE", attempt.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	failures, err := getRecentFailures(ctx, tx, attempt.Username, since)
+	if err != nil {
+		return nil, err
+	}
+	attempt.Outcome = LoginPending
+	if failures.Count >= maxFailures {
+		attempt.Outcome = LoginLocked
+	}
+	err = recordLoginAttempt(ctx, tx, attempt)
+	if err != nil {
+		return nil, err
+	}
+	return failures, tx.Commit()
+}
+
+// FinishLoginAttempt records the outcome of a pending attempt.
+func (ls *PostgresLoginStore) FinishLoginAttempt(ctx context.Context, attempt *LoginAttempt) error {
+	ctx, cancel := withTimeout(ctx, "LoginStore.FinishLoginAttempt")
+	defer cancel()
+
+	query := "UPDATE login_attempts SET outcome = $1, user_id = $2 WHERE id = $3 AND outcome = $4"
+	_, err := ls.db.ExecContext(ctx, query, attempt.Outcome, attempt.UserId, attempt.Id, LoginPending)
+	return err
+}
+
+// getRecentFailures counts failures by username rather than account, so a
+// username that does not exist locks exactly like one that does.
+func getRecentFailures(ctx context.Context, tx *sql.Tx, username string, since time.Time) (*LoginFailures, error) {
+	query := "SELECT attempted_at FROM login_attempts " +
+		"WHERE username = $1 AND outcome IN ($3, $4, $5, $6) AND attempted_at > GREATEST($2, " +
+		"(SELECT COALESCE(MAX(attempted_at), '-infinity') FROM login_attempts WHERE username = $1 AND outcome = $7)) " +
+		"ORDER BY attempted_at"
+	rows, err := tx.QueryContext(ctx, query, username, since, LoginWrongPassword, LoginUnknownUser, LoginWrongMFACode, LoginPending, LoginSucceeded)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := &LoginFailures{Times: []time.Time{}}
+	for rows.Next() {
+		var attemptedAt time.Time
+		err = rows.Scan(&attemptedAt)
+		if err != nil {
+			return nil, err
+		}
+		failures.Times = append(failures.Times, attemptedAt)
+	}
+	failures.Count = len(failures.Times)
+	return failures, rows.Err()
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// MFA is a user's TOTP enrollment. It is pending until the first code is
+// verified, and only enabled enrollments are asked for at login.
+type MFA struct {
+	UserId   int
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+type PostgresMFAStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMFAStore(db *sql.DB) *PostgresMFAStore {
+	return &PostgresMFAStore{db: db}
+}
+
+type MFAStore interface {
+	GetMFA(ctx context.Context, userId int) (*MFA, error)
+	SavePendingMFA(ctx context.Context, userId int, secret string) error
+	EnableMFA(ctx context.Context, userId int, step int64, recoveryCodeHashes [][]byte) error
+	UseTOTPStep(ctx context.Context, userId int, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userId int, codeHash []byte) (bool, error)
+	DisableMFA(ctx context.Context, userId int) error
+}
+
+func (ms *PostgresMFAStore) GetMFA(ctx context.Context, userId int) (*MFA, error) {
+	ctx, cancel := withTimeout(ctx, "MFAStore.GetMFA")
+	defer cancel()
+
+	mfa := &MFA{}
+	query := "SELECT user_id, totp_secret, enabled, last_step FROM user_mfa WHERE user_id = $1"
+	err := ms.db.QueryRowContext(ctx, query, userId).Scan(&mfa.UserId, &mfa.Secret, &mfa.Enabled, &mfa.LastStep)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mfa, nil
+}
+
+// SavePendingMFA starts a new enrollment, replacing a pending one. It never
+// overwrites an enabled enrollment.
+func (ms *PostgresMFAStore) SavePendingMFA(ctx context.Context, userId int, secret string) error {
+	ctx, cancel := withTimeout(ctx, "MFAStore.SavePendingMFA")
+	defer cancel()
+
+	query := "INSERT INTO user_mfa (user_id, totp_secret) VALUES ($1, $2) " +
+		"ON CONFLICT (user_id) DO UPDATE SET totp_secret = EXCLUDED.totp_secret, last_step = 0, created_at = CURRENT_TIMESTAMP " +
+		"WHERE NOT user_mfa.enabled"
+	result, err := ms.db.ExecContext(ctx, query, userId, secret)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// EnableMFA activates a pending enrollment whose code for step was verified
+// and replaces the user's recovery codes.
+func (ms *PostgresMFAStore) EnableMFA(ctx context.Context, userId int, step int64, recoveryCodeHashes [][]byte) error {
+	ctx, cancel := withTimeout(ctx, "MFAStore.EnableMFA")
+	defer cancel()
+
+	tx, err := ms.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE user_mfa SET enabled = TRUE, last_step = $2 WHERE user_id = $1 AND NOT enabled", userId, step)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, "INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userId, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records that the code for step was used. It reports false if
+// that step or a later one was used already, so a code works only once.
+func (ms *PostgresMFAStore) UseTOTPStep(ctx context.Context, userId int, step int64) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "MFAStore.UseTOTPStep")
+	defer cancel()
+
+	result, err := ms.db.ExecContext(ctx, "UPDATE user_mfa SET last_step = $2 WHERE user_id = $1 AND last_step < $2", userId, step)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode spends an unused recovery code, reporting false if there
+// is none with that hash.
+func (ms *PostgresMFAStore) UseRecoveryCode(ctx context.Context, userId int, codeHash []byte) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "MFAStore.UseRecoveryCode")
+	defer cancel()
+
+	query := "UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL"
+	result, err := ms.db.ExecContext(ctx, query, userId, codeHash)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+func (ms *PostgresMFAStore) DisableMFA(ctx context.Context, userId int) error {
+	ctx, cancel := withTimeout(ctx, "MFAStore.DisableMFA")
+	defer cancel()
+
+	tx, err := ms.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_mfa WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
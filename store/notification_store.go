@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// JobSendNotification jobs carry a NotificationJob to one channel, so that
+// each channel is retried on its own.
+const JobSendNotification = "send_notification"
+
+// Notification is a message for a user. In-app notifications are kept
+// until the user deletes their account.
+type Notification struct {
+	Id        int64           `json:"id"`
+	UserId    int             `json:"-"`
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	ReadAt    *time.Time      `json:"read_at"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NotificationJob is the payload of a JobSendNotification job. Key names
+// the notification across channels and retries.
+type NotificationJob struct {
+	Key          string       `json:"key"`
+	Channel      string       `json:"channel"`
+	UserId       int          `json:"user_id"`
+	Email        string       `json:"email"`
+	Notification Notification `json:"notification"`
+}
+
+type PostgresNotificationStore struct {
+	db *sql.DB
+}
+
+func NewPostgresNotificationStore(db *sql.DB) *PostgresNotificationStore {
+	return &PostgresNotificationStore{db: db}
+}
+
+type NotificationStore interface {
+	CreateNotification(ctx context.Context, notification *Notification) error
+	GetNotifications(ctx context.Context, userId int, unreadOnly bool, limit int) ([]Notification, error)
+	CountUnread(ctx context.Context, userId int) (int, error)
+	MarkRead(ctx context.Context, id int64, userId int) (bool, error)
+	MarkAllRead(ctx context.Context, userId int) (int64, error)
+}
+
+func (ns *PostgresNotificationStore) CreateNotification(ctx context.Context, notification *Notification) error {
+	ctx, cancel := withTimeout(ctx, "NotificationStore.CreateNotification")
+	defer cancel()
+
+	var data []byte
+	if len(notification.Data) > 0 {
+		data = notification.Data
+	}
+	query := "INSERT INTO notifications (user_id, type, title, body, data) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at"
+	return ns.db.QueryRowContext(ctx, query, notification.UserId, notification.Type, notification.Title, notification.Body, data).
+		Scan(&notification.Id, &notification.CreatedAt)
+}
+
+// GetNotifications returns the user's latest notifications, newest first.
+func (ns *PostgresNotificationStore) GetNotifications(ctx context.Context, userId int, unreadOnly bool, limit int) ([]Notification, error) {
+	ctx, cancel := withTimeout(ctx, "NotificationStore.GetNotifications")
+	defer cancel()
+
+	query := "SELECT id, user_id, type, title, body, data, read_at, created_at FROM notifications " +
+		"WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL) ORDER BY created_at DESC, id DESC LIMIT $3"
+	rows, err := ns.db.QueryContext(ctx, query, userId, unreadOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var notification Notification
+		var data []byte
+		err = rows.Scan(&notification.Id, &notification.UserId, &notification.Type, &notification.Title, &notification.Body, &data, &notification.ReadAt, &notification.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		notification.Data = data
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+func (ns *PostgresNotificationStore) CountUnread(ctx context.Context, userId int) (int, error) {
+	ctx, cancel := withTimeout(ctx, "NotificationStore.CountUnread")
+	defer cancel()
+
+	var count int
+	err := ns.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL", userId).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks a notification read. It reports false when the user has
+// no notification with that id.
+func (ns *PostgresNotificationStore) MarkRead(ctx context.Context, id int64, userId int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "NotificationStore.MarkRead")
+	defer cancel()
+
+	query := "UPDATE notifications SET read_at = COALESCE(read_at, $1) WHERE id = $2 AND user_id = $3"
+	result, err := ns.db.ExecContext(ctx, query, time.Now(), id, userId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// MarkAllRead marks every unread notification of the user read and returns
+// how many there were.
+func (ns *PostgresNotificationStore) MarkAllRead(ctx context.Context, userId int) (int64, error) {
+	ctx, cancel := withTimeout(ctx, "NotificationStore.MarkAllRead")
+	defer cancel()
+
+	result, err := ns.db.ExecContext(ctx, "UPDATE notifications SET read_at = $1 WHERE user_id = $2 AND read_at IS NULL", time.Now(), userId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
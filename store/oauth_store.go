@@ -0,0 +1,258 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"workout-tracker/tokens"
+)
+
+const (
+	OAuthAccessToken  = "access"
+	OAuthRefreshToken = "refresh"
+)
+
+// OAuthClient is a third-party app registered by a user. Public clients,
+// such as mobile apps, have no secret and rely on PKCE alone.
+type OAuthClient struct {
+	Id           string    `json:"client_id"`
+	UserId       int       `json:"-"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	SecretHash   []byte    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (c *OAuthClient) Confidential() bool {
+	return c.SecretHash != nil
+}
+
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	for _, registered := range c.RedirectURIs {
+		if uri == registered {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizationCode is the consent a user gave a client, waiting to be
+// exchanged for tokens.
+type AuthorizationCode struct {
+	ClientId      string
+	UserId        int
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+// OAuthToken is an access or refresh token issued to a client. Tokens
+// issued from the same authorization share a GrantId and are revoked
+// together.
+type OAuthToken struct {
+	GrantId   string
+	Kind      string
+	ClientId  string
+	UserId    int
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+func (t *OAuthToken) HasScope(scope string) bool {
+	for _, granted := range t.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type PostgresOAuthStore struct {
+	db *sql.DB
+}
+
+func NewPostgresOAuthStore(db *sql.DB) *PostgresOAuthStore {
+	return &PostgresOAuthStore{db: db}
+}
+
+type OAuthStore interface {
+	CreateClient(ctx context.Context, client *OAuthClient) error
+	GetClient(ctx context.Context, id string) (*OAuthClient, error)
+	CreateAuthorizationCode(ctx context.Context, code *AuthorizationCode, hash []byte) error
+	ConsumeAuthorizationCode(ctx context.Context, hash []byte, clientId string) (*AuthorizationCode, error)
+	CreateOAuthTokens(ctx context.Context, tokens []*OAuthToken, hashes [][]byte) error
+	GetOAuthToken(ctx context.Context, hash []byte) (*OAuthToken, error)
+	ConsumeRefreshToken(ctx context.Context, hash []byte, clientId string) (*OAuthToken, error)
+	RevokeGrant(ctx context.Context, hash []byte, clientId string) error
+	GetUserByAccessToken(ctx context.Context, plainText string) (*User, *OAuthToken, error)
+}
+
+func (oas *PostgresOAuthStore) CreateClient(ctx context.Context, client *OAuthClient) error {
+	ctx, cancel := withTimeout(ctx, "OAuthStore.CreateClient")
+	defer cancel()
+
+	query := "INSERT INTO oauth_clients (id, user_id, name, secret_hash, redirect_uris) VALUES ($1, $2, $3, $4, $5) RETURNING created_at"
+	return oas.db.QueryRowContext(ctx, query, client.Id, client.UserId, client.Name, client.SecretHash, strings.Join(client.RedirectURIs, " ")).Scan(&client.CreatedAt)
+}
+
+func (oas *PostgresOAuthStore) GetClient(ctx context.Context, id string) (*OAuthClient, error) {
+	ctx, cancel := withTimeout(ctx, "OAuthStore.GetClient")
+	defer cancel()
+
+	client := &OAuthClient{}
+	var redirectURIs string
+	query := "SELECT id, user_id, name, secret_hash, redirect_uris, created_at FROM oauth_clients WHERE id = $1"
+	err := oas.db.QueryRowContext(ctx, query, id).Scan(&client.Id, &client.UserId, &client.Name, &client.SecretHash, &redirectURIs, &client.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	client.RedirectURIs = strings.Fields(redirectURIs)
+	return client, nil
+}
+
+func (oas *PostgresOAuthStore) CreateAuthorizationCode(ctx context.Context, code *AuthorizationCode, hash []byte) error {
+	ctx, cancel := withTimeout(ctx, "OAuthStore.CreateAuthorizationCode")
+	defer cancel()
+
+	query := "INSERT INTO oauth_codes (hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	_, err := oas.db.ExecContext(ctx, query, hash, code.ClientId, code.UserId, code.RedirectURI, strings.Join(code.Scopes, " "), code.CodeChallenge, code.ExpiresAt)
+	return err
+}
+
+// ConsumeAuthorizationCode deletes and returns an unexpired code of the
+// client, so each code can be exchanged only once. A code presented by
+// another client is left alone.
+func (oas *PostgresOAuthStore) ConsumeAuthorizationCode(ctx context.Context, hash []byte, clientId string) (*AuthorizationCode, error) {
+	ctx, cancel := withTimeout(ctx, "OAuthStore.ConsumeAuthorizationCode")
+	defer cancel()
+
+	code := &AuthorizationCode{}
+	var scopes string
+	query := "DELETE FROM oauth_codes WHERE hash = $1 AND client_id = $2 AND expires_at > $3 " +
+		"RETURNING client_id, user_id, redirect_uri, scopes, code_challenge, expires_at"
+	err := oas.db.QueryRowContext(ctx, query, hash, clientId, time.Now()).Scan(&code.ClientId, &code.UserId, &code.RedirectURI, &scopes, &code.CodeChallenge, &code.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	code.Scopes = strings.Fields(scopes)
+	return code, nil
+}
+
+// CreateOAuthTokens stores tokens[i] under hashes[i], all or none of them,
+// so a client never gets an access token without its refresh token.
+func (oas *PostgresOAuthStore) CreateOAuthTokens(ctx context.Context, tokens []*OAuthToken, hashes [][]byte) error {
+	ctx, cancel := withTimeout(ctx, "OAuthStore.CreateOAuthTokens")
+	defer cancel()
+
+	tx, err := oas.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO oauth_tokens (hash, grant_id, kind, client_id, user_id, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	for i, token := range tokens {
+		_, err = tx.ExecContext(ctx, query, hashes[i], token.GrantId, token.Kind, token.ClientId, token.UserId, strings.Join(token.Scopes, " "), token.ExpiresAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (oas *PostgresOAuthStore) GetOAuthToken(ctx context.Context, hash []byte) (*OAuthToken, error) {
+	ctx, cancel := withTimeout(ctx, "OAuthStore.GetOAuthToken")
+	defer cancel()
+
+	token := &OAuthToken{}
+	var scopes string
+	query := "SELECT grant_id, kind, client_id, user_id, scopes, expires_at FROM oauth_tokens WHERE hash = $1 AND expires_at > $2"
+	err := oas.db.QueryRowContext(ctx, query, hash, time.Now()).Scan(&token.GrantId, &token.Kind, &token.ClientId, &token.UserId, &scopes, &token.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.Scopes = strings.Fields(scopes)
+	return token, nil
+}
+
+// ConsumeRefreshToken deletes and returns an unexpired refresh token of the
+// client. Refresh tokens are rotated on every use.
+func (oas *PostgresOAuthStore) ConsumeRefreshToken(ctx context.Context, hash []byte, clientId string) (*OAuthToken, error) {
+	ctx, cancel := withTimeout(ctx, "OAuthStore.ConsumeRefreshToken")
+	defer cancel()
+
+	token := &OAuthToken{}
+	var scopes string
+	query := "DELETE FROM oauth_tokens WHERE hash = $1 AND kind = $2 AND client_id = $3 AND expires_at > $4 " +
+		"RETURNING grant_id, kind, client_id, user_id, scopes, expires_at"
+	err := oas.db.QueryRowContext(ctx, query, hash, OAuthRefreshToken, clientId, time.Now()).Scan(&token.GrantId, &token.Kind, &token.ClientId, &token.UserId, &scopes, &token.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.Scopes = strings.Fields(scopes)
+	return token, nil
+}
+
+// RevokeGrant deletes every token issued alongside the given one, as long
+// as it belongs to the client. Unknown tokens are ignored.
+func (oas *PostgresOAuthStore) RevokeGrant(ctx context.Context, hash []byte, clientId string) error {
+	ctx, cancel := withTimeout(ctx, "OAuthStore.RevokeGrant")
+	defer cancel()
+
+	query := "DELETE FROM oauth_tokens WHERE grant_id = (SELECT grant_id FROM oauth_tokens WHERE hash = $1 AND client_id = $2)"
+	_, err := oas.db.ExecContext(ctx, query, hash, clientId)
+	return err
+}
+
+func (oas *PostgresOAuthStore) GetUserByAccessToken(ctx context.Context, plainText string) (*User, *OAuthToken, error) {
+	ctx, cancel := withTimeout(ctx, "OAuthStore.GetUserByAccessToken")
+	defer cancel()
+
+	query := "SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.timezone, u.created_at, u.updated_at, " +
+		"t.grant_id, t.kind, t.client_id, t.scopes, t.expires_at " +
+		"FROM users u INNER JOIN oauth_tokens t ON t.user_id = u.id WHERE t.hash = $1 AND t.kind = $2 AND t.expires_at > $3"
+
+	user := &User{
+		PasswordHash: password{},
+	}
+	token := &OAuthToken{}
+	var scopes string
+	err := oas.db.QueryRowContext(ctx, query, tokens.HashSecret(plainText), OAuthAccessToken, time.Now()).Scan(
+		&user.Id,
+		&user.UserName,
+		&user.Email,
+		&user.PasswordHash.hash,
+		&user.Bio,
+		&user.Timezone,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&token.GrantId,
+		&token.Kind,
+		&token.ClientId,
+		&scopes,
+		&token.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	token.UserId = user.Id
+	token.Scopes = strings.Fields(scopes)
+	return user, token, nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+	"workout-tracker/ratelimit"
+)
+
+// pruneEvery is how many takes pass between deletions of idle buckets.
+const pruneEvery = 1000
+
+// PostgresRateLimitStore shares token buckets between instances.
+type PostgresRateLimitStore struct {
+	db    *sql.DB
+	takes atomic.Int64
+}
+
+func NewPostgresRateLimitStore(db *sql.DB) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{db: db}
+}
+
+func (s *PostgresRateLimitStore) Take(ctx context.Context, key string, policy ratelimit.Policy, now time.Time) (ratelimit.Result, error) {
+	ctx, cancel := withTimeout(ctx, "RateLimitStore.Take")
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	defer tx.Rollback()
+
+	// New clients start with a full bucket
+	query := "INSERT INTO rate_limit_buckets (key, tokens, updated_at) VALUES ($1, $2, $3) ON CONFLICT (key) DO NOTHING"
+	_, err = tx.ExecContext(ctx, query, key, float64(policy.Requests), now)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	var tokens float64
+	var updated time.Time
+	query = "SELECT tokens, updated_at FROM rate_limit_buckets WHERE key = $1 FOR UPDATE"
+	err = tx.QueryRowContext(ctx, query, key).Scan(&tokens, &updated)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	tokens, result := ratelimit.Take(tokens, updated, policy, now)
+	query = "UPDATE rate_limit_buckets SET tokens = $2, updated_at = GREATEST(updated_at, $3) WHERE key = $1"
+	_, err = tx.ExecContext(ctx, query, key, tokens, now)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	// Pruning is best effort; idle rows left behind are removed next time
+	if s.takes.Add(1)%pruneEvery == 0 {
+		_ = s.prune(ctx, policy, now)
+	}
+	return result, nil
+}
+
+// prune deletes the policy's buckets that have refilled completely; they
+// behave exactly like a missing bucket.
+func (s *PostgresRateLimitStore) prune(ctx context.Context, policy ratelimit.Policy, now time.Time) error {
+	query := "DELETE FROM rate_limit_buckets WHERE key LIKE $1 AND updated_at < $2"
+	_, err := s.db.ExecContext(ctx, query, policy.Name+":%", now.Add(-policy.Period))
+	return err
+}
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Reminder kinds: a schedule fires at a time of day on some days of the
+// week; inactivity fires once the user has not logged a workout for
+// InactiveDays.
+const (
+	ReminderSchedule   = "schedule"
+	ReminderInactivity = "inactivity"
+)
+
+// Reminder is a user's rule for when to be reminded to train. Times of day
+// and days are in the reminder's timezone.
+type Reminder struct {
+	Id           int64      `json:"id"`
+	UserId       int        `json:"-"`
+	Name         string     `json:"name"`
+	Kind         string     `json:"kind"`
+	Days         []string   `json:"days,omitempty"`
+	TimeOfDay    string     `json:"time_of_day"`
+	Timezone     string     `json:"timezone"`
+	InactiveDays int        `json:"inactive_days,omitempty"`
+	Channels     []string   `json:"channels"`
+	Active       bool       `json:"active"`
+	NextRunAt    time.Time  `json:"next_run_at"`
+	LastFiredAt  *time.Time `json:"last_fired_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	// Email is the address of the user, filled in for due reminders
+	Email string `json:"-"`
+}
+
+type PostgresReminderStore struct {
+	db *sql.DB
+}
+
+func NewPostgresReminderStore(db *sql.DB) *PostgresReminderStore {
+	return &PostgresReminderStore{db: db}
+}
+
+type ReminderStore interface {
+	CreateReminder(ctx context.Context, reminder *Reminder) error
+	GetRemindersByUser(ctx context.Context, userId int) ([]Reminder, error)
+	DeleteReminder(ctx context.Context, id int64, userId int) (bool, error)
+	GetDueReminders(ctx context.Context, now time.Time, limit int) ([]Reminder, error)
+	GetLastWorkoutAt(ctx context.Context, userId int) (*time.Time, error)
+	RescheduleReminder(ctx context.Context, reminder *Reminder, next time.Time) (bool, error)
+	FireReminder(ctx context.Context, reminder *Reminder, next time.Time, notification *Notification) (bool, error)
+}
+
+const reminderColumns = "r.id, r.user_id, r.name, r.kind, r.days, r.time_of_day, r.timezone, r.inactive_days, r.channels, r.active, r.next_run_at, r.last_fired_at, r.created_at"
+
+func scanReminders(rows *sql.Rows, withEmail bool) ([]Reminder, error) {
+	reminders := []Reminder{}
+	for rows.Next() {
+		var reminder Reminder
+		var days, channels string
+		dest := []interface{}{&reminder.Id, &reminder.UserId, &reminder.Name, &reminder.Kind, &days, &reminder.TimeOfDay, &reminder.Timezone,
+			&reminder.InactiveDays, &channels, &reminder.Active, &reminder.NextRunAt, &reminder.LastFiredAt, &reminder.CreatedAt}
+		if withEmail {
+			dest = append(dest, &reminder.Email)
+		}
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		reminder.Days = strings.Fields(days)
+		reminder.Channels = strings.Fields(channels)
+		reminders = append(reminders, reminder)
+	}
+	return reminders, rows.Err()
+}
+
+func (rs *PostgresReminderStore) CreateReminder(ctx context.Context, reminder *Reminder) error {
+	ctx, cancel := withTimeout(ctx, "ReminderStore.CreateReminder")
+	defer cancel()
+
+	query := "INSERT INTO reminders (user_id, name, kind, days, time_of_day, timezone, inactive_days, channels, active, next_run_at) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, created_at"
+	return rs.db.QueryRowContext(ctx, query, reminder.UserId, reminder.Name, reminder.Kind, strings.Join(reminder.Days, " "), reminder.TimeOfDay,
+		reminder.Timezone, reminder.InactiveDays, strings.Join(reminder.Channels, " "), reminder.Active, reminder.NextRunAt).
+		Scan(&reminder.Id, &reminder.CreatedAt)
+}
+
+func (rs *PostgresReminderStore) GetRemindersByUser(ctx context.Context, userId int) ([]Reminder, error) {
+	ctx, cancel := withTimeout(ctx, "ReminderStore.GetRemindersByUser")
+	defer cancel()
+
+	rows, err := rs.db.QueryContext(ctx, "SELECT "+reminderColumns+" FROM reminders r WHERE r.user_id = $1 ORDER BY r.id", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanReminders(rows, false)
+}
+
+func (rs *PostgresReminderStore) DeleteReminder(ctx context.Context, id int64, userId int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "ReminderStore.DeleteReminder")
+	defer cancel()
+
+	result, err := rs.db.ExecContext(ctx, "DELETE FROM reminders WHERE id = $1 AND user_id = $2", id, userId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// GetDueReminders returns active reminders whose next run is at or before
+// now, with the email of their user.
+func (rs *PostgresReminderStore) GetDueReminders(ctx context.Context, now time.Time, limit int) ([]Reminder, error) {
+	ctx, cancel := withTimeout(ctx, "ReminderStore.GetDueReminders")
+	defer cancel()
+
+	query := "SELECT " + reminderColumns + ", u.email FROM reminders r JOIN users u ON u.id = r.user_id " +
+		"WHERE r.active AND r.next_run_at <= $1 ORDER BY r.next_run_at LIMIT $2"
+	rows, err := rs.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanReminders(rows, true)
+}
+
+// GetLastWorkoutAt returns when the user last logged a workout, or nil if
+// they never did.
+func (rs *PostgresReminderStore) GetLastWorkoutAt(ctx context.Context, userId int) (*time.Time, error) {
+	ctx, cancel := withTimeout(ctx, "ReminderStore.GetLastWorkoutAt")
+	defer cancel()
+
+	var last sql.NullTime
+	err := rs.db.QueryRowContext(ctx, "SELECT MAX(created_at) FROM workout WHERE user_id = $1 AND deleted_at IS NULL", userId).Scan(&last)
+	if err != nil {
+		return nil, err
+	}
+	if !last.Valid {
+		return nil, nil
+	}
+	return &last.Time, nil
+}
+
+// RescheduleReminder moves a due reminder that did not fire to its next
+// run. The update is conditional on the run the reminder was loaded with,
+// so it reports false when another evaluation got to it first.
+func (rs *PostgresReminderStore) RescheduleReminder(ctx context.Context, reminder *Reminder, next time.Time) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "ReminderStore.RescheduleReminder")
+	defer cancel()
+
+	query := "UPDATE reminders SET next_run_at = $1 WHERE id = $2 AND next_run_at = $3"
+	result, err := rs.db.ExecContext(ctx, query, next, reminder.Id, reminder.NextRunAt)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// FireReminder moves a due reminder to its next run and, in the same
+// transaction, queues a JobSendNotification job for each of its channels.
+// Like RescheduleReminder it reports false, and queues nothing, when
+// another evaluation got to the reminder first.
+func (rs *PostgresReminderStore) FireReminder(ctx context.Context, reminder *Reminder, next time.Time, notification *Notification) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "ReminderStore.FireReminder")
+	defer cancel()
+
+	tx, err := rs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	firedAt := time.Now()
+	query := "UPDATE reminders SET next_run_at = $1, last_fired_at = $2 WHERE id = $3 AND next_run_at = $4"
+	result, err := tx.ExecContext(ctx, query, next, firedAt, reminder.Id, reminder.NextRunAt)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	key := fmt.Sprintf("reminder%d_%d", reminder.Id, reminder.NextRunAt.Unix())
+	for _, channel := range reminder.Channels {
+		err = enqueueOutbox(ctx, tx, JobSendNotification, &NotificationJob{
+			Key:          key,
+			Channel:      channel,
+			UserId:       reminder.UserId,
+			Email:        reminder.Email,
+			Notification: *notification,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+	reminder.NextRunAt = next
+	reminder.LastFiredAt = &firedAt
+	return true, nil
+}
@@ -0,0 +1,28 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// defaultQueryTimeout bounds every store operation without an override.
+var defaultQueryTimeout = 5 * time.Second
+
+// queryTimeouts overrides the default per operation, keyed like
+// "GoalStore.GetGoalProgress".
+var queryTimeouts = map[string]time.Duration{}
+
+func SetQueryTimeouts(defaultTimeout time.Duration, overrides map[string]time.Duration) {
+	defaultQueryTimeout = defaultTimeout
+	queryTimeouts = overrides
+}
+
+// withTimeout derives a context for operation that is cancelled when the
+// caller's context is, or once the operation's timeout elapses.
+func withTimeout(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+	timeout, ok := queryTimeouts[operation]
+	if !ok {
+		timeout = defaultQueryTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
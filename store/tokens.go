@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"time"
 	"workout-tracker/tokens"
@@ -15,31 +16,51 @@ func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
 }
 
 type TokenStore interface {
-	Insert(token *tokens.Token) error
-	CreateNewToken(userId int, ttl time.Duration, scope string) (*tokens.Token, error)
-	DeleteAllTokens(userId int, scope string) error
+	Insert(ctx context.Context, token *tokens.Token) error
+	CreateNewToken(ctx context.Context, userId int, ttl time.Duration, scope string) (*tokens.Token, error)
+	DeleteAllTokens(ctx context.Context, userId int, scope string) error
 }
 
-func (s *PostgresTokenStore) CreateNewToken(userId int, ttl time.Duration, scope string) (*tokens.Token, error) {
+func (s *PostgresTokenStore) CreateNewToken(ctx context.Context, userId int, ttl time.Duration, scope string) (*tokens.Token, error) {
 	token, err := tokens.GenerateToken(userId, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
-	err = s.Insert(token)
+	err = s.Insert(ctx, token)
 	if err != nil {
 		return nil, err
 	}
 	return token, nil
 }
 
-func (s *PostgresTokenStore) Insert(token *tokens.Token) error {
+func (s *PostgresTokenStore) Insert(ctx context.Context, token *tokens.Token) (err error) {
+	ctx, span := startSpan(ctx, "TokenStore.Insert", "INSERT", "tokens")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "TokenStore.Insert")
+	defer cancel()
+
 	query := `INSERT INTO tokens (hash, user_id, expired, scope) VALUES ($1, $2, $3, $4)`
-	_, err := s.db.Exec(query, token.Hash, token.UserID, token.Expired, token.Scopes)
+	result, err := s.db.ExecContext(ctx, query, token.Hash, token.UserID, token.Expired, token.Scopes)
+	if err != nil {
+		return err
+	}
+	rows, err = result.RowsAffected()
 	return err
 }
 
-func (s *PostgresTokenStore) DeleteAllTokens(userId int, scope string) error {
+func (s *PostgresTokenStore) DeleteAllTokens(ctx context.Context, userId int, scope string) (err error) {
+	ctx, span := startSpan(ctx, "TokenStore.DeleteAllTokens", "DELETE", "tokens")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "TokenStore.DeleteAllTokens")
+	defer cancel()
+
 	query := `DELETE FROM tokens WHERE scope = $1 AND user_id = $2`
-	_, err := s.db.Exec(query, userId, scope)
+	result, err := s.db.ExecContext(ctx, query, scope, userId)
+	if err != nil {
+		return err
+	}
+	rows, err = result.RowsAffected()
 	return err
 }
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("workout-tracker/store")
+
+// startSpan starts a client span for a store method that runs a SQL
+// operation against table.
+func startSpan(ctx context.Context, method, operation, table string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.collection.name", table),
+		),
+	)
+}
+
+// endSpan records how many rows were returned or affected and any error,
+// then ends the span. sql.ErrNoRows is an expected outcome, not a failure.
+func endSpan(span trace.Span, rows int64, err error) {
+	span.SetAttributes(attribute.Int64("db.response.rows", rows))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
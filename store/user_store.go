@@ -1,20 +1,29 @@
 package store
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"golang.org/x/crypto/bcrypt"
+	"sync"
 	"time"
 )
 
+// bcryptCost is the work factor for new password hashes.
+var bcryptCost = bcrypt.DefaultCost
+
+func SetBcryptCost(cost int) {
+	bcryptCost = cost
+}
+
 type password struct {
 	plainText string
 	hash      []byte
 }
 
 func (p *password) Set(plainTextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plainTextPassword), 10)
+	hash, err := bcrypt.GenerateFromPassword([]byte(plainTextPassword), bcryptCost)
 	if err != nil {
 		return err
 	}
@@ -36,22 +45,59 @@ func (p *password) Check(plainTextPassword string) (bool, error) {
 	return true, nil
 }
 
+// dummyHash is compared against when a login names no account, so that
+// answering takes as long as for a wrong password.
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// CheckDummyPassword spends the time of a password check without an account
+// to check against.
+func CheckDummyPassword(plainTextPassword string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcryptCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(plainTextPassword))
+}
+
 type User struct {
 	Id           int       `json:"id"`
 	UserName     string    `json:"username"`
 	Email        string    `json:"email"`
 	PasswordHash password  `json:"-"`
 	Bio          string    `json:"bio"`
+	Timezone     string    `json:"timezone"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+type BodyweightEntry struct {
+	Id         int       `json:"id"`
+	UserId     int       `json:"user_id"`
+	Weight     float64   `json:"weight"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
 var AnonymousUser = &User{}
 
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+// Location returns the user's time zone, falling back to UTC when it is unset
+// or unknown.
+func (u *User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
 type PostgresUserStore struct {
 	db *sql.DB
 }
@@ -61,33 +107,52 @@ func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
 }
 
 type UserStore interface {
-	CreateUser(*User) error
-	GetUserByName(username string) (*User, error)
-	UpdateUser(*User) error
-	GetUserToken(scope, tokenPlaintextPassword string) (*User, error)
+	CreateUser(context.Context, *User) error
+	GetUserByName(ctx context.Context, username string) (*User, error)
+	UpdateUser(context.Context, *User) error
+	GetUserToken(ctx context.Context, scope, tokenPlaintextPassword string) (*User, error)
+	CreateBodyweightEntry(context.Context, *BodyweightEntry) error
+	GetLatestBodyweight(ctx context.Context, userId int) (*BodyweightEntry, error)
 }
 
-func (store *PostgresUserStore) CreateUser(user *User) error {
-	query := "INSERT INTO users (username, email, password_hash, bio) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at"
+func (store *PostgresUserStore) CreateUser(ctx context.Context, user *User) (err error) {
+	ctx, span := startSpan(ctx, "UserStore.CreateUser", "INSERT", "users")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "UserStore.CreateUser")
+	defer cancel()
 
-	err := store.db.QueryRow(query, user.UserName, user.Email, user.PasswordHash.hash, user.Bio).Scan(&user.Id, &user.CreatedAt, &user.UpdatedAt)
+	if user.Timezone == "" {
+		user.Timezone = "UTC"
+	}
+	query := "INSERT INTO users (username, email, password_hash, bio, timezone) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at"
+
+	err = store.db.QueryRowContext(ctx, query, user.UserName, user.Email, user.PasswordHash.hash, user.Bio, user.Timezone).Scan(&user.Id, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return err
 	}
+	rows = 1
 	return nil
 }
 
-func (store *PostgresUserStore) GetUserByName(username string) (*User, error) {
+func (store *PostgresUserStore) GetUserByName(ctx context.Context, username string) (found *User, err error) {
+	ctx, span := startSpan(ctx, "UserStore.GetUserByName", "SELECT", "users")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "UserStore.GetUserByName")
+	defer cancel()
+
 	user := &User{
 		PasswordHash: password{},
 	}
-	query := "SELECT id, username, email, password_hash, bio, created_at, updated_at FROM users WHERE username = $1"
+	query := "SELECT id, username, email, password_hash, bio, timezone, created_at, updated_at FROM users WHERE username = $1"
 
-	err := store.db.QueryRow(query, username).Scan(&user.Id,
+	err = store.db.QueryRowContext(ctx, query, username).Scan(&user.Id,
 		&user.UserName,
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.Timezone,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -97,42 +162,56 @@ func (store *PostgresUserStore) GetUserByName(username string) (*User, error) {
 	if err != nil {
 		return nil, err
 	}
+	rows = 1
 	return user, nil
 }
 
-func (store *PostgresUserStore) UpdateUser(user *User) error {
-	query := "UPDATE users SET username = $1, email = $2, bio = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4, RETURNING updated_at"
+func (store *PostgresUserStore) UpdateUser(ctx context.Context, user *User) (err error) {
+	ctx, span := startSpan(ctx, "UserStore.UpdateUser", "UPDATE", "users")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "UserStore.UpdateUser")
+	defer cancel()
 
-	result, err := store.db.Exec(query, user.UserName, user.Email, user.Bio, user.Id)
+	query := "UPDATE users SET username = $1, email = $2, bio = $3, timezone = $4, updated_at = CURRENT_TIMESTAMP WHERE id = $5"
+
+	result, err := store.db.ExecContext(ctx, query, user.UserName, user.Email, user.Bio, user.Timezone, user.Id)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	rows, err = result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
+	if rows == 0 {
 		return sql.ErrNoRows
 	}
 	return nil
 }
 
-func (store *PostgresUserStore) GetUserToken(scope, tokenPlaintextPassword string) (*User, error) {
+func (store *PostgresUserStore) GetUserToken(ctx context.Context, scope, tokenPlaintextPassword string) (found *User, err error) {
+	ctx, span := startSpan(ctx, "UserStore.GetUserToken", "SELECT", "tokens")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "UserStore.GetUserToken")
+	defer cancel()
+
 	tokenHash := sha256.Sum256([]byte(tokenPlaintextPassword))
-	query := "SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.created_at, u.updated_at " +
-		"FROM users u INNER JOIN tokens t ON t.user_id = u.id WHERE t.hash = $1 AND t.scopes = $2 AND t.expired > $3"
+	query := "SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.timezone, u.created_at, u.updated_at " +
+		"FROM users u INNER JOIN tokens t ON t.user_id = u.id WHERE t.hash = $1 AND t.scope = $2 AND t.expired > $3"
 
 	user := &User{
 		PasswordHash: password{},
 	}
-	err := store.db.QueryRow(query, tokenHash[:], scope, time.Now()).Scan(
+	err = store.db.QueryRowContext(ctx, query, tokenHash[:], scope, time.Now()).Scan(
 		&user.Id,
 		&user.UserName,
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.Timezone,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -142,5 +221,44 @@ func (store *PostgresUserStore) GetUserToken(scope, tokenPlaintextPassword strin
 	if err != nil {
 		return nil, err
 	}
+	rows = 1
 	return user, nil
 }
+
+func (store *PostgresUserStore) CreateBodyweightEntry(ctx context.Context, entry *BodyweightEntry) (err error) {
+	ctx, span := startSpan(ctx, "UserStore.CreateBodyweightEntry", "INSERT", "bodyweight_entries")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "UserStore.CreateBodyweightEntry")
+	defer cancel()
+
+	query := "INSERT INTO bodyweight_entries (user_id, weight) VALUES ($1, $2) RETURNING id, recorded_at"
+
+	err = store.db.QueryRowContext(ctx, query, entry.UserId, entry.Weight).Scan(&entry.Id, &entry.RecordedAt)
+	if err != nil {
+		return err
+	}
+	rows = 1
+	return nil
+}
+
+func (store *PostgresUserStore) GetLatestBodyweight(ctx context.Context, userId int) (latest *BodyweightEntry, err error) {
+	ctx, span := startSpan(ctx, "UserStore.GetLatestBodyweight", "SELECT", "bodyweight_entries")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "UserStore.GetLatestBodyweight")
+	defer cancel()
+
+	entry := &BodyweightEntry{}
+	query := "SELECT id, user_id, weight, recorded_at FROM bodyweight_entries WHERE user_id = $1 ORDER BY recorded_at DESC LIMIT 1"
+
+	err = store.db.QueryRowContext(ctx, query, userId).Scan(&entry.Id, &entry.UserId, &entry.Weight, &entry.RecordedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows = 1
+	return entry, nil
+}
@@ -0,0 +1,289 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Delivery statuses. A pending delivery is waiting for its next attempt.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookSubscription asks for the user's events of the listed types to be
+// posted to URL, signed with Secret.
+type WebhookSubscription struct {
+	Id        int64     `json:"id"`
+	UserId    int       `json:"-"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one event sent to one subscription, and the log of
+// attempting it.
+type WebhookDelivery struct {
+	Id             int64           `json:"id"`
+	SubscriptionId int64           `json:"subscription_id"`
+	EventId        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	ResponseStatus *int            `json:"response_status"`
+	LastError      *string         `json:"last_error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+
+	// URL and Secret are copied from the subscription when the delivery is
+	// claimed for sending.
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type PostgresWebhookStore struct {
+	db *sql.DB
+}
+
+func NewPostgresWebhookStore(db *sql.DB) *PostgresWebhookStore {
+	return &PostgresWebhookStore{db: db}
+}
+
+type WebhookStore interface {
+	CreateSubscription(ctx context.Context, subscription *WebhookSubscription) error
+	GetSubscriptionsByUser(ctx context.Context, userId int) ([]WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id int64, userId int) (*WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, subscription *WebhookSubscription) error
+	DeleteSubscription(ctx context.Context, id int64, userId int) (bool, error)
+	EnqueueEvent(ctx context.Context, userId int, eventId, eventType string, payload []byte) (int64, error)
+	CreateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	GetDeliveries(ctx context.Context, subscriptionId int64, limit int) ([]WebhookDelivery, error)
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error)
+	RecordDeliveryAttempt(ctx context.Context, delivery *WebhookDelivery) error
+	PurgeDeliveries(ctx context.Context, createdBefore time.Time) (int64, error)
+}
+
+const webhookSubscriptionColumns = "id, user_id, url, secret, events, active, created_at"
+
+func scanWebhookSubscription(scanner interface{ Scan(...interface{}) error }, subscription *WebhookSubscription) error {
+	var events string
+	err := scanner.Scan(&subscription.Id, &subscription.UserId, &subscription.URL, &subscription.Secret, &events, &subscription.Active, &subscription.CreatedAt)
+	subscription.Events = strings.Fields(events)
+	return err
+}
+
+func (whs *PostgresWebhookStore) CreateSubscription(ctx context.Context, subscription *WebhookSubscription) error {
+	ctx, cancel := withTimeout(ctx, "WebhookStore.CreateSubscription")
+	defer cancel()
+
+	query := "INSERT INTO webhook_subscriptions (user_id, url, secret, events, active) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at"
+	return whs.db.QueryRowContext(ctx, query, subscription.UserId, subscription.URL, subscription.Secret, strings.Join(subscription.Events, " "), subscription.Active).
+		Scan(&subscription.Id, &subscription.CreatedAt)
+}
+
+func (whs *PostgresWebhookStore) GetSubscriptionsByUser(ctx context.Context, userId int) ([]WebhookSubscription, error) {
+	ctx, cancel := withTimeout(ctx, "WebhookStore.GetSubscriptionsByUser")
+	defer cancel()
+
+	query := "SELECT " + webhookSubscriptionColumns + " FROM webhook_subscriptions WHERE user_id = $1 ORDER BY created_at"
+	rows, err := whs.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []WebhookSubscription{}
+	for rows.Next() {
+		var subscription WebhookSubscription
+		err = scanWebhookSubscription(rows, &subscription)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+func (whs *PostgresWebhookStore) GetSubscription(ctx context.Context, id int64, userId int) (*WebhookSubscription, error) {
+	ctx, cancel := withTimeout(ctx, "WebhookStore.GetSubscription")
+	defer cancel()
+
+	query := "SELECT " + webhookSubscriptionColumns + " FROM webhook_subscriptions WHERE id = $1 AND user_id = $2"
+	subscription := &WebhookSubscription{}
+	err := scanWebhookSubscription(whs.db.QueryRowContext(ctx, query, id, userId), subscription)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func (whs *PostgresWebhookStore) UpdateSubscription(ctx context.Context, subscription *WebhookSubscription) error {
+	ctx, cancel := withTimeout(ctx, "WebhookStore.UpdateSubscription")
+	defer cancel()
+
+	query := "UPDATE webhook_subscriptions SET url = $1, events = $2, active = $3 WHERE id = $4 AND user_id = $5"
+	_, err := whs.db.ExecContext(ctx, query, subscription.URL, strings.Join(subscription.Events, " "), subscription.Active, subscription.Id, subscription.UserId)
+	return err
+}
+
+// DeleteSubscription removes a subscription and its delivery log. It
+// reports false when the user has no subscription with that id.
+func (whs *PostgresWebhookStore) DeleteSubscription(ctx context.Context, id int64, userId int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "WebhookStore.DeleteSubscription")
+	defer cancel()
+
+	result, err := whs.db.ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id = $1 AND user_id = $2", id, userId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// EnqueueEvent queues a delivery of the event to each active subscription
+// of the user that asked for its type, returning how many were queued.
+// Subscriptions that already have a delivery of the event are skipped.
+func (whs *PostgresWebhookStore) EnqueueEvent(ctx context.Context, userId int, eventId, eventType string, payload []byte) (int64, error) {
+	ctx, cancel := withTimeout(ctx, "WebhookStore.EnqueueEvent")
+	defer cancel()
+
+	query := "INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload) " +
+		"SELECT id, $2, $3, $4 FROM webhook_subscriptions " +
+		"WHERE user_id = $1 AND active AND $3 = ANY(string_to_array(events, ' ')) " +
+		"ON CONFLICT (subscription_id, event_id) DO NOTHING"
+	result, err := whs.db.ExecContext(ctx, query, userId, eventId, eventType, payload)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CreateDelivery queues a delivery to a single subscription, first due at
+// NextAttemptAt.
+func (whs *PostgresWebhookStore) CreateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	ctx, cancel := withTimeout(ctx, "WebhookStore.CreateDelivery")
+	defer cancel()
+
+	query := "INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, next_attempt_at) VALUES ($1, $2, $3, $4, $5) " +
+		"RETURNING id, status, attempts, created_at"
+	return whs.db.QueryRowContext(ctx, query, delivery.SubscriptionId, delivery.EventId, delivery.EventType, []byte(delivery.Payload), delivery.NextAttemptAt).
+		Scan(&delivery.Id, &delivery.Status, &delivery.Attempts, &delivery.CreatedAt)
+}
+
+const webhookDeliveryColumns = "d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, " +
+	"d.next_attempt_at, d.response_status, d.last_error, d.created_at, d.delivered_at"
+
+func scanWebhookDelivery(rows *sql.Rows, delivery *WebhookDelivery, extra ...interface{}) error {
+	var payload []byte
+	dest := []interface{}{
+		&delivery.Id,
+		&delivery.SubscriptionId,
+		&delivery.EventId,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.ResponseStatus,
+		&delivery.LastError,
+		&delivery.CreatedAt,
+		&delivery.DeliveredAt,
+	}
+	err := rows.Scan(append(dest, extra...)...)
+	delivery.Payload = payload
+	return err
+}
+
+// GetDeliveries returns the latest deliveries to a subscription, newest
+// first.
+func (whs *PostgresWebhookStore) GetDeliveries(ctx context.Context, subscriptionId int64, limit int) ([]WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, "WebhookStore.GetDeliveries")
+	defer cancel()
+
+	query := "SELECT " + webhookDeliveryColumns + " FROM webhook_deliveries d WHERE d.subscription_id = $1 ORDER BY d.created_at DESC, d.id DESC LIMIT $2"
+	rows, err := whs.db.QueryContext(ctx, query, subscriptionId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err = scanWebhookDelivery(rows, &delivery)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries whose next
+// attempt is due and pushes that attempt back by lease, so that other
+// instances polling at the same time skip them. A delivery that is not
+// recorded before the lease runs out is attempted again. Deliveries of
+// inactive subscriptions wait until the subscription is activated again.
+func (whs *PostgresWebhookStore) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, "WebhookStore.ClaimDueDeliveries")
+	defer cancel()
+
+	now := time.Now()
+	query := "WITH due AS (SELECT dd.id FROM webhook_deliveries dd INNER JOIN webhook_subscriptions s ON s.id = dd.subscription_id " +
+		"WHERE dd.status = 'pending' AND dd.next_attempt_at <= $1 AND s.active ORDER BY dd.next_attempt_at LIMIT $2 FOR UPDATE OF dd SKIP LOCKED), " +
+		"d AS (UPDATE webhook_deliveries SET next_attempt_at = $3 FROM due WHERE webhook_deliveries.id = due.id RETURNING webhook_deliveries.*) " +
+		"SELECT " + webhookDeliveryColumns + ", s.url, s.secret " +
+		"FROM d INNER JOIN webhook_subscriptions s ON s.id = d.subscription_id"
+	rows, err := whs.db.QueryContext(ctx, query, now, limit, now.Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err = scanWebhookDelivery(rows, &delivery, &delivery.URL, &delivery.Secret)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordDeliveryAttempt saves the outcome of an attempt.
+func (whs *PostgresWebhookStore) RecordDeliveryAttempt(ctx context.Context, delivery *WebhookDelivery) error {
+	ctx, cancel := withTimeout(ctx, "WebhookStore.RecordDeliveryAttempt")
+	defer cancel()
+
+	query := "UPDATE webhook_deliveries SET status = $1, attempts = $2, next_attempt_at = $3, response_status = $4, last_error = $5, delivered_at = $6 WHERE id = $7"
+	_, err := whs.db.ExecContext(ctx, query, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.ResponseStatus, delivery.LastError, delivery.DeliveredAt, delivery.Id)
+	return err
+}
+
+// PurgeDeliveries deletes finished deliveries created before createdBefore.
+func (whs *PostgresWebhookStore) PurgeDeliveries(ctx context.Context, createdBefore time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx, "WebhookStore.PurgeDeliveries")
+	defer cancel()
+
+	result, err := whs.db.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < $1", createdBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// DailyActivity aggregates a user's workouts on one calendar day in their
+// time zone. Date is midnight UTC of that day so days can be compared and
+// subtracted without daylight saving surprises.
+type DailyActivity struct {
+	Date            time.Time
+	Workouts        int
+	DurationMinutes int
+	CaloriesBurned  int
+}
+
+type WeeklySummary struct {
+	WeekStart       string `json:"week_start"`
+	Workouts        int    `json:"workouts"`
+	ActiveDays      int    `json:"active_days"`
+	DurationMinutes int    `json:"duration"`
+	CaloriesBurned  int    `json:"calories_burned"`
+}
+
+const oneDay = 24 * time.Hour
+
+// GetDailyActivity returns one row per day the user worked out, oldest first,
+// with days bucketed in the given IANA time zone.
+func (ws *PostgresWorkoutStore) GetDailyActivity(ctx context.Context, userId int, timezone string) (days []DailyActivity, err error) {
+	ctx, span := startSpan(ctx, "WorkoutStore.GetDailyActivity", "SELECT", "workout")
+	defer func() { endSpan(span, int64(len(days)), err) }()
+	ctx, cancel := withTimeout(ctx, "WorkoutStore.GetDailyActivity")
+	defer cancel()
+
+	query := "SELECT (created_at AT TIME ZONE $2)::date AS day, COUNT(*), SUM(duration), SUM(calories_burned) " +
+		"FROM workout WHERE user_id = $1 AND deleted_at IS NULL GROUP BY day ORDER BY day"
+	rows, err := ws.db.QueryContext(ctx, query, userId, timezone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		activity := DailyActivity{}
+		err = rows.Scan(&activity.Date, &activity.Workouts, &activity.DurationMinutes, &activity.CaloriesBurned)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, activity)
+	}
+	return days, rows.Err()
+}
+
+// CalendarDate truncates t to its calendar day in t's location, expressed as
+// midnight UTC to match DailyActivity.Date.
+func CalendarDate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// CalculateStreaks returns the current and longest streaks in days. Up to
+// restDays consecutive days without a workout are tolerated inside a streak;
+// the current streak is zero once today is further than that from the last
+// workout.
+func CalculateStreaks(days []DailyActivity, today time.Time, restDays int) (current, longest int) {
+	if len(days) == 0 {
+		return 0, 0
+	}
+
+	streakStart := days[0].Date
+	for i := 1; i < len(days); i++ {
+		gap := int(days[i].Date.Sub(days[i-1].Date)/oneDay) - 1
+		if gap > restDays {
+			longest = max(longest, int(days[i-1].Date.Sub(streakStart)/oneDay)+1)
+			streakStart = days[i].Date
+		}
+	}
+	last := days[len(days)-1].Date
+	lastStreak := int(last.Sub(streakStart)/oneDay) + 1
+	longest = max(longest, lastStreak)
+
+	if int(today.Sub(last)/oneDay)-1 <= restDays {
+		current = lastStreak
+	}
+	return current, longest
+}
+
+// SummarizeWeek totals the activity in the week (Monday to Sunday) that
+// contains today.
+func SummarizeWeek(days []DailyActivity, today time.Time) WeeklySummary {
+	weekStart := startOfWeek(today)
+	weekEnd := weekStart.AddDate(0, 0, 7)
+
+	summary := WeeklySummary{WeekStart: weekStart.Format(time.DateOnly)}
+	for _, activity := range days {
+		if activity.Date.Before(weekStart) || !activity.Date.Before(weekEnd) {
+			continue
+		}
+		summary.Workouts += activity.Workouts
+		summary.ActiveDays++
+		summary.DurationMinutes += activity.DurationMinutes
+		summary.CaloriesBurned += activity.CaloriesBurned
+	}
+	return summary
+}
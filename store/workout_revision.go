@@ -0,0 +1,263 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Revision actions.
+const (
+	RevisionCreated  = "created"
+	RevisionUpdated  = "updated"
+	RevisionReverted = "reverted"
+)
+
+// Entry change kinds.
+const (
+	EntryAdded    = "added"
+	EntryModified = "modified"
+	EntryRemoved  = "removed"
+)
+
+// FieldChange is a workout field's value before and after a revision.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// EntryChange is an entry added, modified or removed by a revision. Before
+// is nil for added entries and After for removed ones.
+type EntryChange struct {
+	Change  string        `json:"change"`
+	EntryId int           `json:"entry_id"`
+	Before  *WorkoutEntry `json:"before,omitempty"`
+	After   *WorkoutEntry `json:"after,omitempty"`
+}
+
+// WorkoutSnapshot is what a workout looked like after a revision, which is
+// what reverting to the revision brings back.
+type WorkoutSnapshot struct {
+	Title             string         `json:"title"`
+	Description       string         `json:"description"`
+	DurationMinutes   int            `json:"duration"`
+	CaloriesBurned    int            `json:"calories_burned"`
+	CaloriesEstimated bool           `json:"calories_estimated"`
+	Entries           []WorkoutEntry `json:"entries"`
+}
+
+// WorkoutRevision records who changed a workout, when and how. Revisions
+// are numbered from 1 per workout; the first is its creation.
+type WorkoutRevision struct {
+	Id           int64                  `json:"id"`
+	WorkoutId    int                    `json:"workout_id"`
+	Revision     int                    `json:"revision"`
+	UserId       int                    `json:"user_id"`
+	Action       string                 `json:"action"`
+	RevertedFrom *int                   `json:"reverted_from,omitempty"`
+	Changes      map[string]FieldChange `json:"changes"`
+	Entries      []EntryChange          `json:"entries"`
+	Snapshot     WorkoutSnapshot        `json:"snapshot"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+func snapshotOf(workout *Workout) WorkoutSnapshot {
+	entries := workout.Entries
+	if entries == nil {
+		entries = []WorkoutEntry{}
+	}
+	return WorkoutSnapshot{
+		Title:             workout.Title,
+		Description:       workout.Description,
+		DurationMinutes:   workout.DurationMinutes,
+		CaloriesBurned:    workout.CaloriesBurned,
+		CaloriesEstimated: workout.CaloriesEstimated,
+		Entries:           entries,
+	}
+}
+
+// recordRevision saves revision as the workout's next revision, with the
+// workout's current state as its snapshot. The caller has locked the
+// workout row, so revision numbers are not handed out twice.
+func recordRevision(ctx context.Context, tx *sql.Tx, workout *Workout, revision *WorkoutRevision) error {
+	revision.WorkoutId = workout.Id
+	revision.Snapshot = snapshotOf(workout)
+	if revision.Changes == nil {
+		revision.Changes = map[string]FieldChange{}
+	}
+	if revision.Entries == nil {
+		revision.Entries = []EntryChange{}
+	}
+	changes, err := json.Marshal(revision.Changes)
+	if err != nil {
+		return err
+	}
+	entries, err := json.Marshal(revision.Entries)
+	if err != nil {
+		return err
+	}
+	snapshot, err := json.Marshal(revision.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	query := "INSERT INTO workout_revisions (workout_id, revision, user_id, action, reverted_from, changes, entries, snapshot) " +
+		"SELECT $1, COALESCE(MAX(revision), 0) + 1, $2::bigint, $3::text, $4::integer, $5::jsonb, $6::jsonb, $7::jsonb " +
+		"FROM workout_revisions WHERE workout_id = $1 RETURNING id, revision, created_at"
+	return tx.QueryRowContext(ctx, query, workout.Id, revision.UserId, revision.Action, revision.RevertedFrom, changes, entries, snapshot).
+		Scan(&revision.Id, &revision.Revision, &revision.CreatedAt)
+}
+
+func sameEntry(a, b *WorkoutEntry) bool {
+	return a.ExerciseName == b.ExerciseName && a.Sets == b.Sets && a.Notes == b.Notes && a.OrderIndex == b.OrderIndex &&
+		sameValue(a.Reps, b.Reps) && sameValue(a.DurationSeconds, b.DurationSeconds) && sameValue(a.Weight, b.Weight)
+}
+
+func sameValue[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// saveEntries brings the workout's stored entries in line with
+// workout.Entries, keeping the ids of entries that are still there: an
+// entry whose id belongs to the workout is updated in place and any other
+// is added with a new id, written back to workout.Entries. It returns what
+// changed, in the order of workout.Entries followed by removals.
+func saveEntries(ctx context.Context, tx *sql.Tx, workout *Workout) ([]EntryChange, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index FROM workout_entries WHERE workout_id = $1 ORDER BY order_index, id", workout.Id)
+	if err != nil {
+		return nil, err
+	}
+	var stored []WorkoutEntry
+	for rows.Next() {
+		var entry WorkoutEntry
+		err = rows.Scan(&entry.Id, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.Notes, &entry.OrderIndex)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stored = append(stored, entry)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	remaining := make(map[int]*WorkoutEntry, len(stored))
+	for i := range stored {
+		remaining[stored[i].Id] = &stored[i]
+	}
+
+	changes := []EntryChange{}
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		before, ok := remaining[entry.Id]
+		if !ok {
+			query := "INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index) " +
+				"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
+			err = tx.QueryRowContext(ctx, query, workout.Id, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.Id)
+			if err != nil {
+				return nil, err
+			}
+			after := *entry
+			changes = append(changes, EntryChange{Change: EntryAdded, EntryId: entry.Id, After: &after})
+			continue
+		}
+		delete(remaining, entry.Id)
+		if sameEntry(before, entry) {
+			continue
+		}
+		query := "UPDATE workout_entries SET exercise_name = $1, sets = $2, reps = $3, duration_seconds = $4, weight = $5, notes = $6, order_index = $7 WHERE id = $8"
+		_, err = tx.ExecContext(ctx, query, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex, entry.Id)
+		if err != nil {
+			return nil, err
+		}
+		after := *entry
+		changes = append(changes, EntryChange{Change: EntryModified, EntryId: entry.Id, Before: before, After: &after})
+	}
+
+	for i := range stored {
+		before := &stored[i]
+		if _, ok := remaining[before.Id]; !ok {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM workout_entries WHERE id = $1", before.Id)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, EntryChange{Change: EntryRemoved, EntryId: before.Id, Before: before})
+	}
+	return changes, nil
+}
+
+const revisionColumns = "id, workout_id, revision, user_id, action, reverted_from, changes, entries, snapshot, created_at"
+
+func scanRevision(scanner interface{ Scan(...interface{}) error }, revision *WorkoutRevision) error {
+	var changes, entries, snapshot []byte
+	err := scanner.Scan(&revision.Id, &revision.WorkoutId, &revision.Revision, &revision.UserId, &revision.Action, &revision.RevertedFrom,
+		&changes, &entries, &snapshot, &revision.CreatedAt)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(changes, &revision.Changes)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(entries, &revision.Entries)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(snapshot, &revision.Snapshot)
+}
+
+// GetWorkoutRevisions returns the revisions of a workout, newest first and
+// at most limit of them.
+func (ws *PostgresWorkoutStore) GetWorkoutRevisions(ctx context.Context, workoutId int64, limit int) (revisions []WorkoutRevision, err error) {
+	ctx, span := startSpan(ctx, "WorkoutStore.GetWorkoutRevisions", "SELECT", "workout_revisions")
+	defer func() { endSpan(span, int64(len(revisions)), err) }()
+	ctx, cancel := withTimeout(ctx, "WorkoutStore.GetWorkoutRevisions")
+	defer cancel()
+
+	query := "SELECT " + revisionColumns + " FROM workout_revisions WHERE workout_id = $1 ORDER BY revision DESC LIMIT $2"
+	rows, err := ws.db.QueryContext(ctx, query, workoutId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions = []WorkoutRevision{}
+	for rows.Next() {
+		var revision WorkoutRevision
+		err = scanRevision(rows, &revision)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// GetWorkoutRevision returns one revision of a workout, or nil if it has
+// no such revision.
+func (ws *PostgresWorkoutStore) GetWorkoutRevision(ctx context.Context, workoutId int64, number int) (found *WorkoutRevision, err error) {
+	ctx, span := startSpan(ctx, "WorkoutStore.GetWorkoutRevision", "SELECT", "workout_revisions")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "WorkoutStore.GetWorkoutRevision")
+	defer cancel()
+
+	revision := &WorkoutRevision{}
+	query := "SELECT " + revisionColumns + " FROM workout_revisions WHERE workout_id = $1 AND revision = $2"
+	err = scanRevision(ws.db.QueryRowContext(ctx, query, workoutId, number), revision)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows = 1
+	return revision, nil
+}
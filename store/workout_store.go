@@ -1,6 +1,11 @@
 package store
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
 
 type WorkoutEntry struct {
 	Id              int      `json:"id"`
@@ -14,15 +19,46 @@ type WorkoutEntry struct {
 }
 
 type Workout struct {
-	Id              int            `json:"id"`
-	UserId          int            `json:"user_id"`
-	Title           string         `json:"title"`
-	Description     string         `json:"description"`
-	DurationMinutes int            `json:"duration"`
-	CaloriesBurned  int            `json:"calories_burned"`
-	Entries         []WorkoutEntry `json:"entries"`
+	Id                int            `json:"id"`
+	UserId            int            `json:"user_id"`
+	Title             string         `json:"title"`
+	Description       string         `json:"description"`
+	DurationMinutes   int            `json:"duration"`
+	CaloriesBurned    int            `json:"calories_burned"`
+	CaloriesEstimated bool           `json:"calories_estimated"`
+	Entries           []WorkoutEntry `json:"entries"`
+	Version           int            `json:"version"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	// DeletedAt is set while the workout is in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
+// JobWorkoutEvent jobs are written in the same transaction as every
+// workout change, so that what follows from the change, such as webhooks,
+// happens if and only if it was saved.
+const JobWorkoutEvent = "workout_event"
+
+// Workout event types.
+const (
+	WorkoutCreated  = "workout.created"
+	WorkoutUpdated  = "workout.updated"
+	WorkoutDeleted  = "workout.deleted"
+	WorkoutRestored = "workout.restored"
+)
+
+// WorkoutEvent is the payload of a JobWorkoutEvent job. Workout is the
+// saved workout, or for deletions and restores only its id and title.
+type WorkoutEvent struct {
+	Type    string   `json:"type"`
+	UserId  int      `json:"user_id"`
+	Workout *Workout `json:"workout"`
+}
+
+// ErrWorkoutChanged is returned when a workout is no longer at the version
+// an update or delete was meant for.
+var ErrWorkoutChanged = errors.New("workout was changed by another request")
+
 type PostgresWorkoutStore struct {
 	db *sql.DB
 }
@@ -34,32 +70,66 @@ func NewWorkoutStore(db *sql.DB) *PostgresWorkoutStore {
 }
 
 type WorkoutStore interface {
-	CreateWorkout(*Workout) (*Workout, error)
-	GetWorkoutById(id int64) (*Workout, error)
-	UpdateWorkout(*Workout) error
-	DeleteWorkout(id int64) error
-	GetWorkoutOwner(id int64) (int, error)
+	CreateWorkout(context.Context, *Workout) (*Workout, error)
+	GetWorkoutById(ctx context.Context, id int64) (*Workout, error)
+	UpdateWorkout(ctx context.Context, workout *Workout, revision *WorkoutRevision) error
+	DeleteWorkout(ctx context.Context, id int64, version int) error
+	GetWorkoutOwner(ctx context.Context, id int64) (int, error)
+	GetDailyActivity(ctx context.Context, userId int, timezone string) ([]DailyActivity, error)
+	GetBestOneRepMax(ctx context.Context, userId int, exerciseName string, excludeWorkoutId int64) (float64, error)
+	GetWorkoutsSince(ctx context.Context, userId int, since time.Time, limit int) ([]Workout, error)
+	GetDeletedWorkouts(ctx context.Context, userId int, limit int) ([]Workout, error)
+	RestoreWorkout(ctx context.Context, id int64, userId int) (bool, error)
+	PurgeDeletedWorkouts(ctx context.Context, deletedBefore time.Time) (int64, error)
+	GetWorkoutRevisions(ctx context.Context, workoutId int64, limit int) ([]WorkoutRevision, error)
+	GetWorkoutRevision(ctx context.Context, workoutId int64, number int) (*WorkoutRevision, error)
+}
+
+// EstimateOneRepMax estimates the one rep max of a set with the Epley
+// formula, matching the estimate used by goals.
+func EstimateOneRepMax(weight float64, reps int) float64 {
+	if reps == 1 {
+		return weight
+	}
+	return weight * (1 + float64(reps)/30)
 }
 
-func (ws *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
-	tx, err := ws.db.Begin()
+func (ws *PostgresWorkoutStore) CreateWorkout(ctx context.Context, workout *Workout) (created *Workout, err error) {
+	ctx, span := startSpan(ctx, "WorkoutStore.CreateWorkout", "INSERT", "workout")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "WorkoutStore.CreateWorkout")
+	defer cancel()
+
+	tx, err := ws.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
-	query := "INSERT INTO workout (user_id, title, description, duration, calories_burned) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	query := "INSERT INTO workout (user_id, title, description, duration, calories_burned, calories_estimated) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, version, created_at, updated_at"
 
-	err = tx.QueryRow(query, workout.UserId, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(&workout.Id)
+	err = tx.QueryRowContext(ctx, query, workout.UserId, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.CaloriesEstimated).Scan(&workout.Id, &workout.Version, &workout.CreatedAt, &workout.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
-	for _, entry := range workout.Entries {
+	rows++
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
 		query := "INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index) " +
 			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
-		err = tx.QueryRow(query, workout.Id, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.Id)
+		err = tx.QueryRowContext(ctx, query, workout.Id, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.Id)
 		if err != nil {
 			return nil, err
 		}
+		rows++
+	}
+	err = recordRevision(ctx, tx, workout, &WorkoutRevision{UserId: workout.UserId, Action: RevisionCreated})
+	if err != nil {
+		return nil, err
+	}
+	err = enqueueOutbox(ctx, tx, JobWorkoutEvent, WorkoutEvent{Type: WorkoutCreated, UserId: workout.UserId, Workout: workout})
+	if err != nil {
+		return nil, err
 	}
 	err = tx.Commit()
 	if err != nil {
@@ -68,10 +138,16 @@ func (ws *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 	return workout, nil
 }
 
-func (ws *PostgresWorkoutStore) GetWorkoutById(id int64) (*Workout, error) {
-	query := "SELECT id, title, description, duration, calories_burned FROM workout WHERE id = $1"
+func (ws *PostgresWorkoutStore) GetWorkoutById(ctx context.Context, id int64) (found *Workout, err error) {
+	ctx, span := startSpan(ctx, "WorkoutStore.GetWorkoutById", "SELECT", "workout")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "WorkoutStore.GetWorkoutById")
+	defer cancel()
+
+	query := "SELECT id, user_id, title, description, duration, calories_burned, calories_estimated, version, created_at, updated_at FROM workout WHERE id = $1 AND deleted_at IS NULL"
 	workout := &Workout{}
-	err := ws.db.QueryRow(query, id).Scan(&workout.Id, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned)
+	err = ws.db.QueryRowContext(ctx, query, id).Scan(&workout.Id, &workout.UserId, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.CaloriesEstimated, &workout.Version, &workout.CreatedAt, &workout.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil // No workout found
@@ -81,86 +157,290 @@ func (ws *PostgresWorkoutStore) GetWorkoutById(id int64) (*Workout, error) {
 		return nil, err
 	}
 
+	rows++
+
 	entryQuery := "SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index FROM workout_entries WHERE workout_id = $1 ORDER BY order_index"
-	rows, err := ws.db.Query(entryQuery, id)
+	entryRows, err := ws.db.QueryContext(ctx, entryQuery, id)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	defer entryRows.Close()
 
-	for rows.Next() {
+	for entryRows.Next() {
 		entry := WorkoutEntry{}
-		err = rows.Scan(&entry.Id, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.Notes, &entry.OrderIndex)
+		err = entryRows.Scan(&entry.Id, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.Notes, &entry.OrderIndex)
 		if err != nil {
 			return nil, err
 		}
 		workout.Entries = append(workout.Entries, entry)
+		rows++
 	}
 
 	return workout, nil
 }
 
-func (ws *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
-	tx, err := ws.db.Begin()
+// UpdateWorkout saves the workout and records the change as revision,
+// filling in its entry changes, snapshot and number. Entries keep their ids
+// as described by saveEntries. The workout must still be at workout.Version,
+// or ErrWorkoutChanged is returned; on success it moves to the next version.
+func (ws *PostgresWorkoutStore) UpdateWorkout(ctx context.Context, workout *Workout, revision *WorkoutRevision) (err error) {
+	ctx, span := startSpan(ctx, "WorkoutStore.UpdateWorkout", "UPDATE", "workout")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "WorkoutStore.UpdateWorkout")
+	defer cancel()
+
+	tx, err := ws.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	query := "UPDATE workout SET title = $1, description = $2, duration = $3, calories_burned = $4 WHERE id = $5"
-	result, err := tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.Id)
-	if err != nil {
-		return err
+	updatedAt := time.Now()
+	query := "UPDATE workout SET title = $1, description = $2, duration = $3, calories_burned = $4, calories_estimated = $5, updated_at = $6, version = version + 1 " +
+		"WHERE id = $7 AND deleted_at IS NULL AND version = $8 RETURNING version"
+	err = tx.QueryRowContext(ctx, query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.CaloriesEstimated, updatedAt, workout.Id, workout.Version).Scan(&workout.Version)
+	if err == sql.ErrNoRows {
+		return ws.missingOrChanged(ctx, tx, int64(workout.Id))
 	}
-
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return sql.ErrNoRows // No workout found to update
-	}
+	workout.UpdatedAt = updatedAt
+	rows = 1
 
-	_, err = tx.Exec("DELETE FROM workout_entries WHERE workout_id = $1", workout.Id)
+	revision.Entries, err = saveEntries(ctx, tx, workout)
 	if err != nil {
 		return err
 	}
-	for _, entry := range workout.Entries {
-		query := "INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index) " +
-			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
-		_, err = tx.Exec(query, workout.Id, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex)
+	rows += int64(len(revision.Entries))
+	// Saving a workout without changing it leaves no revision
+	if len(revision.Changes) > 0 || len(revision.Entries) > 0 {
+		err = recordRevision(ctx, tx, workout, revision)
 		if err != nil {
 			return err
 		}
 	}
+	err = enqueueOutbox(ctx, tx, JobWorkoutEvent, WorkoutEvent{Type: WorkoutUpdated, UserId: workout.UserId, Workout: workout})
+	if err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
-func (ws *PostgresWorkoutStore) DeleteWorkout(id int64) error {
-	query := "DELETE FROM workout WHERE id = $1"
-	result, err := ws.db.Exec(query, id)
+// DeleteWorkout moves a workout to the trash. It stays there, hidden from
+// every other read, until it is restored or purged. A version other than 0
+// is the version the workout must be at, as for UpdateWorkout.
+func (ws *PostgresWorkoutStore) DeleteWorkout(ctx context.Context, id int64, version int) (err error) {
+	ctx, span := startSpan(ctx, "WorkoutStore.DeleteWorkout", "UPDATE", "workout")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "WorkoutStore.DeleteWorkout")
+	defer cancel()
+
+	tx, err := ws.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	deleted := &Workout{}
+	query := "UPDATE workout SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL AND ($3 = 0 OR version = $3) RETURNING id, user_id, title"
+	err = tx.QueryRowContext(ctx, query, id, time.Now(), version).Scan(&deleted.Id, &deleted.UserId, &deleted.Title)
+	if err == sql.ErrNoRows {
+		return ws.missingOrChanged(ctx, tx, id)
+	}
+	if err != nil {
+		return err
+	}
+	rows = 1
+
+	err = enqueueOutbox(ctx, tx, JobWorkoutEvent, WorkoutEvent{Type: WorkoutDeleted, UserId: deleted.UserId, Workout: deleted})
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
+	return tx.Commit()
+}
+
+// missingOrChanged tells why a conditional write of a workout matched no
+// row: sql.ErrNoRows if the workout is gone, ErrWorkoutChanged otherwise.
+func (ws *PostgresWorkoutStore) missingOrChanged(ctx context.Context, tx *sql.Tx, id int64) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM workout WHERE id = $1 AND deleted_at IS NULL)", id).Scan(&exists)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return sql.ErrNoRows // No workout found to delete
+	if !exists {
+		return sql.ErrNoRows
 	}
-	return nil
+	return ErrWorkoutChanged
 }
 
-func (ws *PostgresWorkoutStore) GetWorkoutOwner(workoutId int64) (int, error) {
+func (ws *PostgresWorkoutStore) GetWorkoutOwner(ctx context.Context, workoutId int64) (owner int, err error) {
+	ctx, span := startSpan(ctx, "WorkoutStore.GetWorkoutOwner", "SELECT", "workout")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "WorkoutStore.GetWorkoutOwner")
+	defer cancel()
+
 	var userId int
-	query := "SELECT user_id FROM workout WHERE id = $1"
-	err := ws.db.QueryRow(query, workoutId).Scan(&userId)
+	query := "SELECT user_id FROM workout WHERE id = $1 AND deleted_at IS NULL"
+	err = ws.db.QueryRowContext(ctx, query, workoutId).Scan(&userId)
 	if err == sql.ErrNoRows {
 		return 0, nil // No workout found
 	}
 	if err != nil {
 		return 0, err
 	}
+	rows = 1
 	return userId, nil
 }
+
+// GetBestOneRepMax returns the user's best estimated one rep max of an
+// exercise in any workout other than excludeWorkoutId, or 0 when there is
+// none.
+func (ws *PostgresWorkoutStore) GetBestOneRepMax(ctx context.Context, userId int, exerciseName string, excludeWorkoutId int64) (best float64, err error) {
+	ctx, span := startSpan(ctx, "WorkoutStore.GetBestOneRepMax", "SELECT", "workout_entries")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "WorkoutStore.GetBestOneRepMax")
+	defer cancel()
+
+	query := "SELECT COALESCE(MAX(CASE WHEN e.reps = 1 THEN e.weight ELSE e.weight * (1 + e.reps / 30.0) END), 0) " +
+		"FROM workout_entries e INNER JOIN workout w ON w.id = e.workout_id " +
+		"WHERE w.user_id = $1 AND LOWER(e.exercise_name) = LOWER($2) AND w.id <> $3 AND w.deleted_at IS NULL AND e.weight IS NOT NULL AND e.reps IS NOT NULL"
+	err = ws.db.QueryRowContext(ctx, query, userId, exerciseName, excludeWorkoutId).Scan(&best)
+	if err != nil {
+		return 0, err
+	}
+	rows = 1
+	return best, nil
+}
+
+// GetWorkoutsSince returns the user's workouts logged since since, with
+// their entries, newest first and at most limit of them.
+func (ws *PostgresWorkoutStore) GetWorkoutsSince(ctx context.Context, userId int, since time.Time, limit int) (workouts []Workout, err error) {
+	ctx, span := startSpan(ctx, "WorkoutStore.GetWorkoutsSince", "SELECT", "workout")
+	defer func() { endSpan(span, int64(len(workouts)), err) }()
+	ctx, cancel := withTimeout(ctx, "WorkoutStore.GetWorkoutsSince")
+	defer cancel()
+
+	query := "SELECT w.id, w.user_id, w.title, w.description, w.duration, w.calories_burned, w.calories_estimated, w.created_at, w.updated_at, " +
+		"e.id, e.exercise_name, e.sets, e.reps, e.duration_seconds, e.weight, e.notes, e.order_index " +
+		"FROM (SELECT * FROM workout WHERE user_id = $1 AND created_at >= $2 AND deleted_at IS NULL ORDER BY created_at DESC, id DESC LIMIT $3) w " +
+		"LEFT JOIN workout_entries e ON e.workout_id = w.id ORDER BY w.created_at DESC, w.id DESC, e.order_index"
+	rows, err := ws.db.QueryContext(ctx, query, userId, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts = []Workout{}
+	for rows.Next() {
+		var workout Workout
+		var entryId, sets, orderIndex *int
+		var exerciseName, notes *string
+		entry := WorkoutEntry{}
+		err = rows.Scan(&workout.Id, &workout.UserId, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned,
+			&workout.CaloriesEstimated, &workout.CreatedAt, &workout.UpdatedAt,
+			&entryId, &exerciseName, &sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &notes, &orderIndex)
+		if err != nil {
+			return nil, err
+		}
+		if len(workouts) == 0 || workouts[len(workouts)-1].Id != workout.Id {
+			workouts = append(workouts, workout)
+		}
+		// Workouts without entries come with a row of NULL entry columns
+		if entryId == nil {
+			continue
+		}
+		entry.Id, entry.ExerciseName, entry.Sets, entry.OrderIndex = *entryId, *exerciseName, *sets, *orderIndex
+		if notes != nil {
+			entry.Notes = *notes
+		}
+		last := &workouts[len(workouts)-1]
+		last.Entries = append(last.Entries, entry)
+	}
+	return workouts, rows.Err()
+}
+
+// GetDeletedWorkouts returns the workouts in the user's trash, most
+// recently deleted first, without their entries.
+func (ws *PostgresWorkoutStore) GetDeletedWorkouts(ctx context.Context, userId int, limit int) (workouts []Workout, err error) {
+	ctx, span := startSpan(ctx, "WorkoutStore.GetDeletedWorkouts", "SELECT", "workout")
+	defer func() { endSpan(span, int64(len(workouts)), err) }()
+	ctx, cancel := withTimeout(ctx, "WorkoutStore.GetDeletedWorkouts")
+	defer cancel()
+
+	query := "SELECT id, user_id, title, description, duration, calories_burned, calories_estimated, created_at, updated_at, deleted_at " +
+		"FROM workout WHERE user_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC LIMIT $2"
+	rows, err := ws.db.QueryContext(ctx, query, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts = []Workout{}
+	for rows.Next() {
+		var workout Workout
+		err = rows.Scan(&workout.Id, &workout.UserId, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned,
+			&workout.CaloriesEstimated, &workout.CreatedAt, &workout.UpdatedAt, &workout.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, workout)
+	}
+	return workouts, rows.Err()
+}
+
+// RestoreWorkout takes a workout of the user out of the trash. It reports
+// false when the user has no deleted workout with that id.
+func (ws *PostgresWorkoutStore) RestoreWorkout(ctx context.Context, id int64, userId int) (restored bool, err error) {
+	ctx, span := startSpan(ctx, "WorkoutStore.RestoreWorkout", "UPDATE", "workout")
+	var rows int64
+	defer func() { endSpan(span, rows, err) }()
+	ctx, cancel := withTimeout(ctx, "WorkoutStore.RestoreWorkout")
+	defer cancel()
+
+	tx, err := ws.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	workout := &Workout{}
+	query := "UPDATE workout SET deleted_at = NULL WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL RETURNING id, user_id, title"
+	err = tx.QueryRowContext(ctx, query, id, userId).Scan(&workout.Id, &workout.UserId, &workout.Title)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	rows = 1
+
+	err = enqueueOutbox(ctx, tx, JobWorkoutEvent, WorkoutEvent{Type: WorkoutRestored, UserId: workout.UserId, Workout: workout})
+	if err != nil {
+		return false, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PurgeDeletedWorkouts permanently deletes the workouts that went to the
+// trash before deletedBefore, with their entries.
+func (ws *PostgresWorkoutStore) PurgeDeletedWorkouts(ctx context.Context, deletedBefore time.Time) (purged int64, err error) {
+	ctx, span := startSpan(ctx, "WorkoutStore.PurgeDeletedWorkouts", "DELETE", "workout")
+	defer func() { endSpan(span, purged, err) }()
+	ctx, cancel := withTimeout(ctx, "WorkoutStore.PurgeDeletedWorkouts")
+	defer cancel()
+
+	result, err := ws.db.ExecContext(ctx, "DELETE FROM workout WHERE deleted_at < $1", deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,123 @@
+package testing
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"workout-tracker/api"
+	"workout-tracker/middleware"
+	"workout-tracker/store"
+	"workout-tracker/tokens"
+)
+
+type stubAPIKeyStore struct {
+	plainText string
+	user      *store.User
+	key       *store.APIKey
+}
+
+func (s *stubAPIKeyStore) CreateAPIKey(ctx context.Context, key *store.APIKey, hash []byte) error {
+	return nil
+}
+
+func (s *stubAPIKeyStore) GetAPIKeysByUser(ctx context.Context, userId int) ([]store.APIKey, error) {
+	return nil, nil
+}
+
+func (s *stubAPIKeyStore) DeleteAPIKey(ctx context.Context, id int64, userId int) (bool, error) {
+	return false, nil
+}
+
+func (s *stubAPIKeyStore) GetUserByAPIKey(ctx context.Context, plainText string) (*store.User, *store.APIKey, error) {
+	if plainText != s.plainText {
+		return nil, nil, nil
+	}
+	return s.user, s.key, nil
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, err := tokens.GenerateAPIKey()
+	require.NoError(t, err)
+
+	assert.True(t, tokens.IsAPIKey(key.PlainText))
+	assert.True(t, strings.HasPrefix(key.PlainText, key.Prefix))
+	assert.Len(t, key.Prefix, 11)
+	assert.Equal(t, tokens.HashSecret(key.PlainText), key.Hash)
+
+	other, err := tokens.GenerateAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key.PlainText, other.PlainText)
+}
+
+func TestAPIKeyScopesEnforced(t *testing.T) {
+	apiKeyStore := &stubAPIKeyStore{
+		plainText: "wt_readonly",
+		user:      &store.User{Id: 4, UserName: "jack_marston"},
+		key:       &store.APIKey{Id: 1, UserId: 4, Scopes: []string{tokens.ScopeWorkoutsRead}},
+	}
+	userMiddleware := middleware.NewUserMiddleware(nil, apiKeyStore, nil, nil)
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, 4, middleware.GetUser(r).Id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		key     string
+		status  int
+	}{
+		{"granted scope", userMiddleware.RequireScope(tokens.ScopeWorkoutsRead, ok), "wt_readonly", http.StatusNoContent},
+		{"missing scope", userMiddleware.RequireScope(tokens.ScopeWorkoutsWrite, ok), "wt_readonly", http.StatusForbidden},
+		{"user route with granted scope", userMiddleware.RequireUserScope(tokens.ScopeWorkoutsRead, ok), "wt_readonly", http.StatusNoContent},
+		{"user route with missing scope", userMiddleware.RequireUserScope(tokens.ScopeAnalyticsRead, ok), "wt_readonly", http.StatusForbidden},
+		{"session only route", userMiddleware.RequireUser(ok), "wt_readonly", http.StatusForbidden},
+		{"unknown key", userMiddleware.RequireScope(tokens.ScopeWorkoutsRead, ok), "wt_unknown", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/workouts/1", nil)
+			request.Header.Set("Authorization", "Bearer "+tt.key)
+			recorder := httptest.NewRecorder()
+			userMiddleware.Authenticate(tt.handler).ServeHTTP(recorder, request)
+			assert.Equal(t, tt.status, recorder.Code)
+		})
+	}
+}
+
+func TestAPIKeyReadsOnlyOwnWorkouts(t *testing.T) {
+	owner := &store.User{Id: 7, UserName: "ana"}
+	other := &store.User{Id: 8, UserName: "ben"}
+	keys := map[string]*stubAPIKeyStore{
+		"wt_owner": {plainText: "wt_owner", user: owner, key: &store.APIKey{Id: 1, UserId: 7, Scopes: []string{tokens.ScopeWorkoutsRead}}},
+		"wt_other": {plainText: "wt_other", user: other, key: &store.APIKey{Id: 2, UserId: 8, Scopes: []string{tokens.ScopeWorkoutsRead}}},
+	}
+	workoutStore := &oneWorkoutStore{workout: store.Workout{Id: 3, UserId: 7, Title: "Legs", Version: 1}}
+	handler := api.NewWorkoutHandler(workoutStore, nil, nil, 0, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for key, status := range map[string]int{"wt_owner": http.StatusOK, "wt_other": http.StatusForbidden} {
+		t.Run(key, func(t *testing.T) {
+			userMiddleware := middleware.NewUserMiddleware(nil, keys[key], nil, nil)
+			router := chi.NewRouter()
+			router.With(userMiddleware.Authenticate).Get("/workouts/{id}", userMiddleware.RequireScope(tokens.ScopeWorkoutsRead, handler.HandleGetWorkoutById))
+
+			request := httptest.NewRequest(http.MethodGet, "/workouts/3", nil)
+			request.Header.Set("Authorization", "Bearer "+key)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			assert.Equal(t, status, recorder.Code)
+			if status != http.StatusOK {
+				assert.Empty(t, recorder.Header().Get("ETag"))
+				assert.NotContains(t, recorder.Body.String(), "Legs")
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package testing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"workout-tracker/calories"
+)
+
+func TestEstimateCalories(t *testing.T) {
+	tests := []struct {
+		name         string
+		activities   []calories.Activity
+		bodyweightKg float64
+		minutes      int
+		want         int
+	}{
+		{
+			name:         "workout without entries uses its duration",
+			bodyweightKg: 80,
+			minutes:      60,
+			want:         400,
+		},
+		{
+			name: "timed entries use their duration",
+			activities: []calories.Activity{
+				{MET: 9.8, Sets: 1, DurationSeconds: IntPtr(1800)},
+			},
+			bodyweightKg: 70,
+			want:         343,
+		},
+		{
+			name: "rep based entries use estimated set time",
+			activities: []calories.Activity{
+				{MET: 6.0, Sets: 3, Reps: IntPtr(10)},
+			},
+			bodyweightKg: 100,
+			want:         45,
+		},
+		{
+			name:    "missing bodyweight falls back to default",
+			minutes: 30,
+			want:    175,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, calories.Estimate(tt.activities, tt.bodyweightKg, tt.minutes))
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package testing
+
+import (
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"workout-tracker/config"
+)
+
+func envFrom(values map[string]string) func(string) string {
+	return func(key string) string {
+		return values[key]
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := config.Load(nil, envFrom(nil))
+	require.NoError(t, err)
+	assert.Equal(t, config.Default(), cfg)
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"addr": ":8080", "db-max-open-conns": 25, "read-timeout": "5s", "bcrypt-cost": 12}`), 0o600)
+	require.NoError(t, err)
+
+	env := envFrom(map[string]string{
+		"WORKOUT_CONFIG":            path,
+		"WORKOUT_DB_MAX_OPEN_CONNS": "30",
+		"WORKOUT_AUTH_TOKEN_TTL":    "1h",
+	})
+	cfg, err := config.Load([]string{"-addr", ":9090"}, env)
+	require.NoError(t, err)
+
+	assert.Equal(t, ":9090", cfg.Server.Addr)
+	assert.Equal(t, 30, cfg.Database.MaxOpenConns)
+	assert.Equal(t, 5*time.Second, cfg.Server.ReadTimeout)
+	assert.Equal(t, time.Hour, cfg.Auth.TokenTTL)
+	assert.Equal(t, 12, cfg.Auth.BcryptCost)
+}
+
+func TestLoadConfigLargeNumbers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"db-max-open-conns": 1000000}`), 0o600)
+	require.NoError(t, err)
+
+	cfg, err := config.Load(nil, envFrom(map[string]string{"WORKOUT_CONFIG": path}))
+	require.NoError(t, err)
+	assert.Equal(t, 1000000, cfg.Database.MaxOpenConns)
+}
+
+func TestLoadConfigHelp(t *testing.T) {
+	_, err := config.Load([]string{"-h"}, envFrom(nil))
+	assert.ErrorIs(t, err, flag.ErrHelp)
+}
+
+func TestLoadConfigQueryTimeouts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"db-query-timeouts": {"GoalStore.GetGoalProgress": "10s"}}`), 0o600)
+	require.NoError(t, err)
+
+	env := envFrom(map[string]string{
+		"WORKOUT_CONFIG":            path,
+		"WORKOUT_DB_QUERY_TIMEOUTS": "WorkoutStore.GetDailyActivity=15s",
+	})
+	cfg, err := config.Load([]string{"-db-query-timeout", "2s"}, env)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2*time.Second, cfg.Database.QueryTimeout)
+	assert.Equal(t, map[string]time.Duration{
+		"GoalStore.GetGoalProgress":     10 * time.Second,
+		"WorkoutStore.GetDailyActivity": 15 * time.Second,
+	}, cfg.Database.QueryTimeouts)
+}
+
+func TestLoadConfigOIDCProviders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"oidc-providers": [{"name": "keycloak", "issuer": "https://sso.example.com/realms/gym", "client_id": "workouts", "redirect_url": "https://workouts.example.com/auth/oidc/keycloak/callback"}]}`), 0o600)
+	require.NoError(t, err)
+
+	cfg, err := config.Load(nil, envFrom(map[string]string{"WORKOUT_CONFIG": path}))
+	require.NoError(t, err)
+	require.Len(t, cfg.OIDC, 1)
+	assert.Equal(t, "keycloak", cfg.OIDC[0].Name)
+	assert.Equal(t, "https://sso.example.com/realms/gym", cfg.OIDC[0].Issuer)
+
+	_, err = config.Load(nil, envFrom(map[string]string{"WORKOUT_OIDC_PROVIDERS": `[{"name": "google"}]`}))
+	assert.ErrorContains(t, err, "oidc-providers need")
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{name: "unparseable duration", env: map[string]string{"WORKOUT_READ_TIMEOUT": "soon"}},
+		{name: "idle above open connections", args: []string{"-db-max-idle-conns", "50"}},
+		{name: "bcrypt cost too low", args: []string{"-bcrypt-cost", "2"}},
+		{name: "empty dsn", args: []string{"-db-dsn", ""}},
+		{name: "negative shutdown delay", args: []string{"-shutdown-delay", "-1s"}},
+		{name: "unknown flag", args: []string{"-port", "80"}},
+		{name: "malformed query timeouts", args: []string{"-db-query-timeouts", "GoalStore.GetGoalProgress"}},
+		{name: "missing config file", env: map[string]string{"WORKOUT_CONFIG": "does-not-exist.json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := config.Load(tt.args, envFrom(tt.env))
+			assert.Error(t, err)
+		})
+	}
+}
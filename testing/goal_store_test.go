@@ -0,0 +1,75 @@
+package testing
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"workout-tracker/store"
+)
+
+func TestGoalProgress(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "goal_tester")
+	workoutStore := store.NewWorkoutStore(db)
+	goalStore := store.NewPostgresGoalStore(db)
+
+	for _, weight := range []float64{80, 90} {
+		_, err := workoutStore.CreateWorkout(context.Background(), &store.Workout{
+			UserId:          user.Id,
+			Title:           "Bench day",
+			DurationMinutes: 45,
+			CaloriesBurned:  250,
+			Entries: []store.WorkoutEntry{
+				{ExerciseName: "Bench Press", Sets: 3, Reps: IntPtr(1), Weight: Float64Ptr(weight), OrderIndex: 1},
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	exercise := "bench press"
+	tests := []struct {
+		name        string
+		goal        *store.Goal
+		wantCurrent float64
+		wantPercent float64
+	}{
+		{
+			name:        "one rep max uses best lift",
+			goal:        &store.Goal{UserId: user.Id, GoalType: store.GoalTypeOneRepMax, ExerciseName: &exercise, TargetValue: 100},
+			wantCurrent: 90,
+			wantPercent: 90,
+		},
+		{
+			name:        "weekly workouts counts this week",
+			goal:        &store.Goal{UserId: user.Id, GoalType: store.GoalTypeWeeklyWorkouts, TargetValue: 4},
+			wantCurrent: 2,
+			wantPercent: 50,
+		},
+		{
+			name:        "monthly volume sums sets reps and weight",
+			goal:        &store.Goal{UserId: user.Id, GoalType: store.GoalTypeMonthlyVolume, TargetValue: 1020},
+			wantCurrent: 510,
+			wantPercent: 50,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goal, err := goalStore.CreateGoal(context.Background(), tt.goal)
+			require.NoError(t, err)
+
+			progress, err := goalStore.GetGoalProgress(context.Background(), goal, time.Now().Add(time.Minute))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCurrent, progress.CurrentValue)
+			assert.Equal(t, tt.wantPercent, progress.PercentComplete)
+			assert.False(t, progress.Completed)
+		})
+	}
+
+	goals, err := goalStore.GetGoalsByUser(context.Background(), user.Id)
+	require.NoError(t, err)
+	assert.Len(t, goals, len(tests))
+}
@@ -0,0 +1,45 @@
+package testing
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"workout-tracker/app"
+)
+
+func TestHealthCheckUnavailable(t *testing.T) {
+	// Nothing listens on port 1, so every ping fails.
+	db, err := sql.Open("pgx", "host=127.0.0.1 port=1 user=postgres dbname=postgres sslmode=disable connect_timeout=1")
+	require.NoError(t, err)
+	defer db.Close()
+
+	var logs bytes.Buffer
+	application := &app.Application{Logger: slog.New(slog.NewTextHandler(&logs, nil)), Db: db}
+
+	check := func() (int, string, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		application.HealthCheck(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, w.Body.String(), body
+	}
+
+	code, raw, body := check()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", body["status"])
+	assert.Equal(t, "unavailable", body["database"].(map[string]interface{})["status"])
+	assert.NotContains(t, raw, "127.0.0.1", "connection details stay out of the public response")
+	assert.Contains(t, logs.String(), "readiness check failed")
+	assert.Contains(t, logs.String(), "127.0.0.1")
+
+	application.BeginShutdown()
+	code, _, body = check()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "shutting_down", body["status"])
+}
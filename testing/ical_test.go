@@ -0,0 +1,149 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+	"workout-tracker/api"
+	"workout-tracker/ical"
+	"workout-tracker/middleware"
+	"workout-tracker/store"
+	"workout-tracker/tokens"
+)
+
+func TestICalEncode(t *testing.T) {
+	start := time.Date(2026, 5, 4, 6, 30, 0, 0, time.UTC)
+	calendar := &ical.Calendar{
+		ProdId:          "-//test//EN",
+		RefreshInterval: 90 * time.Minute,
+		Events: []ical.Event{{
+			Uid:         "workout-1@workout-tracker",
+			Stamp:       start,
+			Start:       start,
+			End:         start.Add(time.Hour),
+			Summary:     "Legs, back; core",
+			Description: strings.Repeat("Squat: 5 x 5 @ 100 kg\n", 4) + "Ünïcödé " + strings.Repeat("é", 40),
+		}},
+	}
+	var out strings.Builder
+	require.NoError(t, calendar.Encode(&out))
+	encoded := out.String()
+
+	assert.True(t, strings.HasPrefix(encoded, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(encoded, "END:VEVENT\r\nEND:VCALENDAR\r\n"))
+	assert.Contains(t, encoded, "REFRESH-INTERVAL;VALUE=DURATION:PT1H30M\r\n")
+	assert.Contains(t, encoded, "DTSTART:20260504T063000Z\r\nDTEND:20260504T073000Z\r\n")
+	assert.Contains(t, encoded, `SUMMARY:Legs\, back\; core`)
+
+	lines := strings.Split(strings.TrimSuffix(encoded, "\r\n"), "\r\n")
+	for _, line := range lines {
+		assert.LessOrEqual(t, len(line), 75, line)
+		assert.True(t, utf8.ValidString(line), line)
+	}
+
+	// Unfolding gives back the escaped description
+	unfolded := strings.ReplaceAll(encoded, "\r\n ", "")
+	assert.Contains(t, unfolded, "DESCRIPTION:"+strings.Repeat(`Squat: 5 x 5 @ 100 kg\n`, 4)+"Ünïcödé "+strings.Repeat("é", 40)+"\r\n")
+}
+
+// memoryFeedStore keeps the hash of one feed secret per user.
+type memoryFeedStore struct {
+	hashes map[int][]byte
+	users  map[int]*store.User
+}
+
+func (s *memoryFeedStore) SetFeedSecret(ctx context.Context, userId int, hash []byte) error {
+	s.hashes[userId] = hash
+	return nil
+}
+
+func (s *memoryFeedStore) DeleteFeed(ctx context.Context, userId int) (bool, error) {
+	_, ok := s.hashes[userId]
+	delete(s.hashes, userId)
+	return ok, nil
+}
+
+func (s *memoryFeedStore) GetUserByFeedSecret(ctx context.Context, plainText string) (*store.User, error) {
+	for userId, hash := range s.hashes {
+		if string(hash) == string(tokens.HashSecret(plainText)) {
+			return s.users[userId], nil
+		}
+	}
+	return nil, nil
+}
+
+// recentWorkoutStore answers GetWorkoutsSince from a slice; other
+// WorkoutStore methods are not used.
+type recentWorkoutStore struct {
+	store.WorkoutStore
+	workouts []store.Workout
+}
+
+func (s *recentWorkoutStore) GetWorkoutsSince(ctx context.Context, userId int, since time.Time, limit int) ([]store.Workout, error) {
+	return s.workouts, nil
+}
+
+func TestCalendarFeed(t *testing.T) {
+	user := &store.User{Id: 7, UserName: "ana", Timezone: "Europe/Berlin"}
+	feedStore := &memoryFeedStore{hashes: map[int][]byte{}, users: map[int]*store.User{7: user}}
+	loggedAt := time.Date(2026, 9, 1, 18, 0, 0, 0, time.UTC)
+	reps, weight := 5, 102.5
+	workoutStore := &recentWorkoutStore{workouts: []store.Workout{{
+		Id:              12,
+		UserId:          7,
+		Title:           "Lower body",
+		DurationMinutes: 45,
+		Entries:         []store.WorkoutEntry{{ExerciseName: "Squat", Sets: 3, Reps: &reps, Weight: &weight}},
+		CreatedAt:       loggedAt,
+		UpdatedAt:       loggedAt.Add(time.Hour),
+	}}}
+	reminderStore := &memoryReminderStore{}
+	require.NoError(t, reminderStore.CreateReminder(context.Background(), &store.Reminder{
+		UserId: 7, Name: "Strength", Kind: store.ReminderSchedule, Days: []string{"mon", "wed", "fri"},
+		TimeOfDay: "07:00", Timezone: "Europe/Berlin", Active: true,
+	}))
+	require.NoError(t, reminderStore.CreateReminder(context.Background(), &store.Reminder{
+		UserId: 7, Name: "Move", Kind: store.ReminderInactivity, InactiveDays: 3, TimeOfDay: "18:00", Timezone: "UTC", Active: true,
+	}))
+	handler := api.NewCalendarFeedHandler(feedStore, workoutStore, reminderStore, "https://workouts.example.com/", slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	created := httptest.NewRecorder()
+	handler.HandleCreateFeed(created, middleware.SetUser(httptest.NewRequest(http.MethodPost, "/users/me/calendar/feed", nil), user))
+	require.Equal(t, http.StatusCreated, created.Code)
+	var body struct {
+		Data struct {
+			URL string `json:"url"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(created.Body.Bytes(), &body))
+	require.True(t, strings.HasPrefix(body.Data.URL, "https://workouts.example.com/calendar/feed.ics?token=cal_"), body.Data.URL)
+
+	feed := httptest.NewRecorder()
+	handler.HandleGetFeed(feed, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(body.Data.URL, "https://workouts.example.com"), nil))
+	require.Equal(t, http.StatusOK, feed.Code)
+	assert.Equal(t, "text/calendar; charset=utf-8", feed.Header().Get("Content-Type"))
+	calendar := strings.ReplaceAll(feed.Body.String(), "\r\n ", "")
+
+	// The workout ends when it was logged and keeps its UID when edited
+	assert.Contains(t, calendar, "UID:workout-12@workout-tracker\r\nDTSTAMP:20260901T190000Z\r\nLAST-MODIFIED:20260901T190000Z\r\n"+
+		"DTSTART:20260901T171500Z\r\nDTEND:20260901T180000Z\r\nSUMMARY:Lower body\r\nDESCRIPTION:Squat: 3 x 5 @ 102.5\r\n")
+	// Four weeks of Monday, Wednesday and Friday sessions; inactivity
+	// reminders plan nothing
+	assert.Equal(t, 13, strings.Count(calendar, "BEGIN:VEVENT"))
+	assert.Equal(t, 12, strings.Count(calendar, "SUMMARY:Strength"))
+
+	// A new secret retires the old URL
+	handler.HandleCreateFeed(httptest.NewRecorder(), middleware.SetUser(httptest.NewRequest(http.MethodPost, "/users/me/calendar/feed", nil), user))
+	stale := httptest.NewRecorder()
+	handler.HandleGetFeed(stale, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(body.Data.URL, "https://workouts.example.com"), nil))
+	assert.Equal(t, http.StatusNotFound, stale.Code)
+}
@@ -0,0 +1,88 @@
+package testing
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+	"workout-tracker/store"
+)
+
+func TestReserveKey(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	user := createTestUser(t, db, "idempotency_owner")
+	keyStore := store.NewPostgresIdempotencyStore(db)
+	reserve := func(key string, hash string, expiredBefore, abandonedBefore time.Time) (*store.IdempotencyKey, *store.IdempotencyKey) {
+		reserved := &store.IdempotencyKey{UserId: user.Id, Key: key, RequestHash: []byte(hash)}
+		existing, err := keyStore.ReserveKey(ctx, reserved, expiredBefore, abandonedBefore)
+		require.NoError(t, err)
+		return reserved, existing
+	}
+	longAgo := time.Now().Add(-time.Hour)
+
+	first, existing := reserve("create", "hash", longAgo, longAgo)
+	assert.Nil(t, existing)
+
+	// A retry while the first request is handled sees it in progress
+	_, existing = reserve("create", "hash", longAgo, longAgo)
+	require.NotNil(t, existing)
+	assert.Zero(t, existing.StatusCode)
+
+	first.StatusCode, first.ContentType, first.Response = 201, "application/json", []byte(`{"id":1}`)
+	require.NoError(t, keyStore.SaveResponse(ctx, first))
+	_, existing = reserve("create", "other", longAgo, longAgo)
+	require.NotNil(t, existing)
+	assert.Equal(t, []byte("hash"), existing.RequestHash)
+	assert.Equal(t, 201, existing.StatusCode)
+	assert.Equal(t, []byte(`{"id":1}`), existing.Response)
+
+	// A response is kept until the key expires, then the key is new again
+	_, existing = reserve("create", "hash", longAgo, time.Now().Add(time.Minute))
+	assert.NotNil(t, existing, "a key with a response is not abandoned")
+	_, existing = reserve("create", "hash", time.Now().Add(time.Minute), longAgo)
+	assert.Nil(t, existing)
+
+	// A key left without a response is claimed again once abandoned, and
+	// the request that abandoned it no longer saves its response
+	stale, existing := reserve("abandoned", "hash", longAgo, longAgo)
+	require.Nil(t, existing)
+	_, existing = reserve("abandoned", "hash", longAgo, time.Now().Add(time.Minute))
+	require.Nil(t, existing)
+	stale.StatusCode, stale.Response = 500, []byte("stale")
+	require.NoError(t, keyStore.SaveResponse(ctx, stale))
+	require.NoError(t, keyStore.ReleaseKey(ctx, stale))
+	_, existing = reserve("abandoned", "hash", longAgo, longAgo)
+	require.NotNil(t, existing)
+	assert.Zero(t, existing.StatusCode)
+
+	// Keys are per user
+	other := createTestUser(t, db, "idempotency_other")
+	existing, err := keyStore.ReserveKey(ctx, &store.IdempotencyKey{UserId: other.Id, Key: "create", RequestHash: []byte("hash")}, longAgo, longAgo)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// Of requests racing for one key, exactly one reserves it
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			existing, err := keyStore.ReserveKey(ctx, &store.IdempotencyKey{UserId: user.Id, Key: "raced", RequestHash: []byte("hash")}, longAgo, longAgo)
+			assert.NoError(t, err)
+			if existing == nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, reserved)
+}
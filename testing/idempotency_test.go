@@ -0,0 +1,115 @@
+package testing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"workout-tracker/middleware"
+	"workout-tracker/response"
+	"workout-tracker/store"
+)
+
+// memoryIdempotencyStore keeps idempotency keys in a map.
+type memoryIdempotencyStore struct {
+	keys map[string]*store.IdempotencyKey
+}
+
+func (s *memoryIdempotencyStore) id(userId int, key string) string {
+	return fmt.Sprintf("%d/%s", userId, key)
+}
+
+func (s *memoryIdempotencyStore) ReserveKey(ctx context.Context, key *store.IdempotencyKey, expiredBefore, abandonedBefore time.Time) (*store.IdempotencyKey, error) {
+	existing, ok := s.keys[s.id(key.UserId, key.Key)]
+	if ok && !existing.CreatedAt.Before(expiredBefore) && (existing.StatusCode != 0 || !existing.CreatedAt.Before(abandonedBefore)) {
+		found := *existing
+		return &found, nil
+	}
+	key.CreatedAt = time.Now()
+	reserved := *key
+	s.keys[s.id(key.UserId, key.Key)] = &reserved
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) SaveResponse(ctx context.Context, key *store.IdempotencyKey) error {
+	saved := *key
+	s.keys[s.id(key.UserId, key.Key)] = &saved
+	return nil
+}
+
+func (s *memoryIdempotencyStore) ReleaseKey(ctx context.Context, key *store.IdempotencyKey) error {
+	delete(s.keys, s.id(key.UserId, key.Key))
+	return nil
+}
+
+func (s *memoryIdempotencyStore) PurgeKeys(ctx context.Context, createdBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	keyStore := &memoryIdempotencyStore{keys: map[string]*store.IdempotencyKey{}}
+	idempotency := middleware.NewIdempotency(keyStore, 24*time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	created, failing := 0, true
+	handler := idempotency.Handle(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if bytes.Contains(body, []byte("flaky")) && failing {
+			failing = false
+			response.InternalServerError(w, "Failed to create workout", nil)
+			return
+		}
+		created++
+		response.Created(w, "Workout successfully created", map[string]interface{}{"id": created})
+	})
+	ana, ben := &store.User{Id: 7, UserName: "ana"}, &store.User{Id: 8, UserName: "ben"}
+	post := func(user *store.User, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/workouts", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(middleware.IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler(w, middleware.SetUser(r, user))
+		return w
+	}
+
+	first := post(ana, "abc-1", `{"title": "Legs"}`)
+	require.Equal(t, http.StatusCreated, first.Code)
+
+	// A retry gets the same response without creating another workout
+	retry := post(ana, "abc-1", `{"title": "Legs"}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+	assert.Equal(t, 1, created)
+
+	// The key cannot be reused for something else, but other users have
+	// their own keys
+	assert.Equal(t, http.StatusUnprocessableEntity, post(ana, "abc-1", `{"title": "Arms"}`).Code)
+	assert.Equal(t, http.StatusCreated, post(ben, "abc-1", `{"title": "Arms"}`).Code)
+	assert.Equal(t, 2, created)
+
+	// A failed request is not remembered, so its retry is handled
+	assert.Equal(t, http.StatusInternalServerError, post(ana, "abc-2", `{"title": "flaky"}`).Code)
+	assert.Equal(t, http.StatusCreated, post(ana, "abc-2", `{"title": "flaky"}`).Code)
+	assert.Equal(t, 3, created)
+
+	// A retry racing the first request is told to wait; the first request
+	// was the same as the one sent with abc-1
+	sameRequest := keyStore.keys[keyStore.id(7, "abc-1")].RequestHash
+	keyStore.keys[keyStore.id(7, "abc-3")] = &store.IdempotencyKey{UserId: 7, Key: "abc-3", RequestHash: sameRequest, CreatedAt: time.Now()}
+	assert.Equal(t, http.StatusConflict, post(ana, "abc-3", `{"title": "Legs"}`).Code)
+
+	// Requests without a key are always handled
+	post(ana, "", `{"title": "Legs"}`)
+	post(ana, "", `{"title": "Legs"}`)
+	assert.Equal(t, 5, created)
+	assert.Equal(t, http.StatusBadRequest, post(ana, "has space", `{}`).Code)
+}
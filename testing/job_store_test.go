@@ -0,0 +1,59 @@
+package testing
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"workout-tracker/store"
+)
+
+func TestClaimJobs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	_, err := db.Exec("TRUNCATE jobs")
+	require.NoError(t, err)
+
+	jobStore := store.NewPostgresJobStore(db)
+	for _, runAt := range []time.Time{time.Now().Add(-time.Minute), time.Now().Add(time.Hour)} {
+		_, err = jobStore.EnqueueJob(ctx, &store.Job{Kind: "test", Payload: []byte("{}"), RunAt: runAt})
+		require.NoError(t, err)
+	}
+
+	// Only the due job is claimed, once
+	claimed, err := jobStore.ClaimJobs(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	first := claimed[0]
+	assert.Equal(t, store.JobRunning, first.Status)
+	assert.Equal(t, 1, first.Attempts)
+	require.NotNil(t, first.LockedUntil)
+
+	claimed, err = jobStore.ClaimJobs(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+
+	// A running job whose lease ran out is claimed again, and the outcome of
+	// the first claim is no longer recorded
+	_, err = db.Exec("UPDATE jobs SET locked_until = $1 WHERE id = $2", time.Now().Add(-time.Second), first.Id)
+	require.NoError(t, err)
+	claimed, err = jobStore.ClaimJobs(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	second := claimed[0]
+	assert.Equal(t, first.Id, second.Id)
+	assert.Equal(t, 2, second.Attempts)
+
+	recorded, err := jobStore.CompleteJob(ctx, &first)
+	require.NoError(t, err)
+	assert.False(t, recorded)
+
+	recorded, err = jobStore.RetryJob(ctx, &second, time.Now().Add(time.Hour), "failed")
+	require.NoError(t, err)
+	assert.True(t, recorded)
+	recorded, err = jobStore.BuryJob(ctx, &second, "failed")
+	require.NoError(t, err)
+	assert.False(t, recorded, "a retried job is no longer running")
+}
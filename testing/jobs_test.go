@@ -0,0 +1,226 @@
+package testing
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+	"workout-tracker/config"
+	"workout-tracker/jobs"
+	"workout-tracker/store"
+)
+
+// memoryJobStore keeps jobs in a slice indexed by id - 1.
+type memoryJobStore struct {
+	mu   sync.Mutex
+	jobs []*store.Job
+}
+
+func (s *memoryJobStore) EnqueueJob(ctx context.Context, job *store.Job) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.jobs {
+		if job.UniqueKey != nil && existing.UniqueKey != nil && *existing.UniqueKey == *job.UniqueKey {
+			return false, nil
+		}
+	}
+	job.Id = int64(len(s.jobs) + 1)
+	job.Status = store.JobPending
+	job.CreatedAt = time.Now()
+	copied := *job
+	s.jobs = append(s.jobs, &copied)
+	return true, nil
+}
+
+func (s *memoryJobStore) ClaimJobs(ctx context.Context, limit int, lease time.Duration) ([]store.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var claimed []store.Job
+	for _, job := range s.jobs {
+		if job.Status == store.JobPending && !job.RunAt.After(time.Now()) && len(claimed) < limit {
+			lockedUntil := time.Now().Add(lease)
+			job.Status, job.LockedUntil = store.JobRunning, &lockedUntil
+			job.Attempts++
+			claimed = append(claimed, *job)
+		}
+	}
+	return claimed, nil
+}
+
+// update changes a job still held by the claim that job was run under.
+func (s *memoryJobStore) update(claimed *store.Job, change func(job *store.Job)) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[claimed.Id-1]
+	if job.Status != store.JobRunning || job.LockedUntil == nil || claimed.LockedUntil == nil || !job.LockedUntil.Equal(*claimed.LockedUntil) {
+		return false, nil
+	}
+	change(job)
+	job.LockedUntil = nil
+	return true, nil
+}
+
+func (s *memoryJobStore) CompleteJob(ctx context.Context, job *store.Job) (bool, error) {
+	return s.update(job, func(job *store.Job) { job.Status = store.JobSucceeded })
+}
+
+func (s *memoryJobStore) RetryJob(ctx context.Context, job *store.Job, runAt time.Time, lastError string) (bool, error) {
+	return s.update(job, func(job *store.Job) {
+		job.Status, job.RunAt, job.LastError = store.JobPending, runAt, &lastError
+	})
+}
+
+func (s *memoryJobStore) BuryJob(ctx context.Context, job *store.Job, lastError string) (bool, error) {
+	return s.update(job, func(job *store.Job) { job.Status, job.LastError = store.JobDead, &lastError })
+}
+
+func (s *memoryJobStore) GetJobStats(ctx context.Context) ([]store.JobStats, error) {
+	return nil, nil
+}
+
+func (s *memoryJobStore) GetJobs(ctx context.Context, status string, limit int) ([]store.Job, error) {
+	return nil, nil
+}
+
+func (s *memoryJobStore) RequeueJob(ctx context.Context, id int64) (bool, error) {
+	return false, nil
+}
+
+func (s *memoryJobStore) PurgeJobs(ctx context.Context, finishedBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+// claim marks a job as running for its given attempt, as ClaimJobs would
+// whether or not it is due, and returns the claimed job.
+func (s *memoryJobStore) claim(id int64, attempt int) store.Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lockedUntil := time.Now().Add(time.Minute)
+	job := s.jobs[id-1]
+	job.Status, job.Attempts, job.LockedUntil = store.JobRunning, attempt, &lockedUntil
+	return *job
+}
+
+func (s *memoryJobStore) get(id int64) store.Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.jobs[id-1]
+}
+
+func newTestRunner(jobStore store.JobStore) *jobs.Runner {
+	return jobs.NewRunner(jobStore, config.JobConfig{
+		Workers:      2,
+		PollInterval: 10 * time.Millisecond,
+		MaxAttempts:  3,
+		RetryBackoff: time.Minute,
+		Lease:        time.Minute,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestJobBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, jobs.Backoff(1, 10*time.Second))
+	assert.Equal(t, 40*time.Second, jobs.Backoff(3, 10*time.Second))
+	assert.Equal(t, time.Hour, jobs.Backoff(20, 10*time.Second))
+}
+
+func TestRunJobRetriesThenDeadLetters(t *testing.T) {
+	jobStore := &memoryJobStore{}
+	runner := newTestRunner(jobStore)
+	runner.Register("flaky", func(ctx context.Context, job *store.Job) error {
+		return errors.New("endpoint unavailable")
+	})
+	runner.Register("panics", func(ctx context.Context, job *store.Job) error {
+		panic("nil map")
+	})
+
+	_, err := jobStore.EnqueueJob(context.Background(), &store.Job{Kind: "flaky", Payload: []byte("{}")})
+	require.NoError(t, err)
+	for attempt := 1; attempt <= 3; attempt++ {
+		job := jobStore.claim(1, attempt)
+		runner.RunJob(context.Background(), &job)
+		if attempt < 3 {
+			retried := jobStore.get(1)
+			assert.Equal(t, store.JobPending, retried.Status)
+			assert.WithinDuration(t, time.Now().Add(jobs.Backoff(attempt, time.Minute)), retried.RunAt, time.Second)
+		}
+	}
+	dead := jobStore.get(1)
+	assert.Equal(t, store.JobDead, dead.Status)
+	assert.Equal(t, "endpoint unavailable", *dead.LastError)
+
+	// A panic fails only the attempt
+	_, err = jobStore.EnqueueJob(context.Background(), &store.Job{Kind: "panics", Payload: []byte("{}")})
+	require.NoError(t, err)
+	job := jobStore.claim(2, 1)
+	runner.RunJob(context.Background(), &job)
+	assert.Equal(t, store.JobPending, jobStore.get(2).Status)
+	assert.Equal(t, "job panicked: nil map", *jobStore.get(2).LastError)
+
+	// Jobs nobody handles are dead-lettered right away
+	_, err = jobStore.EnqueueJob(context.Background(), &store.Job{Kind: "unknown", Payload: []byte("{}")})
+	require.NoError(t, err)
+	job = jobStore.claim(3, 1)
+	runner.RunJob(context.Background(), &job)
+	assert.Equal(t, store.JobDead, jobStore.get(3).Status)
+
+	// A job whose lease ran out and that was claimed again keeps the new
+	// claim's state
+	_, err = jobStore.EnqueueJob(context.Background(), &store.Job{Kind: "flaky", Payload: []byte("{}")})
+	require.NoError(t, err)
+	stale := jobStore.claim(4, 1)
+	reclaimed := jobStore.claim(4, 2)
+	runner.RunJob(context.Background(), &stale)
+	assert.Equal(t, reclaimed, jobStore.get(4))
+}
+
+func TestRunnerRunsQueuedAndScheduledJobs(t *testing.T) {
+	jobStore := &memoryJobStore{}
+	runner := newTestRunner(jobStore)
+	var mu sync.Mutex
+	ran := map[string]int{}
+	count := func(ctx context.Context, job *store.Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ran[job.Kind]++
+		return nil
+	}
+	runner.Register("greet", count)
+	runner.Register("nightly", count)
+	runner.Every("nightly", 24*time.Hour)
+
+	for i := 0; i < 5; i++ {
+		_, err := jobStore.EnqueueJob(context.Background(), &store.Job{Kind: "greet", Payload: []byte("{}")})
+		require.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return ran["greet"] == 5 && ran["nightly"] == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// A second runner sharing the queue does not schedule the interval again
+	second := newTestRunner(jobStore)
+	second.Every("nightly", 24*time.Hour)
+	secondCtx, stopSecond := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	second.Run(secondCtx)
+	stopSecond()
+
+	cancel()
+	<-done
+	assert.Len(t, jobStore.jobs, 6)
+	for _, job := range jobStore.jobs {
+		assert.Equal(t, store.JobSucceeded, job.Status)
+	}
+}
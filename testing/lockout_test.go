@@ -0,0 +1,260 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"workout-tracker/api"
+	"workout-tracker/lockout"
+	"workout-tracker/middleware"
+	"workout-tracker/store"
+	"workout-tracker/tokens"
+	"workout-tracker/totp"
+)
+
+func TestLockoutPolicy(t *testing.T) {
+	policy := lockout.Policy{MaxFailures: 5, Window: 15 * time.Minute, BaseDelay: 250 * time.Millisecond}
+
+	assert.False(t, policy.Locked(4))
+	assert.True(t, policy.Locked(5))
+
+	// The lock lifts once the fifth-newest failure leaves the window.
+	start := time.Date(2026, 1, 3, 9, 0, 0, 0, time.UTC)
+	var failures []time.Time
+	for i := 0; i < 6; i++ {
+		failures = append(failures, start.Add(time.Duration(i)*time.Minute))
+	}
+	assert.Equal(t, start.Add(16*time.Minute), policy.LockedUntil(failures))
+	assert.True(t, policy.LockedUntil(failures[:4]).IsZero())
+
+	assert.Equal(t, time.Duration(0), policy.Delay(0))
+	assert.Equal(t, 250*time.Millisecond, policy.Delay(1))
+	assert.Equal(t, time.Second, policy.Delay(3))
+	assert.Equal(t, 5*time.Second, policy.Delay(20))
+}
+
+// memoryLoginStore keeps login attempts in a slice; its callers do not
+// run concurrently.
+type memoryLoginStore struct {
+	attempts []store.LoginAttempt
+}
+
+func (s *memoryLoginStore) RecordLoginAttempt(ctx context.Context, attempt *store.LoginAttempt) error {
+	if attempt.AttemptedAt.IsZero() {
+		attempt.AttemptedAt = time.Now()
+	}
+	attempt.Id = len(s.attempts) + 1
+	s.attempts = append(s.attempts, *attempt)
+	return nil
+}
+
+func (s *memoryLoginStore) StartLoginAttempt(ctx context.Context, attempt *store.LoginAttempt, since time.Time, maxFailures int) (*store.LoginFailures, error) {
+	failures := &store.LoginFailures{}
+	for _, recorded := range s.attempts {
+		if recorded.Username != attempt.Username || !recorded.AttemptedAt.After(since) {
+			continue
+		}
+		switch recorded.Outcome {
+		case store.LoginWrongPassword, store.LoginUnknownUser, store.LoginWrongMFACode, store.LoginPending:
+			failures.Times = append(failures.Times, recorded.AttemptedAt)
+		case store.LoginSucceeded:
+			failures.Times = nil
+		}
+	}
+	failures.Count = len(failures.Times)
+	attempt.Outcome = store.LoginPending
+	if failures.Count >= maxFailures {
+		attempt.Outcome = store.LoginLocked
+	}
+	return failures, s.RecordLoginAttempt(ctx, attempt)
+}
+
+func (s *memoryLoginStore) FinishLoginAttempt(ctx context.Context, attempt *store.LoginAttempt) error {
+	s.attempts[attempt.Id-1] = *attempt
+	return nil
+}
+
+type namedUserStore struct {
+	store.UserStore
+	user *store.User
+}
+
+func (s *namedUserStore) GetUserByName(ctx context.Context, username string) (*store.User, error) {
+	if username != s.user.UserName {
+		return nil, nil
+	}
+	return s.user, nil
+}
+
+type noMFAStore struct {
+	store.MFAStore
+}
+
+func (s *noMFAStore) GetMFA(ctx context.Context, userId int) (*store.MFA, error) {
+	return nil, nil
+}
+
+type memoryTokenStore struct {
+	store.TokenStore
+}
+
+func (s *memoryTokenStore) CreateNewToken(ctx context.Context, userId int, ttl time.Duration, scope string) (*tokens.Token, error) {
+	return tokens.GenerateToken(userId, ttl, scope)
+}
+
+func TestCreateTokenLockout(t *testing.T) {
+	store.SetBcryptCost(bcrypt.MinCost)
+	t.Cleanup(func() { store.SetBcryptCost(bcrypt.DefaultCost) })
+
+	user := &store.User{Id: 7, UserName: "lifter"}
+	require.NoError(t, user.PasswordHash.Set("correct horse"))
+	logins := &memoryLoginStore{}
+	policy := lockout.Policy{MaxFailures: 3, Window: 15 * time.Minute}
+	handler := api.NewTokenHandler(&memoryTokenStore{}, &namedUserStore{user: user}, logins, &noMFAStore{}, policy,
+		func(*http.Request) string { return "203.0.113.7" }, time.Hour, 5*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	login := func(username, password string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(map[string]string{"username": username, "password": password})
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/tokens/authentication", strings.NewReader(string(body)))
+		r.Header.Set("User-Agent", "lockout-test")
+		handler.HandleCreateToken(w, r)
+		return w
+	}
+
+	t.Run("failures look alike", func(t *testing.T) {
+		logins.attempts = nil
+		wrongPassword := login("lifter", "wrong")
+		unknownUser := login("nobody", "wrong")
+		assert.Equal(t, http.StatusUnauthorized, wrongPassword.Code)
+		assert.Equal(t, http.StatusUnauthorized, unknownUser.Code)
+		assert.JSONEq(t, wrongPassword.Body.String(), unknownUser.Body.String())
+
+		require.Len(t, logins.attempts, 2)
+		assert.Equal(t, store.LoginWrongPassword, logins.attempts[0].Outcome)
+		assert.Equal(t, &user.Id, logins.attempts[0].UserId)
+		assert.Equal(t, "203.0.113.7", logins.attempts[0].IPAddress)
+		assert.Equal(t, "lockout-test", logins.attempts[0].UserAgent)
+		assert.Equal(t, store.LoginUnknownUser, logins.attempts[1].Outcome)
+		assert.Nil(t, logins.attempts[1].UserId)
+	})
+
+	t.Run("locked until a failure leaves the window", func(t *testing.T) {
+		now := time.Now()
+		logins.attempts = nil
+		for _, ago := range []time.Duration{14, 12, 10, 5} {
+			logins.attempts = append(logins.attempts, store.LoginAttempt{Username: "lifter", Outcome: store.LoginWrongPassword, AttemptedAt: now.Add(-ago * time.Minute)})
+		}
+
+		w := login("lifter", "correct horse")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		// Three of the four failures lock; the lock lifts when the one 12
+		// minutes ago leaves the window, not 15 minutes after the last one.
+		retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+		require.NoError(t, err)
+		assert.InDelta(t, 3*60, retryAfter, 2)
+
+		last := logins.attempts[len(logins.attempts)-1]
+		assert.Equal(t, store.LoginLocked, last.Outcome)
+		assert.Equal(t, "lifter", last.Username)
+	})
+
+	t.Run("logins still being checked count as failures", func(t *testing.T) {
+		now := time.Now()
+		logins.attempts = nil
+		for i := 0; i < 3; i++ {
+			logins.attempts = append(logins.attempts, store.LoginAttempt{Id: i + 1, Username: "lifter", Outcome: store.LoginPending, AttemptedAt: now})
+		}
+
+		w := login("lifter", "correct horse")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		require.Len(t, logins.attempts, 4)
+		assert.Equal(t, store.LoginLocked, logins.attempts[3].Outcome)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		logins.attempts = nil
+		w := login("lifter", "correct horse")
+		assert.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, logins.attempts, 1)
+		assert.Equal(t, store.LoginSucceeded, logins.attempts[0].Outcome)
+		assert.Equal(t, &user.Id, logins.attempts[0].UserId)
+	})
+}
+
+// enabledMFAStore has two-factor authentication on, accepts every TOTP
+// step, and knows no recovery codes.
+type enabledMFAStore struct {
+	store.MFAStore
+	mfa      *store.MFA
+	disabled bool
+}
+
+func (s *enabledMFAStore) GetMFA(ctx context.Context, userId int) (*store.MFA, error) {
+	return s.mfa, nil
+}
+
+func (s *enabledMFAStore) UseTOTPStep(ctx context.Context, userId int, step int64) (bool, error) {
+	return true, nil
+}
+
+func (s *enabledMFAStore) UseRecoveryCode(ctx context.Context, userId int, codeHash []byte) (bool, error) {
+	return false, nil
+}
+
+func (s *enabledMFAStore) DisableMFA(ctx context.Context, userId int) error {
+	s.disabled = true
+	return nil
+}
+
+func TestDisableTOTPLockout(t *testing.T) {
+	user := &store.User{Id: 7, UserName: "lifter"}
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	mfaStore := &enabledMFAStore{mfa: &store.MFA{UserId: user.Id, Secret: secret, Enabled: true}}
+	logins := &memoryLoginStore{}
+	policy := lockout.Policy{MaxFailures: 3, Window: 15 * time.Minute}
+	handler := api.NewMFAHandler(mfaStore, logins, policy,
+		func(*http.Request) string { return "203.0.113.7" }, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	disable := func(code string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(map[string]string{"code": code})
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/users/me/mfa/totp", strings.NewReader(string(body)))
+		handler.HandleDisableTOTP(w, middleware.SetUser(r, user))
+		return w
+	}
+
+	for i := 0; i < policy.MaxFailures; i++ {
+		assert.Equal(t, http.StatusBadRequest, disable("not-a-code").Code)
+	}
+	require.Len(t, logins.attempts, policy.MaxFailures)
+	for _, attempt := range logins.attempts {
+		assert.Equal(t, store.LoginWrongMFACode, attempt.Outcome)
+		assert.Equal(t, &user.Id, attempt.UserId)
+	}
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	require.NoError(t, err)
+	w := disable(code)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.False(t, mfaStore.disabled)
+
+	logins.attempts = nil
+	assert.Equal(t, http.StatusOK, disable(code).Code)
+	assert.True(t, mfaStore.disabled)
+	assert.Equal(t, store.LoginMFAVerified, logins.attempts[0].Outcome)
+}
@@ -0,0 +1,75 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"workout-tracker/logging"
+	"workout-tracker/response"
+)
+
+func TestAccessLogRecordsRequest(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "info", "json")
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Use(logging.RequestIDMiddleware)
+	router.Use(logging.AccessLog(logger))
+	router.Get("/workouts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logging.SetUserID(r.Context(), 7)
+		response.InternalServerError(w, "Failed to get workout", errors.New("connection refused"))
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/workouts/3", nil)
+	request.Header.Set(logging.RequestIDHeader, "abc-123")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	assert.Equal(t, "abc-123", recorder.Header().Get(logging.RequestIDHeader))
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "ERROR", entry["level"])
+	assert.Equal(t, "abc-123", entry["request_id"])
+	assert.Equal(t, "/workouts/{id}", entry["route"])
+	assert.Equal(t, float64(500), entry["status"])
+	assert.Equal(t, float64(7), entry["user_id"])
+	assert.Equal(t, "connection refused", entry["error"])
+}
+
+func TestRequestIDGeneratedWhenInvalid(t *testing.T) {
+	handler := logging.RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Len(t, logging.RequestID(r.Context()), 32)
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(logging.RequestIDHeader, "bad id\nwith newline")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	assert.Len(t, recorder.Header().Get(logging.RequestIDHeader), 32)
+}
+
+func TestLoggerRedactsSensitiveFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "debug", "json")
+	require.NoError(t, err)
+
+	logger.Info("user registered", "username", "alice", "email", "alice@example.com", "token", "ABCDEF")
+
+	assert.Contains(t, buf.String(), `"username":"alice"`)
+	assert.NotContains(t, buf.String(), "alice@example.com")
+	assert.NotContains(t, buf.String(), "ABCDEF")
+}
+
+func TestLoggerRejectsUnknownLevel(t *testing.T) {
+	_, err := logging.New(&bytes.Buffer{}, "verbose", "json")
+	assert.Error(t, err)
+}
@@ -0,0 +1,90 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"workout-tracker/api"
+	"workout-tracker/lockout"
+	"workout-tracker/store"
+)
+
+func TestStartLoginAttempt(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	_, err := db.Exec("DELETE FROM login_attempts WHERE username = 'racer'")
+	require.NoError(t, err)
+
+	// Of logins racing for a username, only maxFailures get past the lockout
+	loginStore := store.NewPostgresLoginStore(db)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	outcomes := map[string]int{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempt := &store.LoginAttempt{Username: "racer", IPAddress: "203.0.113.7"}
+			_, err := loginStore.StartLoginAttempt(ctx, attempt, time.Now().Add(-time.Minute), 3)
+			assert.NoError(t, err)
+			mu.Lock()
+			outcomes[attempt.Outcome]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, map[string]int{store.LoginPending: 3, store.LoginLocked: 5}, outcomes)
+
+	// A success resets the failures
+	var id int
+	require.NoError(t, db.QueryRow("SELECT MAX(id) FROM login_attempts WHERE username = 'racer' AND outcome = $1", store.LoginPending).Scan(&id))
+	require.NoError(t, loginStore.FinishLoginAttempt(ctx, &store.LoginAttempt{Id: id, Outcome: store.LoginSucceeded}))
+	attempt := &store.LoginAttempt{Username: "racer"}
+	failures, err := loginStore.StartLoginAttempt(ctx, attempt, time.Now().Add(-time.Minute), 3)
+	require.NoError(t, err)
+	assert.Zero(t, failures.Count)
+	assert.Equal(t, store.LoginPending, attempt.Outcome)
+}
+
+func TestConcurrentLoginsShareConnections(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.SetMaxOpenConns(2)
+
+	const logins = 8
+	for i := 0; i < logins; i++ {
+		createTestUser(t, db, fmt.Sprintf("concurrent_%d", i))
+	}
+	handler := api.NewTokenHandler(store.NewPostgresTokenStore(db), store.NewPostgresUserStore(db), store.NewPostgresLoginStore(db), store.NewPostgresMFAStore(db),
+		lockout.Policy{MaxFailures: 5, Window: 15 * time.Minute}, func(*http.Request) string { return "203.0.113.7" }, time.Hour, 5*time.Minute,
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// More logins than connections all complete, none holding a connection
+	// while it waits for another
+	var wg sync.WaitGroup
+	codes := make([]int, logins)
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"username": "concurrent_%d", "password": "password12345"}`, i)
+			w := httptest.NewRecorder()
+			handler.HandleCreateToken(w, httptest.NewRequest(http.MethodPost, "/tokens/authentication", strings.NewReader(body)))
+			codes[i] = w.Code
+		}()
+	}
+	wg.Wait()
+	for i, code := range codes {
+		assert.Equal(t, http.StatusOK, code, "login %d", i)
+	}
+}
@@ -0,0 +1,31 @@
+package testing
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"workout-tracker/metrics"
+)
+
+func TestMetricsMiddlewareUsesRoutePattern(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(metrics.Middleware)
+	router.Get("/workouts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router.Handle("/metrics", metrics.Handler())
+
+	for _, path := range []string{"/workouts/1", "/workouts/2"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+
+	assert.Contains(t, string(body), `workout_tracker_http_requests_total{method="GET",route="/workouts/{id}",status="418"} 2`)
+	assert.NotContains(t, string(body), `route="/workouts/1"`)
+}
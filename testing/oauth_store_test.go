@@ -0,0 +1,103 @@
+package testing
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+	"workout-tracker/store"
+)
+
+func TestConsumeAuthorizationCode(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	user := createTestUser(t, db, "oauth_code_owner")
+	oauthStore := store.NewPostgresOAuthStore(db)
+	for _, id := range []string{"client-a", "client-b"} {
+		require.NoError(t, oauthStore.CreateClient(ctx, &store.OAuthClient{Id: id, UserId: user.Id, Name: id, RedirectURIs: []string{"https://example.com/callback"}}))
+	}
+	createCode := func(hash string, expiresAt time.Time) {
+		require.NoError(t, oauthStore.CreateAuthorizationCode(ctx, &store.AuthorizationCode{
+			ClientId:      "client-a",
+			UserId:        user.Id,
+			RedirectURI:   "https://example.com/callback",
+			Scopes:        []string{"analytics:read"},
+			CodeChallenge: "challenge",
+			ExpiresAt:     expiresAt,
+		}, []byte(hash)))
+	}
+
+	createCode("code", time.Now().Add(time.Minute))
+	code, err := oauthStore.ConsumeAuthorizationCode(ctx, []byte("code"), "client-b")
+	require.NoError(t, err)
+	assert.Nil(t, code, "another client's code is not consumed")
+
+	code, err = oauthStore.ConsumeAuthorizationCode(ctx, []byte("code"), "client-a")
+	require.NoError(t, err)
+	require.NotNil(t, code)
+	assert.Equal(t, user.Id, code.UserId)
+	assert.Equal(t, []string{"analytics:read"}, code.Scopes)
+
+	code, err = oauthStore.ConsumeAuthorizationCode(ctx, []byte("code"), "client-a")
+	require.NoError(t, err)
+	assert.Nil(t, code, "a code is consumed once")
+
+	createCode("expired", time.Now().Add(-time.Minute))
+	code, err = oauthStore.ConsumeAuthorizationCode(ctx, []byte("expired"), "client-a")
+	require.NoError(t, err)
+	assert.Nil(t, code)
+
+	// Of exchanges racing for one code, exactly one gets it
+	createCode("raced", time.Now().Add(time.Minute))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	consumed := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, err := oauthStore.ConsumeAuthorizationCode(ctx, []byte("raced"), "client-a")
+			assert.NoError(t, err)
+			if code != nil {
+				mu.Lock()
+				consumed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, consumed)
+}
+
+func TestCreateOAuthTokens(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	user := createTestUser(t, db, "oauth_token_owner")
+	oauthStore := store.NewPostgresOAuthStore(db)
+	require.NoError(t, oauthStore.CreateClient(ctx, &store.OAuthClient{Id: "client", UserId: user.Id, Name: "client", RedirectURIs: []string{"https://example.com/callback"}}))
+
+	token := func(kind string) *store.OAuthToken {
+		return &store.OAuthToken{GrantId: "grant", Kind: kind, ClientId: "client", UserId: user.Id, Scopes: []string{"workouts:read"}, ExpiresAt: time.Now().Add(time.Hour)}
+	}
+	err := oauthStore.CreateOAuthTokens(ctx, []*store.OAuthToken{token(store.OAuthAccessToken), token(store.OAuthRefreshToken)}, [][]byte{[]byte("access"), []byte("refresh")})
+	require.NoError(t, err)
+	for _, hash := range []string{"access", "refresh"} {
+		stored, err := oauthStore.GetOAuthToken(ctx, []byte(hash))
+		require.NoError(t, err)
+		require.NotNil(t, stored)
+		assert.Equal(t, "grant", stored.GrantId)
+	}
+
+	// A pair whose refresh token cannot be stored leaves no access token
+	err = oauthStore.CreateOAuthTokens(ctx, []*store.OAuthToken{token(store.OAuthAccessToken), token(store.OAuthRefreshToken)}, [][]byte{[]byte("access-2"), []byte("refresh")})
+	require.Error(t, err)
+	stored, err := oauthStore.GetOAuthToken(ctx, []byte("access-2"))
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+}
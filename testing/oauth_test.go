@@ -0,0 +1,288 @@
+package testing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"workout-tracker/api"
+	"workout-tracker/middleware"
+	"workout-tracker/store"
+	"workout-tracker/tokens"
+)
+
+// memoryOAuthStore keeps OAuth state in maps keyed by hex encoded hashes.
+type memoryOAuthStore struct {
+	users   map[int]*store.User
+	clients map[string]*store.OAuthClient
+	codes   map[string]*store.AuthorizationCode
+	tokens  map[string]*store.OAuthToken
+}
+
+func newMemoryOAuthStore(users ...*store.User) *memoryOAuthStore {
+	s := &memoryOAuthStore{
+		users:   map[int]*store.User{},
+		clients: map[string]*store.OAuthClient{},
+		codes:   map[string]*store.AuthorizationCode{},
+		tokens:  map[string]*store.OAuthToken{},
+	}
+	for _, user := range users {
+		s.users[user.Id] = user
+	}
+	return s
+}
+
+func (s *memoryOAuthStore) CreateClient(ctx context.Context, client *store.OAuthClient) error {
+	client.CreatedAt = time.Now()
+	s.clients[client.Id] = client
+	return nil
+}
+
+func (s *memoryOAuthStore) GetClient(ctx context.Context, id string) (*store.OAuthClient, error) {
+	return s.clients[id], nil
+}
+
+func (s *memoryOAuthStore) CreateAuthorizationCode(ctx context.Context, code *store.AuthorizationCode, hash []byte) error {
+	s.codes[hex.EncodeToString(hash)] = code
+	return nil
+}
+
+func (s *memoryOAuthStore) ConsumeAuthorizationCode(ctx context.Context, hash []byte, clientId string) (*store.AuthorizationCode, error) {
+	code := s.codes[hex.EncodeToString(hash)]
+	if code == nil || code.ClientId != clientId {
+		return nil, nil
+	}
+	delete(s.codes, hex.EncodeToString(hash))
+	if code.ExpiresAt.Before(time.Now()) {
+		return nil, nil
+	}
+	return code, nil
+}
+
+func (s *memoryOAuthStore) CreateOAuthTokens(ctx context.Context, tokens []*store.OAuthToken, hashes [][]byte) error {
+	for i, token := range tokens {
+		s.tokens[hex.EncodeToString(hashes[i])] = token
+	}
+	return nil
+}
+
+func (s *memoryOAuthStore) GetOAuthToken(ctx context.Context, hash []byte) (*store.OAuthToken, error) {
+	token := s.tokens[hex.EncodeToString(hash)]
+	if token == nil || token.ExpiresAt.Before(time.Now()) {
+		return nil, nil
+	}
+	return token, nil
+}
+
+func (s *memoryOAuthStore) ConsumeRefreshToken(ctx context.Context, hash []byte, clientId string) (*store.OAuthToken, error) {
+	token, _ := s.GetOAuthToken(ctx, hash)
+	if token == nil || token.Kind != store.OAuthRefreshToken || token.ClientId != clientId {
+		return nil, nil
+	}
+	delete(s.tokens, hex.EncodeToString(hash))
+	return token, nil
+}
+
+func (s *memoryOAuthStore) RevokeGrant(ctx context.Context, hash []byte, clientId string) error {
+	revoked := s.tokens[hex.EncodeToString(hash)]
+	if revoked == nil || revoked.ClientId != clientId {
+		return nil
+	}
+	for key, token := range s.tokens {
+		if token.GrantId == revoked.GrantId {
+			delete(s.tokens, key)
+		}
+	}
+	return nil
+}
+
+func (s *memoryOAuthStore) GetUserByAccessToken(ctx context.Context, plainText string) (*store.User, *store.OAuthToken, error) {
+	token, _ := s.GetOAuthToken(ctx, tokens.HashSecret(plainText))
+	if token == nil || token.Kind != store.OAuthAccessToken {
+		return nil, nil, nil
+	}
+	return s.users[token.UserId], token, nil
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	// Example from RFC 7636, appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	assert.Equal(t, challenge, tokens.CodeChallenge(verifier))
+	assert.True(t, tokens.VerifyPKCE(verifier, challenge))
+	assert.False(t, tokens.VerifyPKCE(verifier+"x", challenge))
+	assert.False(t, tokens.VerifyPKCE("too-short", tokens.CodeChallenge("too-short")))
+}
+
+// TestOAuthAuthorizationCodeFlow plays a local client through registration,
+// consent, code exchange, an API call, refresh, introspection and
+// revocation.
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	user := &store.User{Id: 4, UserName: "jack_marston"}
+	oauthStore := newMemoryOAuthStore(user)
+	handler := api.NewOAuthHandler(oauthStore, time.Minute, time.Hour, 24*time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	userMiddleware := middleware.NewUserMiddleware(nil, nil, oauthStore, nil)
+
+	router := chi.NewRouter()
+	router.Group(func(r chi.Router) {
+		// Stands in for a logged in session on the consent screen
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, middleware.SetUser(r, user))
+			})
+		})
+		r.Post("/oauth/clients", handler.HandleRegisterClient)
+		r.Get("/oauth/authorize", handler.HandleGetAuthorization)
+		r.Post("/oauth/authorize", handler.HandleAuthorize)
+	})
+	router.Post("/oauth/token", handler.HandleToken)
+	router.Post("/oauth/revoke", handler.HandleRevoke)
+	router.Post("/oauth/introspect", handler.HandleIntrospect)
+	router.With(userMiddleware.Authenticate).Get("/users/me/calendar", userMiddleware.RequireUserScope(tokens.ScopeAnalyticsRead, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	router.With(userMiddleware.Authenticate).Post("/workouts", userMiddleware.RequireScope(tokens.ScopeWorkoutsWrite, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	send := func(request *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	sendJSON := func(method, target string, body interface{}) map[string]interface{} {
+		encoded, err := json.Marshal(body)
+		require.NoError(t, err)
+		recorder := send(httptest.NewRequest(method, target, bytes.NewReader(encoded)))
+		require.Less(t, recorder.Code, 300, recorder.Body.String())
+		var decoded struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &decoded))
+		return decoded.Data
+	}
+	sendForm := func(target string, form url.Values, clientId, secret string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.SetBasicAuth(clientId, secret)
+		return send(request)
+	}
+
+	// Register a confidential client
+	registered := sendJSON(http.MethodPost, "/oauth/clients", map[string]interface{}{
+		"name":          "Local Client",
+		"redirect_uris": []string{"http://127.0.0.1:8080/callback"},
+		"confidential":  true,
+	})
+	clientId := registered["client"].(map[string]interface{})["client_id"].(string)
+	secret := registered["client_secret"].(string)
+
+	// The consent screen shows the client and the requested scopes
+	verifier := strings.Repeat("v", 50)
+	authorization := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientId},
+		"redirect_uri":          {"http://127.0.0.1:8080/callback"},
+		"scope":                 {"analytics:read"},
+		"state":                 {"xyz"},
+		"code_challenge":        {tokens.CodeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	consent := sendJSON(http.MethodGet, "/oauth/authorize?"+authorization.Encode(), nil)
+	assert.Equal(t, "Local Client", consent["client"].(map[string]interface{})["name"])
+
+	// Approving redirects back with a code and the state
+	answer := map[string]interface{}{"approve": true}
+	for key := range authorization {
+		answer[key] = authorization.Get(key)
+	}
+	approved := sendJSON(http.MethodPost, "/oauth/authorize", answer)
+	redirect, err := url.Parse(approved["redirect_uri"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", redirect.Query().Get("state"))
+	code := redirect.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	// A wrong verifier is refused and burns the code
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {"http://127.0.0.1:8080/callback"},
+		"code_verifier": {strings.Repeat("w", 50)},
+	}
+	recorder := sendForm("/oauth/token", exchange, clientId, secret)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "invalid_grant")
+
+	approved = sendJSON(http.MethodPost, "/oauth/authorize", answer)
+	redirect, err = url.Parse(approved["redirect_uri"].(string))
+	require.NoError(t, err)
+	exchange.Set("code", redirect.Query().Get("code"))
+	exchange.Set("code_verifier", verifier)
+
+	// Another client cannot redeem the code, nor burn it for its owner
+	other := sendJSON(http.MethodPost, "/oauth/clients", map[string]interface{}{
+		"name":          "Other Client",
+		"redirect_uris": []string{"http://127.0.0.1:8080/callback"},
+		"confidential":  true,
+	})
+	recorder = sendForm("/oauth/token", exchange, other["client"].(map[string]interface{})["client_id"].(string), other["client_secret"].(string))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "invalid_grant")
+
+	// The wrong client secret is refused
+	recorder = sendForm("/oauth/token", exchange, clientId, "wts_wrong")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = sendForm("/oauth/token", exchange, clientId, secret)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var issued map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &issued))
+	assert.Equal(t, "analytics:read", issued["scope"])
+	accessToken := issued["access_token"].(string)
+	refreshToken := issued["refresh_token"].(string)
+
+	// The access token works within its scopes only
+	callAPI := func(method, target, token string) int {
+		request := httptest.NewRequest(method, target, nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		return send(request).Code
+	}
+	assert.Equal(t, http.StatusNoContent, callAPI(http.MethodGet, "/users/me/calendar", accessToken))
+	assert.Equal(t, http.StatusForbidden, callAPI(http.MethodPost, "/workouts", accessToken))
+
+	// Refreshing rotates the refresh token
+	refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}}
+	recorder = sendForm("/oauth/token", refresh, clientId, secret)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &issued))
+	recorder = sendForm("/oauth/token", refresh, clientId, secret)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// Introspection describes the new token
+	recorder = sendForm("/oauth/introspect", url.Values{"token": {issued["access_token"].(string)}}, clientId, secret)
+	var introspection map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &introspection))
+	assert.Equal(t, true, introspection["active"])
+	assert.Equal(t, "4", introspection["sub"])
+	assert.Equal(t, "Bearer", introspection["token_type"])
+	assert.Equal(t, store.OAuthAccessToken, introspection["token_kind"])
+
+	// Revoking the refresh token revokes the whole grant
+	recorder = sendForm("/oauth/revoke", url.Values{"token": {issued["refresh_token"].(string)}}, clientId, secret)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, http.StatusUnauthorized, callAPI(http.MethodGet, "/users/me/calendar", issued["access_token"].(string)))
+	assert.Equal(t, http.StatusUnauthorized, callAPI(http.MethodGet, "/users/me/calendar", accessToken))
+}
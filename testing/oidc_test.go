@@ -0,0 +1,274 @@
+package testing
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"workout-tracker/api"
+	"workout-tracker/config"
+	"workout-tracker/middleware"
+	"workout-tracker/oidc"
+	"workout-tracker/store"
+	"workout-tracker/tokens"
+)
+
+// mockIdP is a local OpenID Connect provider that issues ID tokens with
+// whatever claims the test sets.
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{}
+	header map[string]interface{}
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp := &mockIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, _ := r.BasicAuth()
+		if clientID != "workouts" || secret != "s3cret" || r.PostFormValue("code") != "good-code" || r.PostFormValue("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "unused", "id_token": idp.sign(t)})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	idp.header = map[string]interface{}{"alg": "RS256", "kid": "key-1"}
+	idp.claims = map[string]interface{}{
+		"iss":            idp.server.URL,
+		"sub":            "248289761001",
+		"aud":            "workouts",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          "n-0S6_WzA2Mj",
+		"email":          "jack@example.com",
+		"email_verified": "true",
+	}
+	return idp
+}
+
+func (idp *mockIdP) sign(t *testing.T) string {
+	header, err := json.Marshal(idp.header)
+	require.NoError(t, err)
+	claims, err := json.Marshal(idp.claims)
+	require.NoError(t, err)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (idp *mockIdP) provider() *oidc.Provider {
+	return oidc.NewProvider(config.OIDCProviderConfig{
+		Name:         "mock",
+		Issuer:       idp.server.URL,
+		ClientID:     "workouts",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:1500/auth/oidc/mock/callback",
+	}, idp.server.Client())
+}
+
+func TestOIDCLoginWithMockProvider(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "n-0S6_WzA2Mj", "challenge")
+	require.NoError(t, err)
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, idp.server.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+	assert.Equal(t, "state-1", parsed.Query().Get("state"))
+	assert.Equal(t, "openid email profile", parsed.Query().Get("scope"))
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+
+	_, err = provider.Exchange(ctx, "bad-code", "verifier")
+	assert.ErrorContains(t, err, "invalid_grant")
+
+	rawIDToken, err := provider.Exchange(ctx, "good-code", "verifier")
+	require.NoError(t, err)
+	claims, err := provider.VerifyIDToken(ctx, rawIDToken, "n-0S6_WzA2Mj")
+	require.NoError(t, err)
+	assert.Equal(t, "248289761001", claims.Subject)
+	assert.Equal(t, "jack@example.com", claims.Email)
+	assert.True(t, bool(claims.EmailVerified))
+}
+
+func TestOIDCRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(idp *mockIdP)
+		nonce  string
+		err    string
+	}{
+		{"wrong nonce", func(idp *mockIdP) {}, "another-login", "nonce"},
+		{"wrong audience", func(idp *mockIdP) { idp.claims["aud"] = "someone-else" }, "n-0S6_WzA2Mj", "another client"},
+		{"wrong issuer", func(idp *mockIdP) { idp.claims["iss"] = "https://evil.example.com" }, "n-0S6_WzA2Mj", "issued by"},
+		{"expired", func(idp *mockIdP) { idp.claims["exp"] = time.Now().Add(-time.Hour).Unix() }, "n-0S6_WzA2Mj", "expired"},
+		{"unsigned", func(idp *mockIdP) { idp.header["alg"] = "none" }, "n-0S6_WzA2Mj", "signature"},
+		{"unknown key", func(idp *mockIdP) { idp.header["kid"] = "key-2" }, "n-0S6_WzA2Mj", "no signing key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			tt.change(idp)
+			_, err := idp.provider().VerifyIDToken(context.Background(), idp.sign(t), tt.nonce)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		idp := newMockIdP(t)
+		parts := strings.Split(idp.sign(t), ".")
+		idp.claims["sub"] = "admin"
+		forged := strings.Split(idp.sign(t), ".")
+		_, err := idp.provider().VerifyIDToken(context.Background(), parts[0]+"."+forged[1]+"."+parts[2], "n-0S6_WzA2Mj")
+		assert.ErrorContains(t, err, "signature")
+	})
+}
+
+type memoryIdentityStore struct {
+	logins     map[string]*store.OIDCLogin
+	users      map[int]*store.User
+	identities map[string]int
+}
+
+func (s *memoryIdentityStore) SaveOIDCLogin(ctx context.Context, login *store.OIDCLogin, stateHash []byte) error {
+	s.logins[hex.EncodeToString(stateHash)] = login
+	return nil
+}
+
+func (s *memoryIdentityStore) ConsumeOIDCLogin(ctx context.Context, stateHash []byte) (*store.OIDCLogin, error) {
+	login := s.logins[hex.EncodeToString(stateHash)]
+	delete(s.logins, hex.EncodeToString(stateHash))
+	return login, nil
+}
+
+func (s *memoryIdentityStore) GetUserByIdentity(ctx context.Context, provider, subject string) (*store.User, error) {
+	userId, ok := s.identities[provider+"/"+subject]
+	if !ok {
+		return nil, nil
+	}
+	return s.users[userId], nil
+}
+
+func (s *memoryIdentityStore) LinkIdentity(ctx context.Context, userId int, provider, subject, email string) error {
+	s.identities[provider+"/"+subject] = userId
+	return nil
+}
+
+func (s *memoryIdentityStore) PurgeOIDCLogins(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestOIDCLoginNeedsLinkedIdentity(t *testing.T) {
+	idp := newMockIdP(t)
+	owner := &store.User{Id: 1, UserName: "jack", Email: "jack@example.com"}
+	other := &store.User{Id: 2, UserName: "john", Email: "john@example.com"}
+	identities := &memoryIdentityStore{
+		logins:     map[string]*store.OIDCLogin{},
+		users:      map[int]*store.User{owner.Id: owner, other.Id: other},
+		identities: map[string]int{},
+	}
+	var loggedIn *store.User
+	handler := api.NewOIDCHandler([]*oidc.Provider{idp.provider()}, identities, func(w http.ResponseWriter, r *http.Request, user *store.User) {
+		loggedIn = user
+		w.WriteHeader(http.StatusOK)
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	router := chi.NewRouter()
+	router.Get("/auth/oidc/{provider}/login", handler.HandleStartLogin)
+	router.Get("/auth/oidc/{provider}/callback", handler.HandleCallback)
+	router.Post("/users/me/identities/{provider}", handler.HandleStartLink)
+
+	// finish follows the provider's redirect back with the state of the
+	// login started by the response.
+	finish := func(started *httptest.ResponseRecorder, authURL string) *httptest.ResponseRecorder {
+		parsed, err := url.Parse(authURL)
+		require.NoError(t, err)
+		state := parsed.Query().Get("state")
+		idp.claims["nonce"] = identities.logins[hex.EncodeToString(tokens.HashSecret(state))].Nonce
+
+		request := httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/callback?code=good-code&state="+url.QueryEscape(state), nil)
+		for _, cookie := range started.Result().Cookies() {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	login := func() *httptest.ResponseRecorder {
+		started := httptest.NewRecorder()
+		router.ServeHTTP(started, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil))
+		require.Equal(t, http.StatusFound, started.Code)
+		return finish(started, started.Header().Get("Location"))
+	}
+	link := func(user *store.User) *httptest.ResponseRecorder {
+		started := httptest.NewRecorder()
+		router.ServeHTTP(started, middleware.SetUser(httptest.NewRequest(http.MethodPost, "/users/me/identities/mock", nil), user))
+		require.Equal(t, http.StatusOK, started.Code, started.Body.String())
+		var body struct {
+			Data map[string]string `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(started.Body.Bytes(), &body))
+		return finish(started, body.Data["authorization_url"])
+	}
+
+	// The provider's verified email matches an account, but is not trusted
+	// to pick it
+	assert.Equal(t, http.StatusForbidden, login().Code)
+	assert.Nil(t, loggedIn)
+	assert.Empty(t, identities.identities)
+
+	recorder := link(owner)
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, owner.Id, identities.identities["mock/248289761001"])
+
+	assert.Equal(t, http.StatusOK, login().Code)
+	assert.Equal(t, owner, loggedIn)
+
+	assert.Equal(t, http.StatusConflict, link(other).Code)
+	assert.Equal(t, owner.Id, identities.identities["mock/248289761001"])
+}
@@ -0,0 +1,66 @@
+package testing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"workout-tracker/overload"
+)
+
+func TestSuggest(t *testing.T) {
+	settings := overload.Settings{WeightIncrement: 2.5, Rounding: 2.5, TargetReps: 5}
+
+	tests := []struct {
+		name       string
+		sessions   []overload.Session
+		wantAction string
+		wantWeight *float64
+		wantReps   int
+	}{
+		{
+			name:       "all target reps hit increases weight",
+			sessions:   []overload.Session{{Weight: Float64Ptr(100), Reps: 5, Sets: 3}},
+			wantAction: overload.ActionIncrease,
+			wantWeight: Float64Ptr(102.5),
+			wantReps:   5,
+		},
+		{
+			name: "single miss holds weight",
+			sessions: []overload.Session{
+				{Weight: Float64Ptr(100), Reps: 4, Sets: 3},
+				{Weight: Float64Ptr(97.5), Reps: 5, Sets: 3},
+			},
+			wantAction: overload.ActionHold,
+			wantWeight: Float64Ptr(100),
+			wantReps:   5,
+		},
+		{
+			name: "repeated misses deload and round down",
+			sessions: []overload.Session{
+				{Weight: Float64Ptr(100), Reps: 4, Sets: 3},
+				{Weight: Float64Ptr(100), Reps: 3, Sets: 3},
+				{Weight: Float64Ptr(100), Reps: 4, Sets: 3},
+			},
+			wantAction: overload.ActionDeload,
+			wantWeight: Float64Ptr(90),
+			wantReps:   5,
+		},
+		{
+			name:       "bodyweight exercise adds a rep",
+			sessions:   []overload.Session{{Reps: 12, Sets: 3}},
+			wantAction: overload.ActionAddReps,
+			wantReps:   13,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suggestion := overload.Suggest(tt.sessions, settings, overload.StepRounder(settings.Rounding))
+			require.NotNil(t, suggestion)
+			assert.Equal(t, tt.wantAction, suggestion.Action)
+			assert.Equal(t, tt.wantWeight, suggestion.Weight)
+			assert.Equal(t, tt.wantReps, suggestion.Reps)
+		})
+	}
+
+	assert.Nil(t, overload.Suggest(nil, settings, overload.StepRounder(settings.Rounding)))
+}
@@ -0,0 +1,152 @@
+package testing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"workout-tracker/plates"
+)
+
+func TestLoadBarbell(t *testing.T) {
+	equipment := plates.DefaultEquipment()
+
+	tests := []struct {
+		name        string
+		target      float64
+		dir         plates.Direction
+		wantWeight  float64
+		wantPerSide []float64
+		wantExact   bool
+	}{
+		{
+			name:        "exact loading uses fewest plates",
+			target:      102.5,
+			dir:         plates.Nearest,
+			wantWeight:  102.5,
+			wantPerSide: []float64{25, 15, 1.25},
+			wantExact:   true,
+		},
+		{
+			name:        "unloadable weight rounds to nearest",
+			target:      101,
+			dir:         plates.Nearest,
+			wantWeight:  100,
+			wantPerSide: []float64{25, 15},
+		},
+		{
+			name:        "rounding up",
+			target:      101,
+			dir:         plates.Up,
+			wantWeight:  102.5,
+			wantPerSide: []float64{25, 15, 1.25},
+		},
+		{
+			name:        "below the bar is just the bar",
+			target:      10,
+			dir:         plates.Nearest,
+			wantWeight:  20,
+			wantPerSide: []float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loading := equipment.LoadBarbell(20, tt.target, tt.dir)
+			assert.Equal(t, tt.wantWeight, loading.Weight)
+			assert.Equal(t, tt.wantPerSide, loading.PerSide)
+			assert.Equal(t, tt.wantExact, loading.Exact)
+		})
+	}
+}
+
+func TestLoadBarbellRespectsPlateCount(t *testing.T) {
+	equipment := &plates.Equipment{
+		Barbells: []float64{20},
+		Plates:   []plates.Plate{{Weight: 20, Pairs: 1}, {Weight: 10, Pairs: 1}},
+	}
+
+	loading := equipment.LoadBarbell(20, 200, plates.Nearest)
+	assert.Equal(t, 80.0, loading.Weight)
+	assert.Equal(t, []float64{20, 10}, loading.PerSide)
+}
+
+func TestLoadBarbellRoundsUpPastTarget(t *testing.T) {
+	equipment := &plates.Equipment{
+		Barbells: []float64{20},
+		Plates:   []plates.Plate{{Weight: 45, Pairs: 1}, {Weight: 1.25, Pairs: 1}},
+	}
+
+	// The lightest load of at least 2 per side is a single 45
+	loading := equipment.LoadBarbell(20, 24, plates.Up)
+	assert.Equal(t, 110.0, loading.Weight)
+	assert.Equal(t, []float64{45}, loading.PerSide)
+
+	loading = equipment.LoadBarbell(20, 500, plates.Up)
+	assert.Equal(t, 112.5, loading.Weight)
+}
+
+func TestWarmupLadder(t *testing.T) {
+	ladder := plates.DefaultEquipment().WarmupLadder(20, 100)
+
+	weights := make([]float64, 0, len(ladder))
+	for _, set := range ladder {
+		weights = append(weights, set.Weight)
+	}
+	assert.Equal(t, []float64{20, 40, 60, 80}, weights)
+}
+
+func TestRoundDumbbellAndMachine(t *testing.T) {
+	equipment := plates.DefaultEquipment()
+	equipment.Machines = []plates.Machine{{Name: "Leg Press", Increment: 10, MaxWeight: 200}}
+
+	weight, ok := equipment.Round(plates.EquipmentDumbbell, "Bicep Curls", 13, plates.Up)
+	assert.True(t, ok)
+	assert.Equal(t, 15.0, weight)
+
+	weight, ok = equipment.Round(plates.EquipmentMachine, "leg press", 250, plates.Up)
+	assert.True(t, ok)
+	assert.Equal(t, 200.0, weight)
+
+	_, ok = equipment.Round(plates.EquipmentMachine, "Lat Pulldown", 50, plates.Up)
+	assert.False(t, ok)
+}
+
+func TestEquipmentValidateBounds(t *testing.T) {
+	assert.NoError(t, plates.DefaultEquipment().Validate())
+
+	tests := map[string]func(e *plates.Equipment){
+		"tiny plate":         func(e *plates.Equipment) { e.Plates = append(e.Plates, plates.Plate{Weight: 0.001, Pairs: 1}) },
+		"too many pairs":     func(e *plates.Equipment) { e.Plates[0].Pairs = 1000 },
+		"too many plates":    func(e *plates.Equipment) { e.Plates = make([]plates.Plate, 21) },
+		"heavy barbell":      func(e *plates.Equipment) { e.Barbells = []float64{1e9} },
+		"tiny dumbbell step": func(e *plates.Equipment) { e.Dumbbells[0].Step = 0.001 },
+		"many dumbbell steps": func(e *plates.Equipment) {
+			e.Dumbbells = []plates.DumbbellRange{{Min: 1, Max: 1000, Step: 0.5}}
+		},
+		"tiny machine increment": func(e *plates.Equipment) {
+			e.Machines = []plates.Machine{{Name: "Leg Press", Increment: 0.001}}
+		},
+	}
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			equipment := plates.DefaultEquipment()
+			change(equipment)
+			assert.Error(t, equipment.Validate())
+		})
+	}
+}
+
+// BenchmarkPlateLoading runs what a plate loading request does, at the
+// limits of a valid equipment profile.
+func BenchmarkPlateLoading(b *testing.B) {
+	equipment := &plates.Equipment{Barbells: []float64{20}}
+	for i := 1; i <= 20; i++ {
+		equipment.Plates = append(equipment.Plates, plates.Plate{Weight: float64(i) * 1.25, Pairs: 20})
+	}
+	if err := equipment.Validate(); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		loading := equipment.LoadBarbell(20, 1000, plates.Nearest)
+		equipment.WarmupLadder(20, loading.Weight)
+	}
+}
@@ -0,0 +1,82 @@
+package testing
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"workout-tracker/middleware"
+	"workout-tracker/ratelimit"
+)
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	policy := ratelimit.Policy{Name: "login", Requests: 3, Period: time.Minute}
+	rateLimitStore := ratelimit.NewMemoryStore()
+	now := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		result, err := rateLimitStore.Take(context.Background(), "ip:1.2.3.4", policy, now)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 2-i, result.Remaining)
+	}
+
+	result, err := rateLimitStore.Take(context.Background(), "ip:1.2.3.4", policy, now)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 20*time.Second, result.RetryAfter)
+	assert.Equal(t, time.Minute, result.Reset)
+
+	// Other clients have their own bucket
+	result, err = rateLimitStore.Take(context.Background(), "ip:5.6.7.8", policy, now)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// One token is back after a third of the period
+	result, err = rateLimitStore.Take(context.Background(), "ip:1.2.3.4", policy, now.Add(20*time.Second))
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	policy := ratelimit.Policy{Name: "register", Requests: 1, Period: time.Hour}
+	limiter := middleware.NewRateLimiter(ratelimit.NewMemoryStore(), false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	handler := limiter.Limit(policy, limiter.ByIP)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	send := func(remoteAddr string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/users", nil)
+		request.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	first := send("10.0.0.1:5000")
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, "1", first.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", first.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1;w=3600", first.Header().Get("RateLimit-Policy"))
+
+	second := send("10.0.0.1:5001")
+	assert.Equal(t, http.StatusTooManyRequests, second.Code)
+	assert.Equal(t, "3600", second.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusCreated, send("10.0.0.2:5000").Code)
+}
+
+func TestRateLimiterClientIP(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = "10.0.0.9:443"
+	request.Header.Set("X-Forwarded-For", "6.6.6.6, 203.0.113.7")
+
+	assert.Equal(t, "10.0.0.9", middleware.NewRateLimiter(nil, false, nil).ClientIP(request))
+	assert.Equal(t, "203.0.113.7", middleware.NewRateLimiter(nil, true, nil).ClientIP(request))
+}
@@ -0,0 +1,231 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+	"workout-tracker/config"
+	"workout-tracker/notify"
+	"workout-tracker/reminders"
+	"workout-tracker/store"
+)
+
+// memoryReminderStore keeps reminders in a slice and records the
+// notifications fired reminders queue.
+type memoryReminderStore struct {
+	reminders   []*store.Reminder
+	lastWorkout map[int]*time.Time
+	sent        []store.NotificationJob
+}
+
+func (s *memoryReminderStore) CreateReminder(ctx context.Context, reminder *store.Reminder) error {
+	reminder.Id = int64(len(s.reminders) + 1)
+	s.reminders = append(s.reminders, reminder)
+	return nil
+}
+
+func (s *memoryReminderStore) GetRemindersByUser(ctx context.Context, userId int) ([]store.Reminder, error) {
+	var found []store.Reminder
+	for _, reminder := range s.reminders {
+		if reminder.UserId == userId {
+			found = append(found, *reminder)
+		}
+	}
+	return found, nil
+}
+
+func (s *memoryReminderStore) DeleteReminder(ctx context.Context, id int64, userId int) (bool, error) {
+	return false, nil
+}
+
+func (s *memoryReminderStore) GetDueReminders(ctx context.Context, now time.Time, limit int) ([]store.Reminder, error) {
+	var due []store.Reminder
+	for _, reminder := range s.reminders {
+		if reminder.Active && !reminder.NextRunAt.After(now) {
+			due = append(due, *reminder)
+		}
+	}
+	return due, nil
+}
+
+func (s *memoryReminderStore) GetLastWorkoutAt(ctx context.Context, userId int) (*time.Time, error) {
+	return s.lastWorkout[userId], nil
+}
+
+func (s *memoryReminderStore) RescheduleReminder(ctx context.Context, reminder *store.Reminder, next time.Time) (bool, error) {
+	stored := s.reminders[reminder.Id-1]
+	if !stored.NextRunAt.Equal(reminder.NextRunAt) {
+		return false, nil
+	}
+	stored.NextRunAt = next
+	return true, nil
+}
+
+func (s *memoryReminderStore) FireReminder(ctx context.Context, reminder *store.Reminder, next time.Time, notification *store.Notification) (bool, error) {
+	stored := s.reminders[reminder.Id-1]
+	if !stored.NextRunAt.Equal(reminder.NextRunAt) {
+		return false, nil
+	}
+	firedAt := time.Now()
+	stored.NextRunAt, stored.LastFiredAt = next, &firedAt
+	for _, channel := range reminder.Channels {
+		s.sent = append(s.sent, store.NotificationJob{Channel: channel, UserId: reminder.UserId, Email: reminder.Email, Notification: *notification})
+	}
+	return true, nil
+}
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	require.NoError(t, err)
+	return loc
+}
+
+func TestReminderNextRun(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	reminder := &store.Reminder{
+		Kind:      store.ReminderSchedule,
+		Days:      []string{"mon", "wed", "fri"},
+		TimeOfDay: "07:00",
+		Timezone:  "America/New_York",
+	}
+
+	// Friday noon: the next run is Monday morning, which is after the
+	// clocks went forward on Sunday, so 11:00 UTC instead of 12:00
+	next, err := reminders.NextRun(reminder, time.Date(2026, 3, 6, 12, 0, 0, 0, newYork))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 9, 11, 0, 0, 0, time.UTC), next.UTC())
+
+	// A run is strictly after the given time
+	next, err = reminders.NextRun(reminder, time.Date(2026, 3, 9, 7, 0, 0, 0, newYork))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 11, 7, 0, 0, 0, newYork), next)
+
+	// Inactivity reminders run daily; 02:30 does not exist on the day the
+	// clocks go forward and becomes 03:30
+	inactivity := &store.Reminder{Kind: store.ReminderInactivity, InactiveDays: 4, TimeOfDay: "02:30", Timezone: "America/New_York"}
+	next, err = reminders.NextRun(inactivity, time.Date(2026, 3, 7, 12, 0, 0, 0, newYork))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 8, 3, 30, 0, 0, newYork), next)
+
+	_, err = reminders.NextRun(&store.Reminder{Kind: store.ReminderSchedule, TimeOfDay: "7am", Days: []string{"mon"}, Timezone: "UTC"}, time.Now())
+	assert.Error(t, err)
+}
+
+func TestEvaluateReminders(t *testing.T) {
+	now := time.Now()
+	daysAgo := func(days int) *time.Time {
+		at := now.Add(-time.Duration(days) * 24 * time.Hour)
+		return &at
+	}
+	reminderStore := &memoryReminderStore{lastWorkout: map[int]*time.Time{1: daysAgo(5), 2: &now}}
+	schedule := func(userId int) *store.Reminder {
+		return &store.Reminder{UserId: userId, Name: "Leg day", Kind: store.ReminderSchedule, Days: []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"},
+			TimeOfDay: "07:00", Timezone: "UTC", Channels: []string{notify.ChannelInApp}, Active: true, NextRunAt: now.Add(-time.Minute)}
+	}
+	inactivity := &store.Reminder{UserId: 1, Name: "Get moving", Kind: store.ReminderInactivity, InactiveDays: 4, TimeOfDay: "18:00",
+		Timezone: "UTC", Channels: []string{notify.ChannelInApp, notify.ChannelEmail}, Active: true, NextRunAt: now.Add(-time.Minute), Email: "ana@example.com"}
+	for _, reminder := range []*store.Reminder{schedule(1), schedule(2), inactivity} {
+		require.NoError(t, reminderStore.CreateReminder(context.Background(), reminder))
+	}
+
+	evaluate := reminders.HandleEvaluate(reminderStore, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, evaluate(context.Background(), &store.Job{}))
+
+	// User 2 trained today, so only user 1 is reminded, on every channel of
+	// the inactivity reminder
+	require.Len(t, reminderStore.sent, 3)
+	assert.Equal(t, "Time to train", reminderStore.sent[0].Notification.Title)
+	assert.Equal(t, 1, reminderStore.sent[0].UserId)
+	assert.Equal(t, "You haven't logged a workout in 5 days.", reminderStore.sent[1].Notification.Body)
+	assert.Equal(t, notify.ChannelEmail, reminderStore.sent[2].Channel)
+	for _, reminder := range reminderStore.reminders {
+		assert.True(t, reminder.NextRunAt.After(now))
+	}
+
+	// The same stretch of inactivity is not reminded about twice
+	inactivity.NextRunAt = now.Add(-time.Minute)
+	require.NoError(t, evaluate(context.Background(), &store.Job{}))
+	assert.Len(t, reminderStore.sent, 3)
+}
+
+type sentMail struct {
+	addr string
+	from string
+	to   []string
+	msg  string
+}
+
+func TestNotificationDispatch(t *testing.T) {
+	var mails []sentMail
+	email := notify.NewEmail(config.SMTPConfig{Addr: "smtp.example.com:587", From: "Workouts <workouts@example.com>"},
+		func(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+			mails = append(mails, sentMail{addr, from, to, string(msg)})
+			return nil
+		})
+	dispatcher := notify.NewDispatcher()
+	dispatcher.Register(notify.ChannelEmail, email)
+	assert.Equal(t, []string{notify.ChannelEmail}, dispatcher.Channels())
+
+	payload, err := json.Marshal(&store.NotificationJob{
+		Key:          "reminder1_1700000000",
+		Channel:      notify.ChannelEmail,
+		UserId:       1,
+		Email:        "ana@example.com",
+		Notification: store.Notification{Title: "Leg day\r\nBcc: everyone@example.com", Body: "Time to train"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, dispatcher.HandleSendNotification()(context.Background(), &store.Job{Payload: payload}))
+
+	require.Len(t, mails, 1)
+	assert.Equal(t, "workouts@example.com", mails[0].from)
+	assert.Equal(t, []string{"ana@example.com"}, mails[0].to)
+	assert.Contains(t, mails[0].msg, "Subject: Leg day Bcc: everyone@example.com\r\n")
+	assert.NotContains(t, mails[0].msg, "\r\nBcc:")
+	assert.True(t, strings.HasSuffix(mails[0].msg, "\r\n\r\nTime to train\r\n"))
+
+	// Channels without a notifier fail the job
+	payload, err = json.Marshal(&store.NotificationJob{Channel: notify.ChannelWebhook})
+	require.NoError(t, err)
+	assert.Error(t, dispatcher.HandleSendNotification()(context.Background(), &store.Job{Payload: payload}))
+}
+
+func TestEmailGivesUpOnSilentServer(t *testing.T) {
+	// The server accepts connections but never sends its greeting
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	email := notify.NewEmail(config.SMTPConfig{Addr: listener.Addr().String(), From: "workouts@example.com"}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = email.Notify(ctx, &store.NotificationJob{Key: "k", Email: "ana@example.com", Notification: store.Notification{Title: "Leg day"}})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// Cancelling the context stops a send without a deadline too
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start = time.Now()
+	err = notify.SendMail(ctx, listener.Addr().String(), nil, "workouts@example.com", []string{"ana@example.com"}, []byte("hi"))
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
@@ -0,0 +1,77 @@
+package testing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"workout-tracker/totp"
+)
+
+// rfcSecret is the SHA1 key from the RFC 6238 test vectors, base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFCVectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := totp.Code(rfcSecret, totp.Step(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.code, code, "unix time %d", tt.unix)
+	}
+}
+
+func TestTOTPValidateAllowsOneStepOfSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := totp.Step(now)
+
+	for _, offset := range []int64{-1, 0, 1} {
+		code, err := totp.Code(rfcSecret, step+offset)
+		require.NoError(t, err)
+		matched, ok := totp.Validate(rfcSecret, code, now)
+		assert.True(t, ok)
+		assert.Equal(t, step+offset, matched)
+	}
+
+	code, err := totp.Code(rfcSecret, step+2)
+	require.NoError(t, err)
+	_, ok := totp.Validate(rfcSecret, code, now)
+	assert.False(t, ok)
+
+	_, ok = totp.Validate(rfcSecret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := totp.URI("Workout Tracker", "jack marston", rfcSecret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Workout%20Tracker:jack%20marston?"))
+	assert.Contains(t, uri, "secret="+rfcSecret)
+	assert.Contains(t, uri, "digits=6")
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := totp.GenerateRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, totp.RecoveryCodeCount)
+
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		assert.Regexp(t, format, code)
+		assert.False(t, seen[code])
+		seen[code] = true
+	}
+
+	assert.Equal(t, totp.HashRecoveryCode(codes[0]), totp.HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+	assert.NotEqual(t, totp.HashRecoveryCode(codes[0]), totp.HashRecoveryCode(codes[1]))
+}
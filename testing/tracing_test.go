@@ -0,0 +1,82 @@
+package testing
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"workout-tracker/api"
+	"workout-tracker/tracing"
+)
+
+var (
+	spanRecorder   = tracetest.NewSpanRecorder()
+	installTracing sync.Once
+)
+
+// recordSpans returns the spans ended from now on. Tracers only delegate to
+// the first provider installed, so all tests share one recorder.
+func recordSpans() func() []sdktrace.ReadOnlySpan {
+	installTracing.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+	})
+	start := len(spanRecorder.Ended())
+	return func() []sdktrace.ReadOnlySpan { return spanRecorder.Ended()[start:] }
+}
+
+func TestTracingMiddlewareContinuesIncomingTrace(t *testing.T) {
+	ended := recordSpans()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	router := chi.NewRouter()
+	router.Use(tracing.Middleware)
+	router.Get("/workouts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/workouts/5", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /workouts/{id}", span.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Contains(t, span.Attributes(), attribute.Int("http.response.status_code", 500))
+	assert.Contains(t, span.Attributes(), attribute.String("http.route", "/workouts/{id}"))
+}
+
+func TestTracingHandlerSpan(t *testing.T) {
+	ended := recordSpans()
+
+	handler := api.NewUserHandler(nil, nil)
+	router := chi.NewRouter()
+	router.Use(tracing.Middleware)
+	router.Post("/users", tracing.Handler(handler.HandleRegisterUser))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", strings.NewReader("{")))
+
+	spans := ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "UserHandler.HandleRegisterUser", spans[0].Name())
+	assert.Equal(t, "POST /users", spans[1].Name())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
+
+func TestTracesURL(t *testing.T) {
+	assert.Equal(t, "http://collector:4318/v1/traces", tracing.TracesURL("http://collector:4318"))
+	assert.Equal(t, "http://collector:4318/v1/traces", tracing.TracesURL("http://collector:4318/"))
+	assert.Equal(t, "https://collector/otlp/v1/traces", tracing.TracesURL("https://collector/otlp/v1/traces"))
+}
@@ -0,0 +1,60 @@
+package testing
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"workout-tracker/api"
+	"workout-tracker/middleware"
+	"workout-tracker/store"
+)
+
+type updatedUserStore struct {
+	store.UserStore
+	updated *store.User
+}
+
+func (s *updatedUserStore) UpdateUser(ctx context.Context, user *store.User) error {
+	s.updated = user
+	return nil
+}
+
+func TestUpdateUserTimezone(t *testing.T) {
+	users := &updatedUserStore{}
+	handler := api.NewUserHandler(users, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	user := &store.User{Id: 1, UserName: "tz", Bio: "lifts", Timezone: "UTC"}
+
+	update := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPatch, "/users/me", strings.NewReader(body))
+		handler.HandleUpdateUser(w, middleware.SetUser(r, user))
+		return w
+	}
+
+	t.Run("valid timezone", func(t *testing.T) {
+		w := update(`{"timezone": "Europe/Berlin"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		require.NotNil(t, users.updated)
+		assert.Equal(t, "Europe/Berlin", users.updated.Timezone)
+		assert.Equal(t, "lifts", users.updated.Bio)
+		assert.Equal(t, "UTC", user.Timezone, "the request's user is not modified")
+	})
+
+	for name, body := range map[string]string{
+		"unknown timezone": `{"timezone": "Mars/Olympus_Mons"}`,
+		"empty timezone":   `{"timezone": ""}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			users.updated = nil
+			w := update(body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Nil(t, users.updated)
+		})
+	}
+}
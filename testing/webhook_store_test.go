@@ -0,0 +1,54 @@
+package testing
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"workout-tracker/store"
+)
+
+func TestClaimDueDeliveries(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	user := createTestUser(t, db, "webhook_owner")
+	webhookStore := store.NewPostgresWebhookStore(db)
+	active := &store.WebhookSubscription{UserId: user.Id, URL: "https://example.com/active", Secret: "whsec_a", Events: []string{"workout.created"}, Active: true}
+	paused := &store.WebhookSubscription{UserId: user.Id, URL: "https://example.com/paused", Secret: "whsec_p", Events: []string{"workout.created"}, Active: true}
+	require.NoError(t, webhookStore.CreateSubscription(ctx, active))
+	require.NoError(t, webhookStore.CreateSubscription(ctx, paused))
+	for i, subscription := range []*store.WebhookSubscription{active, paused} {
+		require.NoError(t, webhookStore.CreateDelivery(ctx, &store.WebhookDelivery{
+			SubscriptionId: subscription.Id,
+			EventId:        []string{"evt_active", "evt_paused"}[i],
+			EventType:      "workout.created",
+			Payload:        []byte(`{}`),
+			NextAttemptAt:  time.Now().Add(-time.Minute),
+		}))
+	}
+	paused.Active = false
+	require.NoError(t, webhookStore.UpdateSubscription(ctx, paused))
+
+	// Deliveries of an inactive subscription are not claimed
+	claimed, err := webhookStore.ClaimDueDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, "evt_active", claimed[0].EventId)
+	assert.Equal(t, "https://example.com/active", claimed[0].URL)
+	assert.Equal(t, "whsec_a", claimed[0].Secret)
+
+	// A claimed delivery is leased to its claimer
+	claimed, err = webhookStore.ClaimDueDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+
+	paused.Active = true
+	require.NoError(t, webhookStore.UpdateSubscription(ctx, paused))
+	claimed, err = webhookStore.ClaimDueDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, "evt_paused", claimed[0].EventId)
+}
@@ -0,0 +1,78 @@
+package testing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"workout-tracker/store"
+)
+
+func activityOn(dates ...string) []store.DailyActivity {
+	days := make([]store.DailyActivity, 0, len(dates))
+	for _, date := range dates {
+		parsed, _ := time.Parse(time.DateOnly, date)
+		days = append(days, store.DailyActivity{Date: parsed, Workouts: 1, DurationMinutes: 30, CaloriesBurned: 200})
+	}
+	return days
+}
+
+func TestCalculateStreaks(t *testing.T) {
+	today, _ := time.Parse(time.DateOnly, "2025-03-10")
+
+	tests := []struct {
+		name        string
+		days        []store.DailyActivity
+		restDays    int
+		wantCurrent int
+		wantLongest int
+	}{
+		{
+			name: "no workouts",
+		},
+		{
+			name:        "consecutive days ending today",
+			days:        activityOn("2025-03-08", "2025-03-09", "2025-03-10"),
+			wantCurrent: 3,
+			wantLongest: 3,
+		},
+		{
+			name:        "rest day breaks streak without tolerance",
+			days:        activityOn("2025-03-01", "2025-03-02", "2025-03-03", "2025-03-05"),
+			wantCurrent: 0,
+			wantLongest: 3,
+		},
+		{
+			name:        "rest day tolerated",
+			days:        activityOn("2025-03-01", "2025-03-02", "2025-03-03", "2025-03-05", "2025-03-09"),
+			restDays:    1,
+			wantCurrent: 1,
+			wantLongest: 5,
+		},
+		{
+			name:        "yesterday keeps the streak alive with tolerance",
+			days:        activityOn("2025-03-07", "2025-03-08"),
+			restDays:    1,
+			wantCurrent: 2,
+			wantLongest: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, longest := store.CalculateStreaks(tt.days, today, tt.restDays)
+			assert.Equal(t, tt.wantCurrent, current)
+			assert.Equal(t, tt.wantLongest, longest)
+		})
+	}
+}
+
+func TestSummarizeWeek(t *testing.T) {
+	today, _ := time.Parse(time.DateOnly, "2025-03-12")
+	days := activityOn("2025-03-09", "2025-03-10", "2025-03-12", "2025-03-17")
+
+	summary := store.SummarizeWeek(days, today)
+	assert.Equal(t, "2025-03-10", summary.WeekStart)
+	assert.Equal(t, 2, summary.Workouts)
+	assert.Equal(t, 2, summary.ActiveDays)
+	assert.Equal(t, 60, summary.DurationMinutes)
+	assert.Equal(t, 400, summary.CaloriesBurned)
+}
@@ -0,0 +1,70 @@
+package testing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"workout-tracker/api"
+	"workout-tracker/store"
+)
+
+func TestWorkoutETags(t *testing.T) {
+	owner := &store.User{Id: 7, UserName: "ana"}
+	workoutStore := &oneWorkoutStore{workout: store.Workout{Id: 3, UserId: 7, Title: "Legs", DurationMinutes: 45, Version: 1}}
+	handler := api.NewWorkoutHandler(workoutStore, nil, nil, 0, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	id := map[string]string{"id": "3"}
+
+	fetched := httptest.NewRecorder()
+	handler.HandleGetWorkoutById(fetched, workoutRequest(http.MethodGet, "/workouts/3", "", owner, id))
+	require.Equal(t, http.StatusOK, fetched.Code)
+	etag := fetched.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	// An unchanged workout is not sent again
+	request := workoutRequest(http.MethodGet, "/workouts/3", "", owner, id)
+	request.Header.Set("If-None-Match", `W/"1"`)
+	notModified := httptest.NewRecorder()
+	handler.HandleGetWorkoutById(notModified, request)
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.String())
+
+	// The first device's update moves the workout to a new version...
+	request = workoutRequest(http.MethodPut, "/workouts/3", `{"title": "Lower body"}`, owner, id)
+	request.Header.Set("If-Match", etag)
+	updated := httptest.NewRecorder()
+	handler.HandleUpdateWorkout(updated, request)
+	require.Equal(t, http.StatusOK, updated.Code)
+	assert.Equal(t, `"2"`, updated.Header().Get("ETag"))
+
+	// ...so the second device, still at the old one, cannot overwrite it
+	request = workoutRequest(http.MethodPut, "/workouts/3", `{"title": "Legs and core"}`, owner, id)
+	request.Header.Set("If-Match", etag)
+	stale := httptest.NewRecorder()
+	handler.HandleUpdateWorkout(stale, request)
+	assert.Equal(t, http.StatusPreconditionFailed, stale.Code)
+	assert.Equal(t, "Lower body", workoutStore.workout.Title)
+
+	request = workoutRequest(http.MethodDelete, "/workouts/3", "", owner, id)
+	request.Header.Set("If-Match", etag)
+	staleDelete := httptest.NewRecorder()
+	handler.HandleDeleteWorkout(staleDelete, request)
+	assert.Equal(t, http.StatusPreconditionFailed, staleDelete.Code)
+	assert.False(t, workoutStore.deleted)
+
+	// When configured, writes must say which version they are for
+	strict := api.NewWorkoutHandler(workoutStore, nil, nil, 0, true, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	unconditional := httptest.NewRecorder()
+	strict.HandleDeleteWorkout(unconditional, workoutRequest(http.MethodDelete, "/workouts/3", "", owner, id))
+	assert.Equal(t, http.StatusPreconditionRequired, unconditional.Code)
+
+	request = workoutRequest(http.MethodDelete, "/workouts/3", "", owner, id)
+	request.Header.Set("If-Match", `"2"`)
+	deleted := httptest.NewRecorder()
+	strict.HandleDeleteWorkout(deleted, request)
+	assert.Equal(t, http.StatusOK, deleted.Code)
+	assert.True(t, workoutStore.deleted)
+}
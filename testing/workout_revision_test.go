@@ -0,0 +1,133 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"workout-tracker/api"
+	"workout-tracker/middleware"
+	"workout-tracker/store"
+)
+
+// oneWorkoutStore keeps one workout, at a version, and the revisions
+// handlers ask it to record; other WorkoutStore methods are not used.
+type oneWorkoutStore struct {
+	store.WorkoutStore
+	workout   store.Workout
+	deleted   bool
+	revisions []store.WorkoutRevision
+}
+
+func (s *oneWorkoutStore) GetWorkoutById(ctx context.Context, id int64) (*store.Workout, error) {
+	if int64(s.workout.Id) != id || s.deleted {
+		return nil, nil
+	}
+	workout := s.workout
+	return &workout, nil
+}
+
+func (s *oneWorkoutStore) GetWorkoutOwner(ctx context.Context, id int64) (int, error) {
+	if int64(s.workout.Id) != id || s.deleted {
+		return 0, nil
+	}
+	return s.workout.UserId, nil
+}
+
+func (s *oneWorkoutStore) UpdateWorkout(ctx context.Context, workout *store.Workout, revision *store.WorkoutRevision) error {
+	if workout.Version != s.workout.Version {
+		return store.ErrWorkoutChanged
+	}
+	workout.Version++
+	s.workout = *workout
+	revision.Revision = len(s.revisions) + 1
+	revision.Snapshot = store.WorkoutSnapshot{Title: workout.Title, Description: workout.Description, DurationMinutes: workout.DurationMinutes,
+		CaloriesBurned: workout.CaloriesBurned, Entries: workout.Entries}
+	s.revisions = append(s.revisions, *revision)
+	return nil
+}
+
+func (s *oneWorkoutStore) DeleteWorkout(ctx context.Context, id int64, version int) error {
+	if version != 0 && version != s.workout.Version {
+		return store.ErrWorkoutChanged
+	}
+	s.deleted = true
+	return nil
+}
+
+func (s *oneWorkoutStore) GetWorkoutRevision(ctx context.Context, workoutId int64, number int) (*store.WorkoutRevision, error) {
+	if number < 1 || number > len(s.revisions) {
+		return nil, nil
+	}
+	return &s.revisions[number-1], nil
+}
+
+func workoutRequest(method, target string, body string, user *store.User, params map[string]string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	routeContext := chi.NewRouteContext()
+	for key, value := range params {
+		routeContext.URLParams.Add(key, value)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+	return middleware.SetUser(r, user)
+}
+
+func TestWorkoutRevisions(t *testing.T) {
+	owner := &store.User{Id: 7, UserName: "ana"}
+	workoutStore := &oneWorkoutStore{workout: store.Workout{Id: 3, UserId: 7, Title: "Legs", Description: "Heavy", DurationMinutes: 45, CaloriesBurned: 300, Version: 1}}
+	handler := api.NewWorkoutHandler(workoutStore, nil, nil, 0, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	id := map[string]string{"id": "3"}
+
+	// Only fields whose value changed are recorded
+	updated := httptest.NewRecorder()
+	handler.HandleUpdateWorkout(updated, workoutRequest(http.MethodPut, "/workouts/3", `{"title": "Lower body", "description": "Heavy"}`, owner, id))
+	require.Equal(t, http.StatusOK, updated.Code)
+	require.Len(t, workoutStore.revisions, 1)
+	revision := workoutStore.revisions[0]
+	assert.Equal(t, 7, revision.UserId)
+	assert.Equal(t, store.RevisionUpdated, revision.Action)
+	assert.Equal(t, map[string]store.FieldChange{"title": {From: "Legs", To: "Lower body"}}, revision.Changes)
+
+	handler.HandleUpdateWorkout(httptest.NewRecorder(), workoutRequest(http.MethodPut, "/workouts/3", `{"duration": 60}`, owner, id))
+	require.Len(t, workoutStore.revisions, 2)
+	assert.Equal(t, map[string]store.FieldChange{"duration": {From: 45, To: 60}}, workoutStore.revisions[1].Changes)
+
+	// Reverting to the first revision undoes the second as a new revision
+	reverted := httptest.NewRecorder()
+	handler.HandleRevertWorkout(reverted, workoutRequest(http.MethodPost, "/workouts/3/revisions/1/revert", "", owner, map[string]string{"id": "3", "revision": "1"}))
+	require.Equal(t, http.StatusOK, reverted.Code)
+	assert.Equal(t, "Lower body", workoutStore.workout.Title)
+	assert.Equal(t, 45, workoutStore.workout.DurationMinutes)
+	require.Len(t, workoutStore.revisions, 3)
+	revision = workoutStore.revisions[2]
+	assert.Equal(t, store.RevisionReverted, revision.Action)
+	require.NotNil(t, revision.RevertedFrom)
+	assert.Equal(t, 1, *revision.RevertedFrom)
+	assert.Equal(t, map[string]store.FieldChange{"duration": {From: 60, To: 45}}, revision.Changes)
+
+	var body struct {
+		Data struct {
+			Revision struct {
+				Revision int `json:"revision"`
+			} `json:"revision"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(reverted.Body.Bytes(), &body))
+	assert.Equal(t, 3, body.Data.Revision.Revision)
+
+	missing := httptest.NewRecorder()
+	handler.HandleRevertWorkout(missing, workoutRequest(http.MethodPost, "/workouts/3/revisions/9/revert", "", owner, map[string]string{"id": "3", "revision": "9"}))
+	assert.Equal(t, http.StatusNotFound, missing.Code)
+
+	// Revisions are only shown to the workout's owner
+	forbidden := httptest.NewRecorder()
+	handler.HandleGetWorkoutRevisions(forbidden, workoutRequest(http.MethodGet, "/workouts/3/revisions", "", &store.User{Id: 8}, id))
+	assert.Equal(t, http.StatusForbidden, forbidden.Code)
+}
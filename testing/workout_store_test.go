@@ -1,11 +1,13 @@
 package testing
 
 import (
+	"context"
 	"database/sql"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 	"workout-tracker/store"
 )
 
@@ -21,7 +23,8 @@ func setupTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to run test db migrations: %v", err)
 	}
 
-	_, err = db.Exec("TRUNCATE workout, workout_entries CASCADE")
+	// users cascades to everything users own, e.g. goals and api keys
+	_, err = db.Exec("TRUNCATE workout, workout_entries, users CASCADE")
 	if err != nil {
 		t.Fatalf("Failed to truncate tables: %v", err)
 	}
@@ -29,6 +32,16 @@ func setupTestDB(t *testing.T) *sql.DB {
 	return db
 }
 
+func createTestUser(t *testing.T, db *sql.DB, username string) *store.User {
+	user := &store.User{
+		UserName: username,
+		Email:    username + "@example.com",
+	}
+	require.NoError(t, user.PasswordHash.Set("password12345"))
+	require.NoError(t, store.NewPostgresUserStore(db).CreateUser(context.Background(), user))
+	return user
+}
+
 func TestCreateWorkout(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -103,7 +116,7 @@ func TestCreateWorkout(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := init.CreateWorkout(tt.workout)
+			got, err := init.CreateWorkout(context.Background(), tt.workout)
 			if tt.wantErr {
 				assert.Error(t, err)
 				return
@@ -113,7 +126,7 @@ func TestCreateWorkout(t *testing.T) {
 			assert.Equal(t, tt.workout.Description, got.Description)
 			assert.Equal(t, tt.workout.DurationMinutes, got.DurationMinutes)
 
-			retrieved, err := init.GetWorkoutById(int64(got.Id))
+			retrieved, err := init.GetWorkoutById(context.Background(), int64(got.Id))
 			require.NoError(t, err)
 
 			assert.Equal(t, tt.workout.Title, retrieved.Title)
@@ -128,6 +141,201 @@ func TestCreateWorkout(t *testing.T) {
 	}
 }
 
+func TestWorkoutStoreTrash(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	user := createTestUser(t, db, "trash_owner")
+	workoutStore := store.NewWorkoutStore(db)
+	create := func(title string) *store.Workout {
+		workout, err := workoutStore.CreateWorkout(ctx, &store.Workout{
+			UserId:          user.Id,
+			Title:           title,
+			DurationMinutes: 45,
+			CaloriesBurned:  300,
+			Entries:         []store.WorkoutEntry{{ExerciseName: "Squat", Sets: 3, Reps: IntPtr(5), Weight: Float64Ptr(200), OrderIndex: 1}},
+		})
+		require.NoError(t, err)
+		return workout
+	}
+	kept := create("Kept")
+	trashed := create("Trashed")
+
+	// A stale version does not delete the workout
+	err := workoutStore.DeleteWorkout(ctx, int64(trashed.Id), trashed.Version+1)
+	assert.ErrorIs(t, err, store.ErrWorkoutChanged)
+	require.NoError(t, workoutStore.DeleteWorkout(ctx, int64(trashed.Id), trashed.Version))
+	assert.ErrorIs(t, workoutStore.DeleteWorkout(ctx, int64(trashed.Id), 0), sql.ErrNoRows)
+
+	t.Run("hidden from reads", func(t *testing.T) {
+		found, err := workoutStore.GetWorkoutById(ctx, int64(trashed.Id))
+		require.NoError(t, err)
+		assert.Nil(t, found)
+
+		owner, err := workoutStore.GetWorkoutOwner(ctx, int64(trashed.Id))
+		require.NoError(t, err)
+		assert.Zero(t, owner)
+
+		workouts, err := workoutStore.GetWorkoutsSince(ctx, user.Id, time.Now().Add(-time.Hour), 10)
+		require.NoError(t, err)
+		require.Len(t, workouts, 1)
+		assert.Equal(t, kept.Id, workouts[0].Id)
+
+		days, err := workoutStore.GetDailyActivity(ctx, user.Id, "UTC")
+		require.NoError(t, err)
+		require.Len(t, days, 1)
+		assert.Equal(t, 1, days[0].Workouts)
+
+		best, err := workoutStore.GetBestOneRepMax(ctx, user.Id, "Squat", int64(kept.Id))
+		require.NoError(t, err)
+		assert.Zero(t, best)
+
+		trash, err := workoutStore.GetDeletedWorkouts(ctx, user.Id, 10)
+		require.NoError(t, err)
+		require.Len(t, trash, 1)
+		assert.Equal(t, trashed.Id, trash[0].Id)
+		assert.NotNil(t, trash[0].DeletedAt)
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		restored, err := workoutStore.RestoreWorkout(ctx, int64(trashed.Id), user.Id+1)
+		require.NoError(t, err)
+		assert.False(t, restored, "only the owner restores a workout")
+
+		restored, err = workoutStore.RestoreWorkout(ctx, int64(trashed.Id), user.Id)
+		require.NoError(t, err)
+		assert.True(t, restored)
+		found, err := workoutStore.GetWorkoutById(ctx, int64(trashed.Id))
+		require.NoError(t, err)
+		require.NotNil(t, found)
+		assert.Len(t, found.Entries, 1)
+
+		restored, err = workoutStore.RestoreWorkout(ctx, int64(trashed.Id), user.Id)
+		require.NoError(t, err)
+		assert.False(t, restored, "a workout not in the trash is not restored")
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		require.NoError(t, workoutStore.DeleteWorkout(ctx, int64(trashed.Id), 0))
+		purged, err := workoutStore.PurgeDeletedWorkouts(ctx, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Zero(t, purged, "workouts deleted recently are kept")
+
+		_, err = db.Exec("UPDATE workout SET deleted_at = $1 WHERE id = $2", time.Now().Add(-2*time.Hour), trashed.Id)
+		require.NoError(t, err)
+		purged, err = workoutStore.PurgeDeletedWorkouts(ctx, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), purged)
+
+		var entries int
+		require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM workout_entries WHERE workout_id = $1", trashed.Id).Scan(&entries))
+		assert.Zero(t, entries)
+		trash, err := workoutStore.GetDeletedWorkouts(ctx, user.Id, 10)
+		require.NoError(t, err)
+		assert.Empty(t, trash)
+		found, err := workoutStore.GetWorkoutById(ctx, int64(kept.Id))
+		require.NoError(t, err)
+		assert.NotNil(t, found)
+	})
+}
+
+func TestUpdateWorkoutRevisions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	user := createTestUser(t, db, "revision_owner")
+	workoutStore := store.NewWorkoutStore(db)
+	workout, err := workoutStore.CreateWorkout(ctx, &store.Workout{
+		UserId:          user.Id,
+		Title:           "Lower body",
+		DurationMinutes: 60,
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Squat", Sets: 3, Reps: IntPtr(5), Weight: Float64Ptr(100), OrderIndex: 1},
+			{ExerciseName: "Lunge", Sets: 3, Reps: IntPtr(10), OrderIndex: 2},
+			{ExerciseName: "Calf Raise", Sets: 4, Reps: IntPtr(15), OrderIndex: 3},
+		},
+	})
+	require.NoError(t, err)
+	squat, lunge, calfRaise := workout.Entries[0], workout.Entries[1], workout.Entries[2]
+
+	// Keep the squat, modify the lunge, remove the calf raise, add a deadlift
+	workout.Entries = []store.WorkoutEntry{
+		squat,
+		{Id: lunge.Id, ExerciseName: "Lunge", Sets: 4, Reps: IntPtr(10), OrderIndex: 2},
+		{ExerciseName: "Deadlift", Sets: 1, Reps: IntPtr(5), Weight: Float64Ptr(140), OrderIndex: 3},
+	}
+	revision := &store.WorkoutRevision{UserId: user.Id, Action: store.RevisionUpdated}
+	require.NoError(t, workoutStore.UpdateWorkout(ctx, workout, revision))
+	assert.Equal(t, 2, revision.Revision, "revision 1 is the creation")
+
+	changes := map[string]store.EntryChange{}
+	for _, change := range revision.Entries {
+		changes[change.Change] = change
+	}
+	require.Len(t, revision.Entries, 3)
+	assert.Equal(t, lunge.Id, changes[store.EntryModified].EntryId)
+	assert.Equal(t, 3, changes[store.EntryModified].Before.Sets)
+	assert.Equal(t, 4, changes[store.EntryModified].After.Sets)
+	assert.Equal(t, calfRaise.Id, changes[store.EntryRemoved].EntryId)
+	assert.Nil(t, changes[store.EntryRemoved].After)
+	deadlift := workout.Entries[2]
+	assert.NotZero(t, deadlift.Id)
+	assert.Equal(t, deadlift.Id, changes[store.EntryAdded].EntryId)
+	assert.Nil(t, changes[store.EntryAdded].Before)
+
+	stored, err := workoutStore.GetWorkoutById(ctx, int64(workout.Id))
+	require.NoError(t, err)
+	require.Len(t, stored.Entries, 3)
+	assert.Equal(t, []int{squat.Id, lunge.Id, deadlift.Id}, []int{stored.Entries[0].Id, stored.Entries[1].Id, stored.Entries[2].Id})
+
+	// Saving without changes leaves no revision
+	unchanged := &store.WorkoutRevision{UserId: user.Id, Action: store.RevisionUpdated}
+	require.NoError(t, workoutStore.UpdateWorkout(ctx, stored, unchanged))
+	assert.Zero(t, unchanged.Revision)
+	revisions, err := workoutStore.GetWorkoutRevisions(ctx, int64(workout.Id), 10)
+	require.NoError(t, err)
+	assert.Len(t, revisions, 2)
+
+	// A stale version is refused
+	stale := *workout
+	assert.ErrorIs(t, workoutStore.UpdateWorkout(ctx, &stale, &store.WorkoutRevision{UserId: user.Id, Action: store.RevisionUpdated}), store.ErrWorkoutChanged)
+
+	// Reverting to the creation brings the calf raise back as a new entry
+	// and removes the deadlift added since
+	created, err := workoutStore.GetWorkoutRevision(ctx, int64(workout.Id), 1)
+	require.NoError(t, err)
+	require.NotNil(t, created)
+	stored.Entries = created.Snapshot.Entries
+	number := 1
+	reverted := &store.WorkoutRevision{UserId: user.Id, Action: store.RevisionReverted, RevertedFrom: &number}
+	require.NoError(t, workoutStore.UpdateWorkout(ctx, stored, reverted))
+	assert.Equal(t, 3, reverted.Revision)
+
+	restored, err := workoutStore.GetWorkoutById(ctx, int64(workout.Id))
+	require.NoError(t, err)
+	require.Len(t, restored.Entries, 3)
+	assert.Equal(t, squat.Id, restored.Entries[0].Id)
+	assert.Equal(t, lunge.Id, restored.Entries[1].Id)
+	assert.Equal(t, 3, restored.Entries[1].Sets)
+	assert.Equal(t, "Calf Raise", restored.Entries[2].ExerciseName)
+	assert.NotEqual(t, calfRaise.Id, restored.Entries[2].Id)
+	assert.NotEqual(t, deadlift.Id, restored.Entries[2].Id)
+
+	kinds := map[string]int{}
+	for _, change := range reverted.Entries {
+		kinds[change.Change]++
+	}
+	assert.Equal(t, map[string]int{store.EntryModified: 1, store.EntryAdded: 1, store.EntryRemoved: 1}, kinds)
+
+	revision, err = workoutStore.GetWorkoutRevision(ctx, int64(workout.Id), 3)
+	require.NoError(t, err)
+	require.NotNil(t, revision)
+	assert.Equal(t, store.RevisionReverted, revision.Action)
+	assert.Equal(t, &number, revision.RevertedFrom)
+}
+
 func IntPtr(i int) *int {
 	return &i
 }
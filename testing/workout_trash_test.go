@@ -0,0 +1,106 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"workout-tracker/api"
+	"workout-tracker/jobs"
+	"workout-tracker/middleware"
+	"workout-tracker/store"
+)
+
+// trashWorkoutStore keeps workouts in a map and answers the trash methods;
+// other WorkoutStore methods are not used.
+type trashWorkoutStore struct {
+	store.WorkoutStore
+	workouts     map[int64]*store.Workout
+	purgedBefore time.Time
+}
+
+func (s *trashWorkoutStore) GetDeletedWorkouts(ctx context.Context, userId int, limit int) ([]store.Workout, error) {
+	var deleted []store.Workout
+	for _, workout := range s.workouts {
+		if workout.UserId == userId && workout.DeletedAt != nil {
+			deleted = append(deleted, *workout)
+		}
+	}
+	return deleted, nil
+}
+
+func (s *trashWorkoutStore) RestoreWorkout(ctx context.Context, id int64, userId int) (bool, error) {
+	workout, ok := s.workouts[id]
+	if !ok || workout.UserId != userId || workout.DeletedAt == nil {
+		return false, nil
+	}
+	workout.DeletedAt = nil
+	return true, nil
+}
+
+func (s *trashWorkoutStore) GetWorkoutById(ctx context.Context, id int64) (*store.Workout, error) {
+	workout, ok := s.workouts[id]
+	if !ok || workout.DeletedAt != nil {
+		return nil, nil
+	}
+	return workout, nil
+}
+
+func (s *trashWorkoutStore) PurgeDeletedWorkouts(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	s.purgedBefore = deletedBefore
+	return 0, nil
+}
+
+func TestWorkoutTrash(t *testing.T) {
+	user := &store.User{Id: 7, UserName: "ana"}
+	deletedAt := time.Date(2026, 9, 1, 18, 0, 0, 0, time.UTC)
+	workoutStore := &trashWorkoutStore{workouts: map[int64]*store.Workout{
+		1: {Id: 1, UserId: 7, Title: "Lower body", DeletedAt: &deletedAt},
+		2: {Id: 2, UserId: 8, Title: "Someone else's", DeletedAt: &deletedAt},
+	}}
+	retention := 30 * 24 * time.Hour
+	handler := api.NewWorkoutHandler(workoutStore, nil, nil, retention, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	trash := httptest.NewRecorder()
+	handler.HandleGetTrash(trash, middleware.SetUser(httptest.NewRequest(http.MethodGet, "/workouts/trash", nil), user))
+	require.Equal(t, http.StatusOK, trash.Code)
+	var body struct {
+		Data []struct {
+			Id      int       `json:"id"`
+			PurgeAt time.Time `json:"purge_at"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(trash.Body.Bytes(), &body))
+	require.Len(t, body.Data, 1)
+	assert.Equal(t, 1, body.Data[0].Id)
+	assert.True(t, deletedAt.Add(retention).Equal(body.Data[0].PurgeAt))
+
+	invalid := httptest.NewRecorder()
+	handler.HandleGetTrash(invalid, middleware.SetUser(httptest.NewRequest(http.MethodGet, "/workouts/trash?limit=0", nil), user))
+	assert.Equal(t, http.StatusBadRequest, invalid.Code)
+
+	// Only the owner can restore a workout, and only once
+	other := httptest.NewRecorder()
+	handler.HandleRestoreWorkout(other, workoutRequest(http.MethodPost, "/workouts/2/restore", "", user, map[string]string{"id": "2"}))
+	assert.Equal(t, http.StatusNotFound, other.Code)
+
+	restored := httptest.NewRecorder()
+	handler.HandleRestoreWorkout(restored, workoutRequest(http.MethodPost, "/workouts/1/restore", "", user, map[string]string{"id": "1"}))
+	assert.Equal(t, http.StatusOK, restored.Code)
+	assert.Nil(t, workoutStore.workouts[1].DeletedAt)
+
+	again := httptest.NewRecorder()
+	handler.HandleRestoreWorkout(again, workoutRequest(http.MethodPost, "/workouts/1/restore", "", user, map[string]string{"id": "1"}))
+	assert.Equal(t, http.StatusNotFound, again.Code)
+
+	// The purge job removes what was deleted before the retention
+	before := time.Now()
+	require.NoError(t, jobs.PurgeTrash(workoutStore, retention)(context.Background(), &store.Job{}))
+	assert.WithinDuration(t, before.Add(-retention), workoutStore.purgedBefore, time.Minute)
+}
@@ -0,0 +1,54 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+)
+
+// APIKeyPrefix marks a bearer credential as an API key rather than a
+// session token, and makes leaked keys easy to spot.
+const APIKeyPrefix = "wt_"
+
+// apiKeyDisplayLength is how much of a key is kept in plaintext so users
+// can tell their keys apart.
+const apiKeyDisplayLength = len(APIKeyPrefix) + 8
+
+type APIKey struct {
+	PlainText string
+	Hash      []byte
+	Prefix    string
+}
+
+func GenerateAPIKey() (*APIKey, error) {
+	plainText, err := GenerateSecret(APIKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return &APIKey{
+		PlainText: plainText,
+		Hash:      HashSecret(plainText),
+		Prefix:    plainText[:apiKeyDisplayLength],
+	}, nil
+}
+
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// HashSecret returns the hash a prefixed secret is stored as.
+func HashSecret(plainText string) []byte {
+	hash := sha256.Sum256([]byte(plainText))
+	return hash[:]
+}
+
+// GenerateSecret returns 256 random bits, base32 encoded after prefix.
+func GenerateSecret(prefix string) (string, error) {
+	emptyByte := make([]byte, 32)
+	_, err := rand.Read(emptyByte)
+	if err != nil {
+		return "", err
+	}
+	return prefix + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(emptyByte)), nil
+}
@@ -0,0 +1,65 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// Prefixes of the secrets issued by the OAuth authorization server.
+const (
+	AccessTokenPrefix       = "wta_"
+	RefreshTokenPrefix      = "wtr_"
+	AuthorizationCodePrefix = "wtc_"
+	ClientSecretPrefix      = "wts_"
+)
+
+// PKCEMethodS256 is the only code challenge method accepted. Plain
+// challenges offer no protection against an intercepted code.
+const PKCEMethodS256 = "S256"
+
+// codeVerifierPattern is the code verifier syntax from RFC 7636.
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+func IsAccessToken(credential string) bool {
+	return strings.HasPrefix(credential, AccessTokenPrefix)
+}
+
+// GenerateClientID returns a random, non-secret client identifier.
+func GenerateClientID() (string, error) {
+	return randomHex()
+}
+
+// GenerateGrantID returns an identifier shared by the tokens issued from one
+// authorization.
+func GenerateGrantID() (string, error) {
+	return randomHex()
+}
+
+func randomHex() (string, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// CodeChallenge derives the S256 code challenge of a verifier.
+func CodeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// VerifyPKCE reports whether verifier is well formed and matches the S256
+// challenge sent with the authorization request.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(CodeChallenge(verifier)), []byte(challenge)) == 1
+}
@@ -0,0 +1,19 @@
+package tokens
+
+const (
+	ScopeWorkoutsRead  = "workouts:read"
+	ScopeWorkoutsWrite = "workouts:write"
+	ScopeAnalyticsRead = "analytics:read"
+)
+
+// DelegatedScopes are the scopes an API key or OAuth client may be granted.
+var DelegatedScopes = []string{ScopeWorkoutsRead, ScopeWorkoutsWrite, ScopeAnalyticsRead}
+
+func ValidDelegatedScope(scope string) bool {
+	for _, valid := range DelegatedScopes {
+		if scope == valid {
+			return true
+		}
+	}
+	return false
+}
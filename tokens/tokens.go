@@ -9,6 +9,10 @@ import (
 
 const (
 	ScopeAuth = "authentication"
+	// ScopeMFAPending is issued after a correct password when the account
+	// has two-factor authentication. It is only accepted by the endpoint
+	// exchanging it and a code for a ScopeAuth token.
+	ScopeMFAPending = "mfa-pending"
 )
 
 type Token struct {
@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+var tracer = otel.Tracer("workout-tracker/http")
+
+// Middleware starts a server span for each request, continuing the trace
+// from the caller's traceparent header. The span is named after the chi
+// route pattern once routing has resolved it, e.g. "GET /workouts/{id}".
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("user_agent.original", r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(attribute.String("http.route", rctx.RoutePattern()))
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// Handler runs h in an internal span named after the handler method, e.g.
+// "WorkoutHandler.HandleGetWorkoutById", so that time spent in the handler
+// is told apart from time spent in middleware.
+func Handler(h http.HandlerFunc) http.HandlerFunc {
+	name := handlerName(h)
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), name, trace.WithSpanKind(trace.SpanKindInternal))
+		defer span.End()
+		h(w, r.WithContext(ctx))
+	}
+}
+
+// handlerName turns the runtime name of a method value, such as
+// "workout-tracker/api.(*WorkoutHandler).HandleGetWorkoutById-fm", into
+// "WorkoutHandler.HandleGetWorkoutById".
+func handlerName(h http.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.TrimSuffix(name, "-fm")
+	name = strings.NewReplacer("(*", "", ")", "").Replace(name)
+	if i := strings.Index(name, "."); i >= 0 && strings.Count(name, ".") > 1 {
+		name = name[i+1:]
+	}
+	return name
+}
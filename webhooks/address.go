@@ -0,0 +1,59 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// errBlockedAddress is returned when an endpoint resolves to an address
+// webhooks may not reach.
+var errBlockedAddress = errors.New("the endpoint's address is not allowed")
+
+// blockedAddr reports whether addr is on the machine or a private network,
+// where a webhook could reach services that are not meant to be public.
+func blockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsUnspecified()
+}
+
+// dialControl refuses connections to blocked addresses. It runs after the
+// host name has been resolved, for the address actually dialed, so a name
+// that resolves to a public address when the URL is checked and a private
+// one when it is delivered to is still refused.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || blockedAddr(addr) {
+		return errBlockedAddress
+	}
+	return nil
+}
+
+// CheckURL validates a subscription's endpoint URL: an absolute https URL
+// whose host is not a loopback or private address, unless the worker may
+// reach private networks.
+func (wk *Worker) CheckURL(raw string) error {
+	uri, err := url.Parse(raw)
+	if err != nil || uri.Scheme != "https" || uri.Host == "" || uri.User != nil || uri.Fragment != "" {
+		return errors.New("URL must be an absolute https URL without credentials or fragment")
+	}
+	if wk.allowPrivateNetworks {
+		return nil
+	}
+	host := strings.ToLower(strings.TrimSuffix(uri.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("URL must not point to this machine")
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && blockedAddr(addr) {
+		return errors.New("URL must not point to a loopback or private address")
+	}
+	return nil
+}
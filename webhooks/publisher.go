@@ -0,0 +1,113 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"workout-tracker/store"
+)
+
+// Publisher queues events for the subscriptions of a user.
+type Publisher struct {
+	store store.WebhookStore
+}
+
+func NewPublisher(webhookStore store.WebhookStore) *Publisher {
+	return &Publisher{store: webhookStore}
+}
+
+// Publish queues the event for every subscription of the user that asked
+// for it. Publishing an event id again queues nothing, so jobs can publish
+// their events again when they are retried.
+func (p *Publisher) Publish(ctx context.Context, userId int, event *Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = p.store.EnqueueEvent(ctx, userId, event.Id, event.Type, payload)
+	return err
+}
+
+// HandleWorkoutEvent returns the job handler that publishes workout events
+// written to the outbox by the workout store, along with record.achieved
+// for new personal records.
+func (p *Publisher) HandleWorkoutEvent(workoutStore store.WorkoutStore) func(context.Context, *store.Job) error {
+	return func(ctx context.Context, job *store.Job) error {
+		var change store.WorkoutEvent
+		err := json.Unmarshal(job.Payload, &change)
+		if err != nil {
+			return err
+		}
+
+		// Event ids derive from the job so retries publish the same events
+		var data interface{} = change.Workout
+		if change.Type == store.WorkoutDeleted || change.Type == store.WorkoutRestored {
+			data = map[string]interface{}{"id": change.Workout.Id, "title": change.Workout.Title}
+		}
+		event := &Event{Id: fmt.Sprintf("evt_job%d", job.Id), Type: change.Type, CreatedAt: job.CreatedAt, Data: data}
+		err = p.Publish(ctx, change.UserId, event)
+		if err != nil {
+			return err
+		}
+
+		if change.Type != store.WorkoutCreated {
+			return nil
+		}
+		records, err := newRecords(ctx, workoutStore, change.Workout)
+		if err != nil {
+			return err
+		}
+		for i, record := range records {
+			event := &Event{Id: fmt.Sprintf("evt_job%d_%d", job.Id, i), Type: EventRecordAchieved, CreatedAt: job.CreatedAt, Data: record}
+			err = p.Publish(ctx, change.UserId, event)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// newRecords finds the exercises whose best estimated one rep max in the
+// workout beats the user's best from their other workouts. The first time
+// an exercise is logged is not a record.
+func newRecords(ctx context.Context, workoutStore store.WorkoutStore, workout *store.Workout) ([]map[string]interface{}, error) {
+	best := map[string]store.WorkoutEntry{}
+	var exercises []string
+	for _, entry := range workout.Entries {
+		if entry.Weight == nil || entry.Reps == nil || *entry.Reps <= 0 {
+			continue
+		}
+		key := strings.ToLower(entry.ExerciseName)
+		current, seen := best[key]
+		if !seen {
+			exercises = append(exercises, key)
+		}
+		if !seen || store.EstimateOneRepMax(*entry.Weight, *entry.Reps) > store.EstimateOneRepMax(*current.Weight, *current.Reps) {
+			best[key] = entry
+		}
+	}
+
+	var records []map[string]interface{}
+	for _, key := range exercises {
+		entry := best[key]
+		previous, err := workoutStore.GetBestOneRepMax(ctx, workout.UserId, entry.ExerciseName, int64(workout.Id))
+		if err != nil {
+			return nil, err
+		}
+		estimate := store.EstimateOneRepMax(*entry.Weight, *entry.Reps)
+		if previous <= 0 || estimate <= previous {
+			continue
+		}
+		records = append(records, map[string]interface{}{
+			"workout_id":            workout.Id,
+			"exercise_name":         entry.ExerciseName,
+			"weight":                *entry.Weight,
+			"reps":                  *entry.Reps,
+			"estimated_one_rep_max": estimate,
+			"previous_best":         previous,
+		})
+	}
+	return records, nil
+}
@@ -0,0 +1,109 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+	"workout-tracker/backoff"
+	"workout-tracker/store"
+)
+
+// Event types a subscription can ask for. Workout events carry the type
+// the workout store gave them.
+const (
+	EventWorkoutCreated  = store.WorkoutCreated
+	EventWorkoutUpdated  = store.WorkoutUpdated
+	EventWorkoutDeleted  = store.WorkoutDeleted
+	EventWorkoutRestored = store.WorkoutRestored
+	EventRecordAchieved  = "record.achieved"
+	// EventReminder is sent by reminders that notify through webhooks.
+	EventReminder = "reminder.triggered"
+	// EventPing is only sent by the test endpoint and is never retried.
+	EventPing = "ping"
+)
+
+// Events lists the event types in the order they are documented.
+var Events = []string{EventWorkoutCreated, EventWorkoutUpdated, EventWorkoutDeleted, EventWorkoutRestored, EventRecordAchieved, EventReminder}
+
+func ValidEvent(event string) bool {
+	for _, known := range Events {
+		if known == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers sent with every delivery.
+const (
+	HeaderId        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// SecretPrefix marks webhook signing secrets.
+const SecretPrefix = "whsec_"
+
+// signatureVersion prefixes signatures so the scheme can change later.
+const signatureVersion = "v1="
+
+// maxBackoff caps the delay between retries.
+const maxBackoff = 6 * time.Hour
+
+// Event is the JSON body of a delivery. Retries of a delivery send the same
+// event, so receivers can use Id to drop duplicates.
+type Event struct {
+	Id        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+func NewEvent(eventType string, data interface{}) (*Event, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		Id:        "evt_" + hex.EncodeToString(id),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}, nil
+}
+
+// Sign returns the signature of a delivery: the hex encoded HMAC-SHA256,
+// keyed with the subscription secret, of the timestamp, a dot and the body.
+// Covering the timestamp lets receivers reject replayed deliveries.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signatureVersion + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature the way a receiver should, refusing deliveries
+// signed more than tolerance away from now.
+func Verify(secret, timestamp, signature string, body []byte, tolerance time.Duration, now time.Time) bool {
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(signedAt, 0))
+	if age > tolerance || age < -tolerance {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, signedAt, body)))
+}
+
+// Backoff is how long to wait before retrying after the given failed
+// attempt, starting at one: base, doubling with every further attempt.
+func Backoff(attempt int, base time.Duration) time.Duration {
+	return backoff.Delay(attempt, base, maxBackoff)
+}
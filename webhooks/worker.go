@@ -0,0 +1,187 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"workout-tracker/config"
+	"workout-tracker/store"
+)
+
+// batchSize is how many due deliveries are claimed at once.
+const batchSize = 20
+
+// Worker sends queued deliveries, retrying failed ones with exponential
+// backoff until they succeed or run out of attempts.
+type Worker struct {
+	store                store.WebhookStore
+	client               *http.Client
+	pollInterval         time.Duration
+	maxAttempts          int
+	retryBackoff         time.Duration
+	allowPrivateNetworks bool
+	logger               *slog.Logger
+}
+
+func NewWorker(webhookStore store.WebhookStore, cfg config.WebhookConfig, logger *slog.Logger) *Worker {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = dialControl
+	}
+	return &Worker{
+		store: webhookStore,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// No proxy, so that the dialer sees the endpoint's address
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: cfg.Timeout,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// A redirect is answered like any other non-2xx status rather
+			// than followed to wherever it points.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		pollInterval:         cfg.PollInterval,
+		maxAttempts:          cfg.MaxAttempts,
+		retryBackoff:         cfg.RetryBackoff,
+		allowPrivateNetworks: cfg.AllowPrivateNetworks,
+		logger:               logger,
+	}
+}
+
+// Run delivers due deliveries every poll interval until ctx is cancelled.
+// A delivery being sent at that moment is allowed to finish.
+func (wk *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(wk.pollInterval)
+	defer ticker.Stop()
+	for {
+		wk.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (wk *Worker) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		// Claimed deliveries are hidden from other instances for the lease,
+		// so they are retried if this one stops before recording them.
+		deliveries, err := wk.store.ClaimDueDeliveries(ctx, batchSize, wk.client.Timeout+time.Minute)
+		if err != nil {
+			if ctx.Err() == nil {
+				wk.logger.ErrorContext(ctx, "failed to claim webhook deliveries", "error", err)
+			}
+			return
+		}
+		for i := range deliveries {
+			if ctx.Err() != nil {
+				return
+			}
+			wk.Deliver(context.WithoutCancel(ctx), &deliveries[i])
+		}
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// Deliver makes one attempt to send a delivery and records the outcome,
+// scheduling a retry when it failed and attempts remain.
+func (wk *Worker) Deliver(ctx context.Context, delivery *store.WebhookDelivery) {
+	statusCode, err := wk.send(ctx, delivery)
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseStatus = nil
+	if statusCode != 0 {
+		delivery.ResponseStatus = &statusCode
+	}
+	switch {
+	case err == nil:
+		delivery.Status = store.DeliverySucceeded
+		delivery.LastError = nil
+		delivery.DeliveredAt = &now
+	case delivery.EventType == EventPing || delivery.Attempts >= wk.maxAttempts:
+		delivery.Status = store.DeliveryFailed
+	default:
+		delivery.Status = store.DeliveryPending
+		delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts, wk.retryBackoff))
+	}
+	if err != nil {
+		message := describeError(err)
+		delivery.LastError = &message
+		wk.logger.WarnContext(ctx, "webhook delivery failed",
+			"delivery_id", delivery.Id, "event", delivery.EventType, "attempt", delivery.Attempts, "error", err)
+	}
+
+	err = wk.store.RecordDeliveryAttempt(ctx, delivery)
+	if err != nil {
+		wk.logger.ErrorContext(ctx, "failed to record webhook delivery", "delivery_id", delivery.Id, "error", err)
+	}
+}
+
+// send posts the signed payload. Any status other than 2xx is an error.
+func (wk *Worker) send(ctx context.Context, delivery *store.WebhookDelivery) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "workout-tracker-webhooks")
+	request.Header.Set(HeaderId, delivery.EventId)
+	request.Header.Set(HeaderEvent, delivery.EventType)
+	request.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := wk.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, &statusError{resp.Status}
+	}
+	return resp.StatusCode, nil
+}
+
+type statusError struct {
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "the endpoint answered " + e.status
+}
+
+// describeError says why a delivery failed without the details of network
+// errors, since deliveries are shown to the subscription's owner and those
+// details would tell them about the network the worker runs in.
+func describeError(err error) string {
+	var status *statusError
+	var timeout interface{ Timeout() bool }
+	switch {
+	case errors.As(err, &status):
+		return status.Error()
+	case errors.Is(err, errBlockedAddress):
+		return errBlockedAddress.Error()
+	case errors.As(err, &timeout) && timeout.Timeout():
+		return "the endpoint did not answer in time"
+	default:
+		return "the endpoint could not be reached"
+	}
+}